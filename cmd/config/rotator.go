@@ -7,9 +7,12 @@ import (
 )
 
 type Rotator struct {
-	Logger     LoggerConf `json:"logger"`
-	RestServer RestConf   `json:"rest_server"`
-	DB         DBConf     `json:"database"`
+	Logger     LoggerConf  `json:"logger"`
+	RestServer RestConf    `json:"rest_server"`
+	DB         DBConf      `json:"database"`
+	Cache      CacheConf   `json:"cache"`
+	Metrics    MetricsConf `json:"metrics"`
+	Tracing    TracingConf `json:"tracing"`
 }
 
 func NewCalendar(filePath string) (Rotator, error) {
@@ -32,13 +35,60 @@ type LoggerConf struct {
 	FilePath string `json:"file_path"`
 }
 
+// RestConf - DrainSec: сколько при остановке /readyz отвечает 503 до закрытия соединений.
+// CrashOnPanic - завершать процесс при панике обработчика вместо ответа 500, для отладки.
 type RestConf struct {
-	Address string `json:"address"`
+	Address      string `json:"address"`
+	DrainSec     int64  `json:"drain_sec"`
+	CrashOnPanic bool   `json:"crash_on_panic"`
 }
 
+const (
+	DriverPostgres = "postgres"
+	DriverMemory   = "memory"
+	DriverEmbedded = "embedded"
+)
+
 type DBConf struct {
-	Username string `json:"username"`
-	Password string `json:"password"`
-	Address  string `json:"address"`
-	DBName   string `json:"db_name"`
+	Driver   string   `json:"driver"`
+	Username string   `json:"username"`
+	Password string   `json:"password"`
+	Address  string   `json:"address"`
+	DBName   string   `json:"db_name"`
+	Path     string   `json:"path"`
+	Replicas []string `json:"replicas"`
+
+	MaxOpenConns         int    `json:"max_open_conns"`
+	MaxIdleConns         int    `json:"max_idle_conns"`
+	ConnMaxLifetimeSec   int64  `json:"conn_max_lifetime_sec"`
+	ConnMaxIdleTimeSec   int64  `json:"conn_max_idle_time_sec"`
+	StatementTimeoutMs   int64  `json:"statement_timeout_ms"`
+	ApplicationName      string `json:"application_name"`
+	SSLMode              string `json:"ssl_mode"`
+	SSLRootCert          string `json:"ssl_root_cert"`
+	SSLCert              string `json:"ssl_cert"`
+	SSLKey               string `json:"ssl_key"`
+	PoolStatsIntervalSec int64  `json:"pool_stats_interval_sec"`
+}
+
+type CacheConf struct {
+	Enabled         bool  `json:"enabled"`
+	FlushIntervalMs int64 `json:"flush_interval_ms"`
+	FlushSize       int   `json:"flush_size"`
+	MaxPending      int   `json:"max_pending"`
+	MaxStalenessMs  int64 `json:"max_staleness_ms"`
+}
+
+// MetricsConf - метрики Prometheus, отдаются на /metrics HTTP-сервера сервиса.
+type MetricsConf struct {
+	Enabled bool `json:"enabled"`
+}
+
+// TracingConf - экспорт спанов OpenTelemetry. Exporter: "" (выключен), stdout или otlp (OTLP/HTTP на Endpoint).
+// SampleRatio - доля трассировок, начатых сервисом, 0 - все.
+type TracingConf struct {
+	Exporter    string  `json:"exporter"`
+	Endpoint    string  `json:"endpoint"`
+	Insecure    bool    `json:"insecure"`
+	SampleRatio float64 `json:"sample_ratio"`
 }
@@ -15,13 +15,76 @@ type Rabbit struct {
 	QueueName    string `json:"queue_name"`
 	RoutingKey   string `json:"routing_key"`
 	ConsumerTag  string `json:"consumer_tag"`
+
+	DeadLetterExchange string `json:"dead_letter_exchange"`
+	DeadLetterQueue    string `json:"dead_letter_queue"`
+}
+
+const (
+	SinkRabbitMQ = "rabbitmq"
+	SinkFile     = "file"
+	SinkWebhook  = "webhook"
+	SinkStdout   = "stdout"
+)
+
+type Sink struct {
+	Type    string      `json:"type"`
+	File    FileSink    `json:"file"`
+	Webhook WebhookSink `json:"webhook"`
+}
+
+type FileSink struct {
+	Dir               string `json:"dir"`
+	Prefix            string `json:"prefix"`
+	MaxSizeBytes      int64  `json:"max_size_bytes"`
+	RotateIntervalSec int64  `json:"rotate_interval_sec"`
+}
+
+type WebhookSink struct {
+	URL            string            `json:"url"`
+	Headers        map[string]string `json:"headers"`
+	TimeoutMs      int64             `json:"timeout_ms"`
+	MaxRetries     int               `json:"max_retries"`
+	RetryBackoffMs int64             `json:"retry_backoff_ms"`
+}
+
+const (
+	DeadLetterDatabase = "database"
+	DeadLetterFile     = "file"
+)
+
+type DeadLetter struct {
+	Type     string `json:"type"`
+	FilePath string `json:"file_path"`
 }
 
 type Statistic struct {
 	Logger        LoggerConf `json:"logger"`
+	Sink          Sink       `json:"sink"`
+	DeadLetter    DeadLetter `json:"dead_letter"`
 	RabbitMQ      Rabbit     `json:"rabbit_mq"`
 	Database      DBConf     `json:"database"`
 	IntervalInSec int64      `json:"interval_in_sec"`
+	OutboxBatch   int        `json:"outbox_batch_size"`
+	EventFormat   string     `json:"event_format"`
+	Retention     Retention  `json:"retention"`
+	Rollup        Rollup     `json:"rollup"`
+	// HTTPServer - служебный HTTP-сервер (метрики), не запускается при пустом адресе.
+	HTTPServer RestConf    `json:"http_server"`
+	Metrics    MetricsConf `json:"metrics"`
+	Tracing    TracingConf `json:"tracing"`
+}
+
+type Rollup struct {
+	IntervalInSec int64 `json:"interval_in_sec"`
+	LagSec        int64 `json:"lag_sec"`
+}
+
+type Retention struct {
+	EventDays           int   `json:"event_days"`
+	OutboxKeepHours     int   `json:"outbox_keep_hours"`
+	PartitionsAheadDays int   `json:"partitions_ahead_days"`
+	IntervalInSec       int64 `json:"interval_in_sec"`
 }
 
 func NewStatistic(filePath string) (Statistic, error) {
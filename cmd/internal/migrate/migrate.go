@@ -0,0 +1,26 @@
+// Package migrate - разбор аргументов команды migrate, общий для сервисов.
+package migrate
+
+import (
+	"fmt"
+)
+
+// Migrator - хранилище со встроенными миграциями, например sql.BannerDataStore.
+type Migrator interface {
+	Migrate(command string) error
+}
+
+// Run - выполняет migrate up|down|status по аргументам после имени команды.
+// К ошибке в аргументах добавляется usage сервиса.
+func Run(args []string, store Migrator, usage string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("migrate: expected one of up, down, status\n\n%s", usage)
+	}
+
+	switch args[0] {
+	case "up", "down", "status":
+		return store.Migrate(args[0])
+	default:
+		return fmt.Errorf("migrate: unknown subcommand %q\n\n%s", args[0], usage)
+	}
+}
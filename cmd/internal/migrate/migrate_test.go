@@ -0,0 +1,35 @@
+package migrate_test
+
+import (
+	"testing"
+
+	"github.com/nsmak/bannersRotation/cmd/internal/migrate"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeMigrator struct {
+	commands []string
+}
+
+func (f *fakeMigrator) Migrate(command string) error {
+	f.commands = append(f.commands, command)
+	return nil
+}
+
+func TestRun(t *testing.T) {
+	store := &fakeMigrator{}
+
+	require.NoError(t, migrate.Run([]string{"status"}, store, "usage"))
+	require.Equal(t, []string{"status"}, store.commands)
+}
+
+func TestRunRejectsArgs(t *testing.T) {
+	store := &fakeMigrator{}
+	for _, args := range [][]string{nil, {"up", "down"}, {"redo"}} {
+		err := migrate.Run(args, store, "usage")
+
+		require.Error(t, err, args)
+		require.Contains(t, err.Error(), "usage", args)
+	}
+	require.Empty(t, store.commands)
+}
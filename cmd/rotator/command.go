@@ -0,0 +1,30 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/nsmak/bannersRotation/cmd/config"
+	"github.com/nsmak/bannersRotation/cmd/internal/migrate"
+	"github.com/nsmak/bannersRotation/internal/app"
+	sqlstorage "github.com/nsmak/bannersRotation/internal/storage/sql"
+)
+
+const usage = `usage: rotator [-config path] [command]
+
+commands:
+  migrate up|down|status   apply, roll back the last or list database migrations (postgres driver only)
+
+without a command the service serves the REST API`
+
+func runCommand(args []string, cfg config.DBConf, store app.Storage) error {
+	switch args[0] {
+	case "migrate":
+		pg, ok := store.(*sqlstorage.BannerDataStore)
+		if !ok {
+			return fmt.Errorf("migrate: database driver %q has no migrations", cfg.Driver)
+		}
+		return migrate.Run(args[1:], pg, usage)
+	default:
+		return fmt.Errorf("unknown command %q\n\n%s", args[0], usage)
+	}
+}
@@ -3,6 +3,8 @@ package main
 import (
 	"context"
 	"flag"
+	"fmt"
+	"io"
 	"log"
 	"os"
 	"os/signal"
@@ -11,9 +13,14 @@ import (
 	"github.com/nsmak/bannersRotation/cmd/config"
 	"github.com/nsmak/bannersRotation/internal/app"
 	"github.com/nsmak/bannersRotation/internal/logger"
+	"github.com/nsmak/bannersRotation/internal/metrics"
 	"github.com/nsmak/bannersRotation/internal/server/rest"
 	"github.com/nsmak/bannersRotation/internal/server/rest/api"
+	"github.com/nsmak/bannersRotation/internal/storage/cache"
+	"github.com/nsmak/bannersRotation/internal/storage/embedded"
+	"github.com/nsmak/bannersRotation/internal/storage/memory"
 	sqlstorage "github.com/nsmak/bannersRotation/internal/storage/sql"
+	"github.com/nsmak/bannersRotation/internal/tracing"
 )
 
 var configFile string
@@ -38,35 +45,164 @@ func main() {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
+	shutdownTracing, err := tracing.Setup(ctx, cfg.Tracing, "rotator")
+	if err != nil {
+		log.Fatalf("can't set up tracing: %v", err)
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+		defer cancel()
+		if err := shutdownTracing(ctx); err != nil {
+			logg.Error("can't flush spans", logg.String("msg", err.Error()))
+		}
+	}()
+
+	if flag.Arg(0) == "migrate" {
+		// Миграции больших таблиц не должны обрываться таймаутом, рассчитанным на запросы сервиса.
+		cfg.DB.StatementTimeoutMs = 0
+	}
+
 	log.Println("starting store service")
-	storage, err := sqlstorage.New(ctx, cfg.DB.Username, cfg.DB.Password, cfg.DB.Address, cfg.DB.DBName)
+	store, err := newStorage(ctx, cfg.DB)
 	if err != nil {
 		log.Fatalf("failed to start storage connection: " + err.Error()) // nolint: gocritic
 	}
+	if closer, ok := store.(io.Closer); ok {
+		defer closer.Close()
+	}
+
+	if args := flag.Args(); len(args) > 0 {
+		if err := runCommand(args, cfg.DB, store); err != nil {
+			log.Fatalln(err)
+		}
+		return
+	}
+
+	pg, isPostgres := store.(*sqlstorage.BannerDataStore)
+	if isPostgres {
+		if err := pg.CheckSchema(ctx); err != nil {
+			log.Fatalln(err)
+		}
+		if cfg.DB.PoolStatsIntervalSec > 0 {
+			go pg.ReportPoolStats(ctx, logg, time.Duration(cfg.DB.PoolStatsIntervalSec)*time.Second)
+		}
+	}
+
+	// Отчеты строятся из агрегатов, которые считает сервис статистики, поэтому есть только у postgres.
+	var reports *app.ReportDomain
+	if reportStore, ok := store.(app.ReportStore); ok {
+		reports = app.NewReports(reportStore, logg)
+	}
 
-	rotator := app.NewRotator(storage, logg)
-	server := rest.NewServer(api.New(rotator), cfg.RestServer.Address, logg)
+	var (
+		rotatorMetrics app.RotatorMetrics
+		serverMetrics  rest.Metrics
+		apis           []rest.API
+		m              *metrics.Metrics
+	)
+	if cfg.Metrics.Enabled {
+		m = metrics.New("rotator")
+		rotatorMetrics, serverMetrics = m, m
+		apis = append(apis, m)
+		if isPostgres {
+			m.RegisterPools(pg)
+			pg.ObserveQueries(m)
+		}
+	}
+	// Postgres сам замеряет все свои запросы, включая отчеты; остальные драйверы замеряются оберткой.
+	timeStore := m != nil && !isPostgres
 
+	var statsCache *cache.Storage
+	if cfg.Cache.Enabled {
+		writer, ok := store.(app.EventBatchWriter)
+		if !ok {
+			log.Fatalf("database driver %q doesn't support batch writes required by cache", cfg.DB.Driver)
+		}
+		if timeStore {
+			store = metrics.NewStorage(store, m)
+			writer = metrics.NewEventBatchWriter(writer, m)
+		}
+		statsCache = cache.New(store, writer, cfg.Cache, logg)
+		store = statsCache
+		go statsCache.Run(ctx)
+	} else if timeStore {
+		store = metrics.NewStorage(store, m)
+	}
+
+	rotator := app.NewRotator(store, logg, rotatorMetrics)
+	apis = append(apis, api.New(rotator, reports))
+	server := rest.NewServer(cfg.RestServer.Address, logg, serverMetrics, apis...)
+	server.DrainDelay = time.Duration(cfg.RestServer.DrainSec) * time.Second
+	server.CrashOnPanic = cfg.RestServer.CrashOnPanic
+	if isPostgres {
+		server.AddReadinessCheck("database", pg)
+		server.AddReadinessCheck("schema", rest.PingerFunc(pg.CheckSchema))
+	}
+
+	shutdownDone := make(chan struct{})
 	go func() {
+		defer close(shutdownDone)
+
 		signals := make(chan os.Signal, 1)
 		signal.Notify(signals, os.Interrupt)
 
 		<-signals
 		signal.Stop(signals)
-		cancel()
 
-		ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
-		defer cancel()
+		// Кэш сбрасывает события по таймеру, пока сервер принимает запросы, в том числе drain_sec
+		// после сигнала, поэтому общий контекст отменяется только после остановки сервера.
+		stopCtx, stopCancel := context.WithTimeout(context.Background(), time.Second*3+server.DrainDelay)
+		defer stopCancel()
 
 		log.Println("stopping rest server...")
-		if err := server.Stop(ctx); err != nil {
+		if err := server.Stop(stopCtx); err != nil {
 			logg.Error("failed to stop rest server", logg.String("msg", err.Error()))
 		}
+		cancel()
+
+		if statsCache != nil {
+			flushCtx, flushCancel := context.WithTimeout(context.Background(), 3*time.Second)
+			defer flushCancel()
+
+			log.Println("flushing statistics cache...")
+			if err := statsCache.Flush(flushCtx); err != nil {
+				logg.Error("failed to flush statistics cache", logg.String("msg", err.Error()))
+			}
+		}
 	}()
 
 	log.Println("starting REST server at " + server.Address)
 	if err := server.Start(ctx); err != nil {
 		logg.Error("failed to start rest server", logg.String("msg", err.Error()))
+		return
 	}
+	<-shutdownDone
 	log.Println("server stopped")
 }
+
+func newStorage(ctx context.Context, cfg config.DBConf) (app.Storage, error) {
+	switch cfg.Driver {
+	case "", config.DriverPostgres:
+		store, err := sqlstorage.New(ctx, cfg)
+		if err != nil {
+			return nil, err
+		}
+		return store, nil
+	case config.DriverMemory:
+		store := memory.New()
+		store.LoadDefaults()
+		return store, nil
+	case config.DriverEmbedded:
+		store, err := embedded.Open(cfg.Path)
+		if err != nil {
+			return nil, err
+		}
+		if err := store.LoadDefaults(); err != nil {
+			_ = store.Close()
+			return nil, err
+		}
+		return store, nil
+	default:
+		return nil, fmt.Errorf("unknown database driver %q", cfg.Driver)
+	}
+}
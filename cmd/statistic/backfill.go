@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"time"
+
+	"github.com/nsmak/bannersRotation/internal/app"
+)
+
+func runBackfillCommand(ctx context.Context, args []string, newStatistic statisticFactory) error {
+	flags := flag.NewFlagSet("backfill", flag.ContinueOnError)
+	fromStr := flags.String("from", "", "range start, RFC3339 or YYYY-MM-DD (inclusive)")
+	toStr := flags.String("to", "", "range end, RFC3339 or YYYY-MM-DD (exclusive)")
+	step := flags.Duration("step", time.Hour, "size of one export window")
+	statePath := flags.String("state", "./backfill.state.json", "checkpoint file used to resume an interrupted backfill")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	from, err := parseTime(*fromStr)
+	if err != nil {
+		return fmt.Errorf("backfill: invalid -from: %w", err)
+	}
+	to, err := parseTime(*toStr)
+	if err != nil {
+		return fmt.Errorf("backfill: invalid -to: %w", err)
+	}
+
+	statistic, sink := newStatistic()
+	defer sink.Close()
+
+	started := time.Now()
+	err = statistic.Backfill(ctx, from, to, *step, fileCheckpoint(*statePath), func(state app.BackfillState) {
+		log.Printf(
+			"backfill %.1f%%: exported up to %s, %d events published, %s elapsed",
+			state.Percent(), state.Done.Format(time.RFC3339), state.Published, time.Since(started).Round(time.Second),
+		)
+	})
+	if err != nil {
+		return err
+	}
+
+	log.Println("backfill finished")
+	return nil
+}
+
+func parseTime(value string) (time.Time, error) {
+	if t, err := time.Parse("2006-01-02", value); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return t.Truncate(time.Second), nil
+}
+
+type fileCheckpoint string
+
+func (f fileCheckpoint) Load(_ context.Context) (app.BackfillState, bool, error) {
+	data, err := ioutil.ReadFile(string(f))
+	if os.IsNotExist(err) {
+		return app.BackfillState{}, false, nil
+	}
+	if err != nil {
+		return app.BackfillState{}, false, err
+	}
+
+	var state app.BackfillState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return app.BackfillState{}, false, err
+	}
+	return state, true, nil
+}
+
+func (f fileCheckpoint) Save(_ context.Context, state app.BackfillState) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+
+	tmp := string(f) + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, string(f))
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/nsmak/bannersRotation/internal/app"
+)
+
+const usage = `usage: statistic [-config path] [command]
+
+commands:
+  backfill -from t -to t [-step 1h] [-state path]
+                                 re-export shows and clicks in [from, to), resumable
+  deadletter list [-limit n]     show dead-lettered events
+  deadletter replay [-limit n]   publish dead-lettered events again and remove them on success
+  rollup -from t -to t           recompute hourly and daily rollups for [from, to)
+  export -from t -to t [-format csv|xlsx] [-group-by dims] [-bucket hour|day|week]
+         [-banner-id n] [-slot-id n] [-social-id n] [-confidence 0.95] [-out path]
+                                 write banner shows, clicks and CTR for [from, to) to a file or stdout
+  migrate up|down|status         apply, roll back the last or list database migrations
+
+without a command the service exports statistics periodically`
+
+type statisticFactory func() (*app.Statistic, app.EventSink)
+
+func runCommand(
+	ctx context.Context,
+	args []string,
+	deadLetters app.DeadLetterStore,
+	rollup *app.Rollup,
+	reports *app.ReportDomain,
+	newStatistic statisticFactory,
+) error {
+	switch args[0] {
+	case "backfill":
+		return runBackfillCommand(ctx, args[1:], newStatistic)
+	case "deadletter":
+		return runDeadLetterCommand(ctx, args[1:], deadLetters, newStatistic)
+	case "rollup":
+		return runRollupCommand(ctx, args[1:], rollup)
+	case "export":
+		return runExportCommand(ctx, args[1:], reports)
+	default:
+		return fmt.Errorf("unknown command %q\n\n%s", args[0], usage)
+	}
+}
+
+func runRollupCommand(ctx context.Context, args []string, rollup *app.Rollup) error {
+	flags := flag.NewFlagSet("rollup", flag.ContinueOnError)
+	fromStr := flags.String("from", "", "range start, RFC3339 or YYYY-MM-DD (inclusive)")
+	toStr := flags.String("to", "", "range end, RFC3339 or YYYY-MM-DD (exclusive)")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	from, err := parseTime(*fromStr)
+	if err != nil {
+		return fmt.Errorf("rollup: invalid -from: %w", err)
+	}
+	to, err := parseTime(*toStr)
+	if err != nil {
+		return fmt.Errorf("rollup: invalid -to: %w", err)
+	}
+
+	if err := rollup.Recompute(ctx, from, to); err != nil {
+		return err
+	}
+
+	fmt.Println("rollups recomputed")
+	return nil
+}
+
+func runDeadLetterCommand(
+	ctx context.Context,
+	args []string,
+	deadLetters app.DeadLetterStore,
+	newStatistic statisticFactory,
+) error {
+	if len(args) == 0 {
+		return fmt.Errorf("deadletter: missing subcommand\n\n%s", usage)
+	}
+
+	flags := flag.NewFlagSet("deadletter "+args[0], flag.ContinueOnError)
+	limit := flags.Int("limit", 100, "max number of events")
+	if err := flags.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "list":
+		letters, err := deadLetters.DeadLetters(ctx, *limit)
+		if err != nil {
+			return err
+		}
+		printDeadLetters(letters)
+		return nil
+	case "replay":
+		statistic, sink := newStatistic()
+		defer sink.Close()
+
+		replayed, err := statistic.ReplayDeadLetters(ctx, *limit)
+		fmt.Printf("replayed %d events\n", replayed)
+		return err
+	default:
+		return fmt.Errorf("deadletter: unknown subcommand %q\n\n%s", args[0], usage)
+	}
+}
+
+func printDeadLetters(letters []app.DeadLetter) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tEVENT ID\tTYPE\tBANNER\tSLOT\tSOCIAL\tOCCURRED AT\tFAILED AT\tREASON")
+	for _, l := range letters {
+		fmt.Fprintf(
+			w,
+			"%d\t%s\t%s\t%d\t%d\t%d\t%s\t%s\t%s\n",
+			l.ID, l.Event.ID, l.Event.Type, l.Event.BannerID, l.Event.SlotID, l.Event.SocialID,
+			l.Event.OccurredAt.Format(time.RFC3339Nano), l.FailedAt.Format(time.RFC3339), l.Reason,
+		)
+	}
+	_ = w.Flush()
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/nsmak/bannersRotation/internal/app"
+	"github.com/nsmak/bannersRotation/internal/export"
+)
+
+func runExportCommand(ctx context.Context, args []string, reports *app.ReportDomain) error {
+	flags := flag.NewFlagSet("export", flag.ContinueOnError)
+	fromStr := flags.String("from", "", "range start, RFC3339 or YYYY-MM-DD (inclusive)")
+	toStr := flags.String("to", "", "range end, RFC3339 or YYYY-MM-DD (exclusive)")
+	format := flags.String("format", export.FormatCSV, "file format: csv or xlsx")
+	groupBy := flags.String("group-by", "bucket,banner,slot,social", "comma-separated: bucket, banner, slot, social")
+	bucket := flags.String("bucket", string(app.GranularityDay), "time bucket: hour, day or week")
+	bannerID := flags.Int64("banner-id", 0, "only this banner")
+	slotID := flags.Int64("slot-id", 0, "only this slot")
+	socialID := flags.Int64("social-id", 0, "only this social group")
+	confidence := flags.Float64("confidence", app.DefaultReportConfidence, "confidence level of ctr_low and ctr_high")
+	out := flags.String("out", "", "output file, stdout if empty")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	from, err := parseTime(*fromStr)
+	if err != nil {
+		return fmt.Errorf("export: invalid -from: %w", err)
+	}
+	to, err := parseTime(*toStr)
+	if err != nil {
+		return fmt.Errorf("export: invalid -to: %w", err)
+	}
+
+	query := app.ReportQuery{
+		From:       from,
+		To:         to,
+		Bucket:     app.Granularity(*bucket),
+		BannerID:   *bannerID,
+		SlotID:     *slotID,
+		SocialID:   *socialID,
+		Confidence: *confidence,
+	}
+	if *groupBy != "" {
+		for _, dim := range strings.Split(*groupBy, ",") {
+			query.GroupBy = append(query.GroupBy, app.ReportDimension(strings.TrimSpace(dim)))
+		}
+	}
+
+	var w io.Writer = os.Stdout
+	if *out != "" {
+		f, err := os.Create(*out)
+		if err != nil {
+			return fmt.Errorf("export: %w", err)
+		}
+		defer f.Close()
+		w = f
+	}
+
+	writer, err := export.NewWriter(*format, w, query)
+	if err != nil {
+		return fmt.Errorf("export: %w", err)
+	}
+	if err := reports.Export(ctx, query, writer); err != nil {
+		return err
+	}
+	return writer.Close()
+}
@@ -3,16 +3,25 @@ package main
 import (
 	"context"
 	"flag"
+	"fmt"
 	"log"
 	"os"
 	"os/signal"
 	"time"
 
 	"github.com/nsmak/bannersRotation/cmd/config"
+	"github.com/nsmak/bannersRotation/cmd/internal/migrate"
 	"github.com/nsmak/bannersRotation/internal/app"
+	"github.com/nsmak/bannersRotation/internal/deadletter"
+	"github.com/nsmak/bannersRotation/internal/event"
 	"github.com/nsmak/bannersRotation/internal/logger"
+	"github.com/nsmak/bannersRotation/internal/metrics"
 	"github.com/nsmak/bannersRotation/internal/mq/rabbit"
+	"github.com/nsmak/bannersRotation/internal/server/rest"
+	"github.com/nsmak/bannersRotation/internal/sink/ndjson"
+	"github.com/nsmak/bannersRotation/internal/sink/webhook"
 	sqlstorage "github.com/nsmak/bannersRotation/internal/storage/sql"
+	"github.com/nsmak/bannersRotation/internal/tracing"
 )
 
 var configFile string
@@ -34,27 +43,122 @@ func main() {
 		log.Fatalf("can't start logger %v\n", err)
 	}
 
-	producer, err := rabbit.NewProducer(cfg.RabbitMQ)
+	encoder, err := event.NewEncoder(cfg.EventFormat)
 	if err != nil {
-		log.Fatalf("can't create consumer: %v", err)
+		log.Fatalf("can't create event encoder: %v", err)
 	}
 
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
+	shutdownTracing, err := tracing.Setup(ctx, cfg.Tracing, "statistic")
+	if err != nil {
+		log.Fatalf("can't set up tracing: %v", err)
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+		defer cancel()
+		if err := shutdownTracing(ctx); err != nil {
+			logg.Error("can't flush spans", logg.String("msg", err.Error()))
+		}
+	}()
+
+	if cfg.Database.Driver != "" && cfg.Database.Driver != config.DriverPostgres {
+		log.Fatalf("database driver %q is not supported by the statistic service", cfg.Database.Driver)
+	}
+
+	// Сервис статистики выполняет только фоновые задачи и команды: пересчет агрегатов, backfill, выгрузки
+	// и миграции идут дольше таймаута, рассчитанного на запросы ротатора, поэтому таймаут выражений не задается.
+	cfg.Database.StatementTimeoutMs = 0
+
 	log.Println("starting store service")
-	storage, err := sqlstorage.New(
-		ctx,
-		cfg.Database.Username,
-		cfg.Database.Password,
-		cfg.Database.Address,
-		cfg.Database.DBName,
-	)
+	storage, err := sqlstorage.New(ctx, cfg.Database)
 	if err != nil {
 		log.Fatalf("failed to start storage connection: " + err.Error()) // nolint: gocritic
 	}
 
-	statistic := app.NewStatistic(logg, storage, producer, time.Duration(cfg.IntervalInSec)*time.Second)
+	if args := flag.Args(); len(args) > 0 && args[0] == "migrate" {
+		if err := migrate.Run(args[1:], storage, usage); err != nil {
+			log.Fatalln(err)
+		}
+		return
+	}
+
+	if err := storage.CheckSchema(ctx); err != nil {
+		log.Fatalln(err)
+	}
+	if cfg.Database.PoolStatsIntervalSec > 0 {
+		go storage.ReportPoolStats(ctx, logg, time.Duration(cfg.Database.PoolStatsIntervalSec)*time.Second)
+	}
+
+	deadLetters, err := newDeadLetterStore(cfg, storage)
+	if err != nil {
+		log.Fatalf("can't create dead letter store: %v", err)
+	}
+
+	var (
+		statisticMetrics app.StatisticMetrics
+		m                *metrics.Metrics
+	)
+	if cfg.Metrics.Enabled {
+		m = metrics.New("statistic")
+		m.RegisterPools(storage)
+		storage.ObserveQueries(m)
+		statisticMetrics = m
+	}
+
+	newStatistic := func() (*app.Statistic, app.EventSink) {
+		sink, err := newSink(cfg)
+		if err != nil {
+			log.Fatalf("can't create event sink: %v", err)
+		}
+		interval := time.Duration(cfg.IntervalInSec) * time.Second
+		return app.NewStatistic(
+			logg, storage, sink, encoder, deadLetters, statisticMetrics, interval, cfg.OutboxBatch,
+		), sink
+	}
+
+	rollup := app.NewRollup(
+		logg,
+		storage,
+		time.Duration(cfg.Rollup.LagSec)*time.Second,
+		time.Duration(cfg.Rollup.IntervalInSec)*time.Second,
+	)
+
+	if args := flag.Args(); len(args) > 0 {
+		if err := runCommand(ctx, args, deadLetters, rollup, app.NewReports(storage, logg), newStatistic); err != nil {
+			log.Fatalln(err)
+		}
+		return
+	}
+
+	statistic, sink := newStatistic()
+
+	var server *rest.Server
+	if cfg.HTTPServer.Address != "" {
+		var (
+			serverMetrics rest.Metrics
+			apis          []rest.API
+		)
+		if m != nil {
+			serverMetrics = m
+			apis = append(apis, m)
+		}
+		server = rest.NewServer(cfg.HTTPServer.Address, logg, serverMetrics, apis...)
+		server.DrainDelay = time.Duration(cfg.HTTPServer.DrainSec) * time.Second
+		server.CrashOnPanic = cfg.HTTPServer.CrashOnPanic
+		server.AddReadinessCheck("database", storage)
+		server.AddReadinessCheck("schema", rest.PingerFunc(storage.CheckSchema))
+		if broker, ok := sink.(rest.Pinger); ok {
+			server.AddReadinessCheck("broker", broker)
+		}
+		go func() {
+			log.Println("starting HTTP server at " + server.Address)
+			if err := server.Start(ctx); err != nil {
+				logg.Error("failed to start http server", logg.String("msg", err.Error()))
+			}
+		}()
+	}
 
 	go func() {
 		signals := make(chan os.Signal, 1)
@@ -62,13 +166,80 @@ func main() {
 
 		<-signals
 		signal.Stop(signals)
-		err := producer.CloseConn()
+
+		// Сервер останавливается первым, чтобы /readyz перестал отвечать успехом до закрытия брокера.
+		if server != nil {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second*3+server.DrainDelay)
+			defer cancel()
+			if err := server.Stop(ctx); err != nil {
+				logg.Error("failed to stop http server", logg.String("msg", err.Error()))
+			}
+		}
+
+		err := sink.Close()
 		if err != nil {
-			logg.Error("can't close connection", logg.String("msg", err.Error()))
+			logg.Error("can't close event sink", logg.String("msg", err.Error()))
 		}
 		cancel()
 	}()
 
+	retention := app.NewRetention(
+		logg,
+		storage,
+		storage,
+		storage,
+		time.Duration(cfg.Retention.EventDays)*24*time.Hour,
+		time.Duration(cfg.Retention.OutboxKeepHours)*time.Hour,
+		cfg.Retention.PartitionsAheadDays,
+		time.Duration(cfg.Retention.IntervalInSec)*time.Second,
+	)
+	go retention.Run(ctx)
+	go rollup.Run(ctx)
+
 	log.Println("starting statistic service")
 	statistic.Run(ctx)
 }
+
+func newSink(cfg config.Statistic) (app.EventSink, error) {
+	// file и stdout пишут события построчно, бинарный protobuf может содержать перевод строки.
+	ndjsonSink := cfg.Sink.Type == config.SinkFile || cfg.Sink.Type == config.SinkStdout
+	if ndjsonSink && cfg.EventFormat == event.FormatProtobuf {
+		return nil, fmt.Errorf("sink type %q requires event format %q", cfg.Sink.Type, event.FormatJSON)
+	}
+
+	switch cfg.Sink.Type {
+	case "", config.SinkRabbitMQ:
+		producer, err := rabbit.NewProducer(cfg.RabbitMQ)
+		if err != nil {
+			return nil, err
+		}
+		return producer, nil
+	case config.SinkFile:
+		fileSink, err := ndjson.NewFileSink(cfg.Sink.File)
+		if err != nil {
+			return nil, err
+		}
+		return fileSink, nil
+	case config.SinkWebhook:
+		return webhook.New(cfg.Sink.Webhook), nil
+	case config.SinkStdout:
+		return ndjson.NewWriterSink(os.Stdout), nil
+	default:
+		return nil, fmt.Errorf("unknown sink type %q", cfg.Sink.Type)
+	}
+}
+
+func newDeadLetterStore(cfg config.Statistic, storage *sqlstorage.BannerDataStore) (app.DeadLetterStore, error) {
+	switch cfg.DeadLetter.Type {
+	case "", config.DeadLetterDatabase:
+		return storage, nil
+	case config.DeadLetterFile:
+		store, err := deadletter.NewFileStore(cfg.DeadLetter.FilePath)
+		if err != nil {
+			return nil, err
+		}
+		return store, nil
+	default:
+		return nil, fmt.Errorf("unknown dead letter store type %q", cfg.DeadLetter.Type)
+	}
+}
@@ -1,16 +1,26 @@
 module github.com/nsmak/bannersRotation
 
-go 1.15
+go 1.16
 
 require (
 	github.com/golang/mock v1.4.4
+	github.com/google/uuid v1.2.0
 	github.com/gorilla/mux v1.8.0
 	github.com/gorilla/schema v1.2.0
 	github.com/jackc/pgconn v1.8.0
 	github.com/jackc/pgx/v4 v4.10.1
 	github.com/jmoiron/sqlx v1.2.0
 	github.com/justinas/alice v1.2.0
+	github.com/pressly/goose/v3 v3.1.0
+	github.com/prometheus/client_golang v1.11.1
 	github.com/streadway/amqp v1.0.0
-	github.com/stretchr/testify v1.5.1
+	github.com/stretchr/testify v1.7.0
+	go.etcd.io/bbolt v1.3.5
+	go.opentelemetry.io/otel v1.0.1
+	go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp v1.0.1
+	go.opentelemetry.io/otel/exporters/stdout/stdouttrace v1.0.1
+	go.opentelemetry.io/otel/sdk v1.0.1
+	go.opentelemetry.io/otel/trace v1.0.1
 	go.uber.org/zap v1.16.0
+	google.golang.org/protobuf v1.27.1
 )
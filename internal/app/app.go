@@ -7,7 +7,9 @@ import (
 	"go.uber.org/zap"
 )
 
+// Logger - WithContext возвращает логгер, который добавляет в записи идентификатор запроса из ctx.
 type Logger interface {
+	WithContext(ctx context.Context) Logger
 	Info(msg string, fields ...zap.Field)
 	Warn(msg string, fields ...zap.Field)
 	Error(msg string, fields ...zap.Field)
@@ -16,7 +18,7 @@ type Logger interface {
 	Duration(key string, val time.Duration) zap.Field
 }
 
-//go:generate mockgen -destination=./mock_storage_test.go -package=app_test . Storage
+//go:generate mockgen -destination=./mock_storage_test.go -package=app_test . Storage,StatisticStore
 //go:generate mockgen -destination=../server/rest/api/mock_storage_test.go -package=api_test . Storage
 type Storage interface {
 	AddBannerToSlot(ctx context.Context, bannerID, slotID int64) error
@@ -24,13 +26,97 @@ type Storage interface {
 	BannersStatistics(ctx context.Context, slotID, socialID int64) ([]BannerSummary, error)
 	AddViewForBanner(ctx context.Context, bannerID, slotID, socialID int64) error
 	AddClickForBanner(ctx context.Context, bannerID, slotID, socialID int64) error
+}
+
+// StatisticStore - события для сервиса статистики. Есть только у postgres: memory и embedded хранят
+// лишь счетчики ротации, а сервис статистики с ними не запускается.
+type StatisticStore interface {
+	// BannersShowStatisticsFilterByDate и BannersClickStatisticsFilterByDate возвращают события
+	// в полуинтервале [from, to), границы - unix-время в секундах. Нужны backfill, который отправляет события
+	// по одному; отчеты читают агрегаты через ReportStore.
 	BannersShowStatisticsFilterByDate(ctx context.Context, from int64, to int64) ([]BannerStatistic, error)
 	BannersClickStatisticsFilterByDate(ctx context.Context, from int64, to int64) ([]BannerStatistic, error)
+	// AddViewForBanner и AddClickForBanner в той же транзакции пишут событие в outbox,
+	// OutboxEvents возвращает до limit еще не отправленных событий в порядке записи.
+	OutboxEvents(ctx context.Context, limit int) ([]OutboxEvent, error)
+	MarkOutboxSent(ctx context.Context, ids []int64) error
+}
+
+// EventBatchWriter - хранилище, которое умеет записать пачку событий за одну транзакцию.
+// Пишет то же, что AddViewForBanner/AddClickForBanner, но с временем события из BannerEvent.
+type EventBatchWriter interface {
+	AddEvents(ctx context.Context, events []BannerEvent) error
+}
+
+// EventSink - получатель событий статистики (брокер, файлы, вебхук и т.д.).
+type EventSink interface {
+	Publish(ctx context.Context, msg Message) error
+	Close() error
+}
+
+type EventEncoder interface {
+	Encode(event StatisticEvent) (Message, error)
+}
+
+// DeadLetterStore хранит события, которые не удалось закодировать или отправить.
+// DeadLetters возвращает до limit событий в порядке записи, limit <= 0 - все.
+type DeadLetterStore interface {
+	PutDeadLetter(ctx context.Context, letter DeadLetter) error
+	DeadLetters(ctx context.Context, limit int) ([]DeadLetter, error)
+	DeleteDeadLetters(ctx context.Context, ids []int64) error
+}
+
+// EventPartitions создает и удаляет дневные партиции сырых событий.
+type EventPartitions interface {
+	EnsureEventPartitions(ctx context.Context, from time.Time, days int) error
+	DropEventPartitions(ctx context.Context, before time.Time) ([]string, error)
+}
+
+// SentOutbox удаляет отправленные события outbox: строка пишется на каждый показ и клик,
+// поэтому без удаления outbox растет быстрее всех таблиц.
+type SentOutbox interface {
+	DeleteSentOutbox(ctx context.Context, before time.Time) (int64, error)
+}
+
+// ReportStore отдает посчитанные агрегаты статистики для отчетов.
+type ReportStore interface {
+	// ReportRows - строки отчета из агрегатов granularity: фильтры, группировка, сортировка и пагинация q
+	// выполняются в хранилище. total - число строк без пагинации, при q.Limit == 0 возвращаются все строки.
+	ReportRows(ctx context.Context, granularity Granularity, q ReportQuery) (rows []ReportRow, total int, err error)
+	EachBannerRollup(ctx context.Context, granularity Granularity, from, to time.Time, fn func(BannerRollup) error) error
+	RollupWatermark(ctx context.Context, granularity Granularity) (time.Time, bool, error)
+}
+
+// ReportWriter записывает строки выгрузки отчета в файл по мере их получения.
+type ReportWriter interface {
+	WriteRow(row ReportRow) error
+	Close() error
+}
+
+// RollupStore хранит почасовые и дневные агрегаты статистики. Дневные агрегаты считаются из почасовых,
+// почасовые - из сырых событий. Водяной знак - граница, до которой агрегаты уже посчитаны.
+type RollupStore interface {
+	ReportStore
+	RollupEvents(ctx context.Context, granularity Granularity, from, to time.Time) error
+	SetRollupWatermark(ctx context.Context, granularity Granularity, to time.Time) error
+	FirstEventTime(ctx context.Context) (time.Time, bool, error)
+}
+
+// RotatorMetrics - метрики ротации: выбранные баннеры и ошибки записи показов и кликов.
+type RotatorMetrics interface {
+	BannerSelected(slotID, bannerID int64)
+	EventWriteFailed(statType StatType)
+}
+
+// StatisticMetrics - метрики выгрузки статистики. ExportLag - возраст самого старого неотправленного события.
+type StatisticMetrics interface {
+	EventPublished()
+	PublishFailed()
+	ExportLag(lag time.Duration)
 }
 
-type MQProducer interface {
-	Publish(body []byte) error
-	OpenChannel() error
-	CloseChannel() error
-	CloseConn() error
+// BackfillCheckpoint сохраняет прогресс выгрузки исторической статистики между запусками.
+type BackfillCheckpoint interface {
+	Load(ctx context.Context) (BackfillState, bool, error)
+	Save(ctx context.Context, state BackfillState) error
 }
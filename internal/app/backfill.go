@@ -0,0 +1,98 @@
+package app
+
+import (
+	"context"
+	"time"
+)
+
+// Backfill - повторно выгружает все показы и клики из [from, to) окнами по step.
+// После каждого окна прогресс сохраняется в checkpoint, поэтому прерванный запуск
+// с теми же границами продолжается с последнего завершенного окна.
+func (s *Statistic) Backfill(
+	ctx context.Context,
+	from, to time.Time,
+	step time.Duration,
+	checkpoint BackfillCheckpoint,
+	progress func(BackfillState),
+) error {
+	if !from.Before(to) {
+		return newError("backfill range is empty", nil)
+	}
+	if step < time.Second || step%time.Second != 0 {
+		return newError("backfill step must be a whole number of seconds", nil)
+	}
+
+	state := BackfillState{From: from, To: to, Done: from}
+	saved, ok, err := checkpoint.Load(ctx)
+	if err != nil {
+		return newError("can't load backfill checkpoint", err)
+	}
+	if ok && saved.From.Equal(from) && saved.To.Equal(to) {
+		state = saved
+		s.log.Info("resuming backfill", s.log.String("done", state.Done.Format(time.RFC3339)))
+	}
+
+	for state.Done.Before(to) {
+		if err := ctx.Err(); err != nil {
+			return newError("backfill interrupted", err)
+		}
+
+		windowEnd := state.Done.Add(step)
+		if windowEnd.After(to) {
+			windowEnd = to
+		}
+
+		published, err := s.exportWindow(ctx, state.Done, windowEnd)
+		if err != nil {
+			return err
+		}
+
+		state.Done = windowEnd
+		state.Published += published
+		if err := checkpoint.Save(ctx, state); err != nil {
+			return newError("can't save backfill checkpoint", err)
+		}
+		if progress != nil {
+			progress(state)
+		}
+	}
+
+	return nil
+}
+
+// Percent - доля выгруженного диапазона в процентах.
+func (b BackfillState) Percent() float64 {
+	total := b.To.Sub(b.From)
+	if total <= 0 {
+		return 100
+	}
+	return float64(b.Done.Sub(b.From)) / float64(total) * 100
+}
+
+func (s *Statistic) exportWindow(ctx context.Context, from, to time.Time) (int64, error) {
+	shows, err := s.storage.BannersShowStatisticsFilterByDate(ctx, from.Unix(), to.Unix())
+	if err != nil {
+		return 0, newError("can't get shows", err)
+	}
+
+	clicks, err := s.storage.BannersClickStatisticsFilterByDate(ctx, from.Unix(), to.Unix())
+	if err != nil {
+		return 0, newError("can't get clicks", err)
+	}
+
+	var published int64
+	for _, show := range shows {
+		if err := s.publish(ctx, NewStatisticEvent(StatTypeShow, show)); err != nil {
+			return published, err
+		}
+		published++
+	}
+	for _, click := range clicks {
+		if err := s.publish(ctx, NewStatisticEvent(StatTypeClick, click)); err != nil {
+			return published, err
+		}
+		published++
+	}
+
+	return published, nil
+}
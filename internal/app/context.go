@@ -0,0 +1,33 @@
+package app
+
+import "context"
+
+type ctxKey string
+
+const (
+	requestIDKey  ctxKey = "request_id"
+	freshReadsKey ctxKey = "fresh_reads"
+)
+
+// WithRequestID - контекст с идентификатором запроса. Logger.WithContext добавляет его в каждую запись.
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, requestIDKey, requestID)
+}
+
+// RequestID - идентификатор запроса из ctx, пустая строка вне запроса.
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey).(string)
+	return id
+}
+
+// WithFreshReads - чтения с ctx должны видеть только что сделанные записи: хранилища с репликами
+// выполняют их на primary, а не на отстающей реплике.
+func WithFreshReads(ctx context.Context) context.Context {
+	return context.WithValue(ctx, freshReadsKey, true)
+}
+
+// FreshReads - нужно ли читать с primary.
+func FreshReads(ctx context.Context) bool {
+	fresh, _ := ctx.Value(freshReadsKey).(bool)
+	return fresh
+}
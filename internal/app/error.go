@@ -1,13 +1,36 @@
 package app
 
+import (
+	"context"
+	"errors"
+)
+
+// ErrorCode - устойчивый машиночитаемый вид ошибки, по нему клиенты API различают ошибки,
+// не разбирая текст сообщения.
+type ErrorCode string
+
+const (
+	CodeNotFound    ErrorCode = "not_found"
+	CodeValidation  ErrorCode = "validation"
+	CodeConflict    ErrorCode = "conflict"
+	CodeUnavailable ErrorCode = "unavailable"
+	CodeInternal    ErrorCode = "internal"
+)
+
+// ErrNotFound - errors.Is(err, ErrNotFound) верно для любой ошибки с кодом CodeNotFound в цепочке,
+// поэтому хранилища объявляют свои ошибки с кодом, не оборачивая эту.
+var ErrNotFound = &BaseError{Message: "not found", Code: CodeNotFound}
+
+// BaseError - Code задает вид ошибки, пустой Code - вид определяется обернутой ошибкой.
 type BaseError struct {
-	Message string `json:"message"`
-	Err     error  `json:"err,omitempty"`
+	Message string    `json:"message"`
+	Err     error     `json:"err,omitempty"`
+	Code    ErrorCode `json:"code,omitempty"`
 }
 
 func (e *BaseError) Error() string {
 	if e.Err != nil {
-		e.Message = e.Message + " --> " + e.Err.Error()
+		return e.Message + " --> " + e.Err.Error()
 	}
 	return e.Message
 }
@@ -15,3 +38,26 @@ func (e *BaseError) Error() string {
 func (e *BaseError) Unwrap() error {
 	return e.Err
 }
+
+// Is - любая ошибка с кодом CodeNotFound совпадает с ErrNotFound.
+func (e *BaseError) Is(target error) bool {
+	return target == ErrNotFound && e.Code == CodeNotFound // nolint: errorlint
+}
+
+func (e *BaseError) ErrorCode() ErrorCode {
+	return e.Code
+}
+
+// CodeOf - код первой ошибки с кодом в цепочке err, внешняя ошибка может переопределить вид внутренней.
+// Истекший таймаут - CodeUnavailable, ошибка без кода - CodeInternal.
+func CodeOf(err error) ErrorCode {
+	for e := err; e != nil; e = errors.Unwrap(e) {
+		if coded, ok := e.(interface{ ErrorCode() ErrorCode }); ok && coded.ErrorCode() != "" { // nolint: errorlint
+			return coded.ErrorCode()
+		}
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return CodeUnavailable
+	}
+	return CodeInternal
+}
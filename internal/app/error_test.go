@@ -0,0 +1,46 @@
+package app_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/nsmak/bannersRotation/internal/app"
+	"github.com/nsmak/bannersRotation/internal/storage"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCodeOf(t *testing.T) {
+	tests := []struct {
+		err  error
+		code app.ErrorCode
+	}{
+		{err: storage.NewError("can't get statistics", storage.ErrObjectNotFound), code: app.CodeNotFound},
+		{err: storage.NewError("can't add banner into slot", storage.ErrAlreadyExists), code: app.CodeConflict},
+		{err: fmt.Errorf("report: %w", app.ErrInvalidReportQuery), code: app.CodeValidation},
+		{err: storage.NewError("can't get statistics", context.DeadlineExceeded), code: app.CodeUnavailable},
+		{err: storage.NewError("can't get statistics", errors.New("connection refused")), code: app.CodeInternal},
+		{err: &app.BaseError{Message: "overridden", Code: app.CodeConflict, Err: storage.ErrObjectNotFound}, code: app.CodeConflict},
+	}
+
+	for _, tt := range tests {
+		require.Equal(t, tt.code, app.CodeOf(tt.err), tt.err.Error())
+	}
+}
+
+func TestErrorIsKind(t *testing.T) {
+	err := storage.NewError("can't add banner into slot", storage.ErrObjectNotFound)
+
+	require.ErrorIs(t, err, app.ErrNotFound)
+	require.ErrorIs(t, err, storage.ErrObjectNotFound)
+	require.False(t, errors.Is(storage.NewError("can't add banner into slot", storage.ErrAlreadyExists), app.ErrNotFound))
+	require.False(t, errors.Is(storage.ErrObjectNotFound, storage.ErrAlreadyExists))
+}
+
+func TestErrorMessageIsStable(t *testing.T) {
+	err := storage.NewError("can't add banner into slot", storage.ErrObjectNotFound)
+
+	require.Equal(t, "can't add banner into slot --> object not found", err.Error())
+	require.Equal(t, err.Error(), err.Error())
+}
@@ -0,0 +1,71 @@
+package app
+
+import (
+	"sync"
+)
+
+// Сколько обновлений ждет медленного подписчика. Обновление несет счетчики целиком,
+// поэтому при переполнении новые обновления отбрасываются: следующее все равно их заменит.
+const liveBufferSize = 64
+
+type liveSubscriber struct {
+	slotID int64
+	ch     chan SlotUpdate
+}
+
+// liveHub - рассылает обновления счетчиков слотов подписчикам.
+type liveHub struct {
+	mu   sync.RWMutex
+	subs map[*liveSubscriber]struct{}
+}
+
+func newLiveHub() *liveHub {
+	return &liveHub{subs: make(map[*liveSubscriber]struct{})}
+}
+
+// subscribe - подписка на обновления слота slotID, 0 - на все слоты. cancel закрывает канал.
+func (h *liveHub) subscribe(slotID int64) (updates <-chan SlotUpdate, cancel func()) {
+	sub := &liveSubscriber{slotID: slotID, ch: make(chan SlotUpdate, liveBufferSize)}
+
+	h.mu.Lock()
+	h.subs[sub] = struct{}{}
+	h.mu.Unlock()
+
+	var once sync.Once
+	return sub.ch, func() {
+		once.Do(func() {
+			h.mu.Lock()
+			delete(h.subs, sub)
+			h.mu.Unlock()
+			close(sub.ch)
+		})
+	}
+}
+
+// watched - есть ли подписчики на слот. Без них обновления не собираются, чтобы не нагружать хранилище.
+func (h *liveHub) watched(slotID int64) bool {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	for sub := range h.subs {
+		if sub.slotID == 0 || sub.slotID == slotID {
+			return true
+		}
+	}
+	return false
+}
+
+func (h *liveHub) publish(update SlotUpdate) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	for sub := range h.subs {
+		if sub.slotID != 0 && sub.slotID != update.SlotID {
+			continue
+		}
+		select {
+		case sub.ch <- update:
+		default:
+		}
+	}
+}
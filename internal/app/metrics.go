@@ -0,0 +1,12 @@
+package app
+
+import "time"
+
+// nopMetrics - метрики по умолчанию, когда сервис запущен без них.
+type nopMetrics struct{}
+
+func (nopMetrics) BannerSelected(int64, int64) {}
+func (nopMetrics) EventWriteFailed(StatType)   {}
+func (nopMetrics) EventPublished()             {}
+func (nopMetrics) PublishFailed()              {}
+func (nopMetrics) ExportLag(time.Duration)     {}
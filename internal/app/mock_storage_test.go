@@ -1,5 +1,5 @@
 // Code generated by MockGen. DO NOT EDIT.
-// Source: github.com/nsmak/bannersRotation/internal/app (interfaces: Storage)
+// Source: github.com/nsmak/bannersRotation/internal/app (interfaces: Storage,StatisticStore)
 
 // Package app_test is a generated GoMock package.
 package app_test
@@ -76,8 +76,60 @@ func (mr *MockStorageMockRecorder) AddViewForBanner(arg0, arg1, arg2, arg3 inter
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddViewForBanner", reflect.TypeOf((*MockStorage)(nil).AddViewForBanner), arg0, arg1, arg2, arg3)
 }
 
+// BannersStatistics mocks base method
+func (m *MockStorage) BannersStatistics(arg0 context.Context, arg1, arg2 int64) ([]app.BannerSummary, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "BannersStatistics", arg0, arg1, arg2)
+	ret0, _ := ret[0].([]app.BannerSummary)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// BannersStatistics indicates an expected call of BannersStatistics
+func (mr *MockStorageMockRecorder) BannersStatistics(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "BannersStatistics", reflect.TypeOf((*MockStorage)(nil).BannersStatistics), arg0, arg1, arg2)
+}
+
+// RemoveBannerFromSlot mocks base method
+func (m *MockStorage) RemoveBannerFromSlot(arg0 context.Context, arg1, arg2 int64) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RemoveBannerFromSlot", arg0, arg1, arg2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RemoveBannerFromSlot indicates an expected call of RemoveBannerFromSlot
+func (mr *MockStorageMockRecorder) RemoveBannerFromSlot(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RemoveBannerFromSlot", reflect.TypeOf((*MockStorage)(nil).RemoveBannerFromSlot), arg0, arg1, arg2)
+}
+
+// MockStatisticStore is a mock of StatisticStore interface
+type MockStatisticStore struct {
+	ctrl     *gomock.Controller
+	recorder *MockStatisticStoreMockRecorder
+}
+
+// MockStatisticStoreMockRecorder is the mock recorder for MockStatisticStore
+type MockStatisticStoreMockRecorder struct {
+	mock *MockStatisticStore
+}
+
+// NewMockStatisticStore creates a new mock instance
+func NewMockStatisticStore(ctrl *gomock.Controller) *MockStatisticStore {
+	mock := &MockStatisticStore{ctrl: ctrl}
+	mock.recorder = &MockStatisticStoreMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use
+func (m *MockStatisticStore) EXPECT() *MockStatisticStoreMockRecorder {
+	return m.recorder
+}
+
 // BannersClickStatisticsFilterByDate mocks base method
-func (m *MockStorage) BannersClickStatisticsFilterByDate(arg0 context.Context, arg1, arg2 int64) ([]app.BannerStatistic, error) {
+func (m *MockStatisticStore) BannersClickStatisticsFilterByDate(arg0 context.Context, arg1, arg2 int64) ([]app.BannerStatistic, error) {
 	m.ctrl.T.Helper()
 	ret := m.ctrl.Call(m, "BannersClickStatisticsFilterByDate", arg0, arg1, arg2)
 	ret0, _ := ret[0].([]app.BannerStatistic)
@@ -86,13 +138,13 @@ func (m *MockStorage) BannersClickStatisticsFilterByDate(arg0 context.Context, a
 }
 
 // BannersClickStatisticsFilterByDate indicates an expected call of BannersClickStatisticsFilterByDate
-func (mr *MockStorageMockRecorder) BannersClickStatisticsFilterByDate(arg0, arg1, arg2 interface{}) *gomock.Call {
+func (mr *MockStatisticStoreMockRecorder) BannersClickStatisticsFilterByDate(arg0, arg1, arg2 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "BannersClickStatisticsFilterByDate", reflect.TypeOf((*MockStorage)(nil).BannersClickStatisticsFilterByDate), arg0, arg1, arg2)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "BannersClickStatisticsFilterByDate", reflect.TypeOf((*MockStatisticStore)(nil).BannersClickStatisticsFilterByDate), arg0, arg1, arg2)
 }
 
 // BannersShowStatisticsFilterByDate mocks base method
-func (m *MockStorage) BannersShowStatisticsFilterByDate(arg0 context.Context, arg1, arg2 int64) ([]app.BannerStatistic, error) {
+func (m *MockStatisticStore) BannersShowStatisticsFilterByDate(arg0 context.Context, arg1, arg2 int64) ([]app.BannerStatistic, error) {
 	m.ctrl.T.Helper()
 	ret := m.ctrl.Call(m, "BannersShowStatisticsFilterByDate", arg0, arg1, arg2)
 	ret0, _ := ret[0].([]app.BannerStatistic)
@@ -101,36 +153,36 @@ func (m *MockStorage) BannersShowStatisticsFilterByDate(arg0 context.Context, ar
 }
 
 // BannersShowStatisticsFilterByDate indicates an expected call of BannersShowStatisticsFilterByDate
-func (mr *MockStorageMockRecorder) BannersShowStatisticsFilterByDate(arg0, arg1, arg2 interface{}) *gomock.Call {
+func (mr *MockStatisticStoreMockRecorder) BannersShowStatisticsFilterByDate(arg0, arg1, arg2 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "BannersShowStatisticsFilterByDate", reflect.TypeOf((*MockStorage)(nil).BannersShowStatisticsFilterByDate), arg0, arg1, arg2)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "BannersShowStatisticsFilterByDate", reflect.TypeOf((*MockStatisticStore)(nil).BannersShowStatisticsFilterByDate), arg0, arg1, arg2)
 }
 
-// BannersStatistics mocks base method
-func (m *MockStorage) BannersStatistics(arg0 context.Context, arg1, arg2 int64) ([]app.BannerSummary, error) {
+// MarkOutboxSent mocks base method
+func (m *MockStatisticStore) MarkOutboxSent(arg0 context.Context, arg1 []int64) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "BannersStatistics", arg0, arg1, arg2)
-	ret0, _ := ret[0].([]app.BannerSummary)
-	ret1, _ := ret[1].(error)
-	return ret0, ret1
+	ret := m.ctrl.Call(m, "MarkOutboxSent", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
 }
 
-// BannersStatistics indicates an expected call of BannersStatistics
-func (mr *MockStorageMockRecorder) BannersStatistics(arg0, arg1, arg2 interface{}) *gomock.Call {
+// MarkOutboxSent indicates an expected call of MarkOutboxSent
+func (mr *MockStatisticStoreMockRecorder) MarkOutboxSent(arg0, arg1 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "BannersStatistics", reflect.TypeOf((*MockStorage)(nil).BannersStatistics), arg0, arg1, arg2)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "MarkOutboxSent", reflect.TypeOf((*MockStatisticStore)(nil).MarkOutboxSent), arg0, arg1)
 }
 
-// RemoveBannerFromSlot mocks base method
-func (m *MockStorage) RemoveBannerFromSlot(arg0 context.Context, arg1, arg2 int64) error {
+// OutboxEvents mocks base method
+func (m *MockStatisticStore) OutboxEvents(arg0 context.Context, arg1 int) ([]app.OutboxEvent, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "RemoveBannerFromSlot", arg0, arg1, arg2)
-	ret0, _ := ret[0].(error)
-	return ret0
+	ret := m.ctrl.Call(m, "OutboxEvents", arg0, arg1)
+	ret0, _ := ret[0].([]app.OutboxEvent)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
 }
 
-// RemoveBannerFromSlot indicates an expected call of RemoveBannerFromSlot
-func (mr *MockStorageMockRecorder) RemoveBannerFromSlot(arg0, arg1, arg2 interface{}) *gomock.Call {
+// OutboxEvents indicates an expected call of OutboxEvents
+func (mr *MockStatisticStoreMockRecorder) OutboxEvents(arg0, arg1 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RemoveBannerFromSlot", reflect.TypeOf((*MockStorage)(nil).RemoveBannerFromSlot), arg0, arg1, arg2)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "OutboxEvents", reflect.TypeOf((*MockStatisticStore)(nil).OutboxEvents), arg0, arg1)
 }
@@ -1,5 +1,17 @@
 package app
 
+import (
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// StatisticEventSchemaVersion - текущая версия схемы событий статистики.
+const StatisticEventSchemaVersion = 1
+
+var eventNamespace = uuid.MustParse("0f6a2a1e-3b8e-4c1a-9d57-7d1f6b1f0c2e")
+
 type Slot struct {
 	ID          int64  `json:"id"`
 	Description string `json:"description"`
@@ -23,7 +35,19 @@ type BannerSummary struct {
 	ClickCount int64 `db:"click_count"`
 }
 
+// SlotUpdate - счетчики баннеров слота в соцгруппе сразу после показа или клика.
+// Leader - баннер, который бандит выбрал бы следующим, 0 если в слоте нет баннеров.
+type SlotUpdate struct {
+	SlotID   int64
+	SocialID int64
+	Banners  []BannerSummary
+	Leader   int64
+	At       time.Time
+}
+
+// BannerStatistic - показ или клик баннера. EventID - id строки события в хранилище.
 type BannerStatistic struct {
+	EventID  int64   `db:"event_id"`
 	BannerID int64   `db:"banner_id"`
 	SlotID   int64   `db:"slot_id"`
 	SocialID int64   `db:"social_id"`
@@ -32,20 +56,126 @@ type BannerStatistic struct {
 
 type StatType string
 
-type MQBannerStatistic struct {
-	Type     StatType
-	BannerID int64
-	SlotID   int64
-	SocialID int64
-	Date     float64
+const (
+	StatTypeShow  StatType = "show"
+	StatTypeClick StatType = "click"
+)
+
+// BannerEvent - показ или клик баннера, записываемый в хранилище.
+// TraceParent - W3C traceparent, RequestID - идентификатор запроса, в котором произошло событие.
+type BannerEvent struct {
+	Type        StatType
+	BannerID    int64
+	SlotID      int64
+	SocialID    int64
+	OccurredAt  time.Time
+	TraceParent string
+	RequestID   string
+}
+
+// OutboxEvent - событие из outbox, ожидающее отправки сервисом статистики. TraceParent - W3C traceparent
+// запроса, записавшего событие, по нему публикация продолжает трассировку запроса.
+type OutboxEvent struct {
+	ID          int64    `db:"id"`
+	Type        StatType `db:"type"`
+	TraceParent string   `db:"trace_parent"`
+	BannerStatistic
 }
 
-func NewMQBannerStatistic(statType StatType, stat BannerStatistic) MQBannerStatistic {
-	return MQBannerStatistic{
-		Type:     statType,
-		BannerID: stat.BannerID,
-		SlotID:   stat.SlotID,
-		SocialID: stat.SocialID,
-		Date:     stat.Date,
+// StatisticEvent - версионированный конверт события статистики, который уходит во внешние системы.
+type StatisticEvent struct {
+	ID            string
+	SchemaVersion int32
+	Type          StatType
+	OccurredAt    time.Time
+	BannerID      int64
+	SlotID        int64
+	SocialID      int64
+}
+
+// NewStatisticEvent - создает событие из строки статистики. ID события строится из типа и EventID:
+// повторная выгрузка той же строки (backfill, повтор после сбоя) дает тот же ID,
+// и получатели могут отбросить дубликаты.
+func NewStatisticEvent(statType StatType, stat BannerStatistic) StatisticEvent {
+	sec, frac := splitEpoch(stat.Date)
+	occurredAt := time.Unix(sec, frac).UTC()
+	name := fmt.Sprintf("%s/%d", statType, stat.EventID)
+	return StatisticEvent{
+		ID:            uuid.NewSHA1(eventNamespace, []byte(name)).String(),
+		SchemaVersion: StatisticEventSchemaVersion,
+		Type:          statType,
+		OccurredAt:    occurredAt,
+		BannerID:      stat.BannerID,
+		SlotID:        stat.SlotID,
+		SocialID:      stat.SocialID,
 	}
 }
+
+type DeadLetter struct {
+	ID       int64
+	Event    StatisticEvent
+	Reason   string
+	FailedAt time.Time
+}
+
+// BackfillState - прогресс выгрузки: события в [From, Done) уже отправлены.
+type BackfillState struct {
+	From      time.Time `json:"from"`
+	To        time.Time `json:"to"`
+	Done      time.Time `json:"done"`
+	Published int64     `json:"published"`
+}
+
+// Granularity - размер интервала агрегатов статистики.
+type Granularity string
+
+const (
+	GranularityHour Granularity = "hour"
+	GranularityDay  Granularity = "day"
+	// GranularityWeek - неделя с понедельника, есть только в отчетах и собирается из дневных агрегатов.
+	GranularityWeek Granularity = "week"
+)
+
+// Duration - длина интервала агрегата.
+func (g Granularity) Duration() time.Duration {
+	switch g {
+	case GranularityDay:
+		return 24 * time.Hour
+	case GranularityWeek:
+		return 7 * 24 * time.Hour
+	default:
+		return time.Hour
+	}
+}
+
+// BannerRollup - показы и клики баннера в слоте и группе за один интервал, начинающийся в Bucket (UTC).
+type BannerRollup struct {
+	Bucket   time.Time `db:"bucket"`
+	BannerID int64     `db:"banner_id"`
+	SlotID   int64     `db:"slot_id"`
+	SocialID int64     `db:"social_id"`
+	Shows    int64     `db:"shows"`
+	Clicks   int64     `db:"clicks"`
+}
+
+// CTR - доля кликов от показов.
+func (r BannerRollup) CTR() float64 {
+	if r.Shows == 0 {
+		return 0
+	}
+	return float64(r.Clicks) / float64(r.Shows)
+}
+
+// Message - закодированное событие, готовое к отправке.
+type Message struct {
+	ID          string
+	ContentType string
+	Body        []byte
+}
+
+func splitEpoch(epoch float64) (sec int64, nsec int64) {
+	sec = int64(epoch)
+	// Postgres хранит время с точностью до микросекунд, лишние знаки - шум float64.
+	usec := int64((epoch-float64(sec))*1e6 + 0.5)
+	return sec, usec * int64(time.Microsecond)
+}
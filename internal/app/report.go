@@ -0,0 +1,429 @@
+package app
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/nsmak/bannersRotation/internal/utils"
+)
+
+const (
+	defaultReportLimit = 100
+	maxReportLimit     = 1000
+)
+
+// DefaultReportConfidence - уровень доверия интервалов CTR и сравнений баннеров по умолчанию.
+const DefaultReportConfidence = 0.95
+
+// ErrInvalidReportQuery - запрос отчета не прошел проверку.
+var ErrInvalidReportQuery = &domainError{BaseError: BaseError{Message: "invalid report query", Code: CodeValidation}}
+
+// ReportDimension - поле, по которому группируются строки отчета.
+type ReportDimension string
+
+const (
+	ReportByBanner ReportDimension = "banner"
+	ReportBySlot   ReportDimension = "slot"
+	ReportBySocial ReportDimension = "social"
+	ReportByBucket ReportDimension = "bucket"
+)
+
+// Поля сортировки отчета. Перед именем можно поставить "-" для сортировки по убыванию.
+const (
+	ReportSortBucket   = "bucket"
+	ReportSortBanner   = "banner_id"
+	ReportSortSlot     = "slot_id"
+	ReportSortSocial   = "social_id"
+	ReportSortShows    = "shows"
+	ReportSortClicks   = "clicks"
+	ReportSortCTR      = "ctr"
+	reportSortDescMark = "-"
+)
+
+// ReportQuery - параметры отчета за [From, To). Нулевые BannerID, SlotID и SocialID не фильтруют строки.
+// Compare добавляет к отчету попарные сравнения CTR баннеров, для него нужна группировка по баннеру.
+type ReportQuery struct {
+	From       time.Time
+	To         time.Time
+	GroupBy    []ReportDimension
+	Bucket     Granularity
+	BannerID   int64
+	SlotID     int64
+	SocialID   int64
+	Sort       string
+	Limit      int
+	Offset     int
+	Confidence float64
+	Compare    bool
+}
+
+// GroupedBy - есть ли dim в группировке отчета.
+func (q ReportQuery) GroupedBy(dim ReportDimension) bool {
+	for _, d := range q.GroupBy {
+		if d == dim {
+			return true
+		}
+	}
+	return false
+}
+
+// SortField - поле сортировки без признака убывания, пустое - порядок по умолчанию.
+func (q ReportQuery) SortField() (field string, desc bool) {
+	field = strings.TrimPrefix(q.Sort, reportSortDescMark)
+	return field, field != q.Sort
+}
+
+// ReportRow - строка отчета. Поля, по которым нет группировки, нулевые.
+type ReportRow struct {
+	Bucket   time.Time
+	BannerID int64
+	SlotID   int64
+	SocialID int64
+	Shows    int64
+	Clicks   int64
+}
+
+// CTR - доля кликов от показов.
+func (r ReportRow) CTR() float64 {
+	if r.Shows == 0 {
+		return 0
+	}
+	return float64(r.Clicks) / float64(r.Shows)
+}
+
+// CTRInterval - доверительный интервал Уилсона для CTR. На малом числе показов он широкий,
+// и разница в CTR между строками может быть шумом.
+func (r ReportRow) CTRInterval(confidence float64) (low, high float64) {
+	return utils.WilsonInterval(r.Clicks, r.Shows, confidence)
+}
+
+// BannerComparison - z-тест разницы CTR двух баннеров в одной группе строк отчета
+// (совпадают интервал, слот и соцгруппа, если по ним есть группировка). Баннер A - с меньшим ID.
+// Significant - разница значима на уровне доверия отчета с поправкой Бонферрони на число пар в группе,
+// Winner - баннер с большим CTR, если разница значима, иначе 0.
+type BannerComparison struct {
+	Bucket      time.Time
+	SlotID      int64
+	SocialID    int64
+	BannerA     int64
+	BannerB     int64
+	Z           float64
+	PValue      float64
+	Significant bool
+	Winner      int64
+}
+
+// Report - страница отчета. Total - число строк без учета пагинации,
+// CompleteUntil - до какого момента агрегаты уже посчитаны, более поздние данные в отчет не попали.
+// Comparisons считаются по всем строкам, а не только по странице.
+type Report struct {
+	Rows          []ReportRow
+	Total         int
+	CompleteUntil time.Time
+	Confidence    float64
+	Comparisons   []BannerComparison
+}
+
+// ReportDomain строит отчеты по показам, кликам и CTR из агрегатов статистики.
+type ReportDomain struct {
+	store ReportStore
+	log   Logger
+}
+
+// NewReports - возвращает новый инстанс домена отчетов.
+func NewReports(s ReportStore, l Logger) *ReportDomain {
+	return &ReportDomain{store: s, log: l}
+}
+
+// Report - считает отчет. Для часовых интервалов и периодов, не выровненных по суткам (UTC),
+// используются почасовые агрегаты, иначе - дневные. Строки группирует, сортирует и делит на страницы хранилище,
+// для сравнений баннеров читаются все строки отчета.
+func (d *ReportDomain) Report(ctx context.Context, q ReportQuery) (Report, error) {
+	if err := normalizeReportQuery(&q); err != nil {
+		return Report{}, err
+	}
+
+	source := reportSource(q)
+	rows, total, err := d.store.ReportRows(ctx, source, q)
+	if err != nil {
+		d.log.WithContext(ctx).Error("can't get report rows", d.log.String("msg", err.Error()))
+		return Report{}, newError("report error", err)
+	}
+
+	watermark, _, err := d.store.RollupWatermark(ctx, source)
+	if err != nil {
+		d.log.WithContext(ctx).Error("can't get rollup watermark for report", d.log.String("msg", err.Error()))
+		return Report{}, newError("report error", err)
+	}
+
+	report := Report{Rows: rows, Total: total, CompleteUntil: watermark, Confidence: q.Confidence}
+	if q.Compare {
+		all := q
+		all.Sort, all.Limit, all.Offset = "", 0, 0
+		allRows, _, err := d.store.ReportRows(ctx, source, all)
+		if err != nil {
+			d.log.WithContext(ctx).Error("can't get report rows for comparisons", d.log.String("msg", err.Error()))
+			return Report{}, newError("report error", err)
+		}
+		report.Comparisons = compareBanners(allRows, q.Confidence)
+	}
+	if report.Rows == nil {
+		report.Rows = []ReportRow{}
+	}
+
+	return report, nil
+}
+
+// Export - выгружает все строки отчета в w по мере чтения агрегатов, сортировка и пагинация не применяются.
+// Строки упорядочены по интервалу, баннеру, слоту и группе. При группировке по интервалу в памяти держатся
+// только строки текущего интервала. Закрывать w - задача вызывающего.
+func (d *ReportDomain) Export(ctx context.Context, q ReportQuery, w ReportWriter) error {
+	if err := normalizeReportQuery(&q); err != nil {
+		return err
+	}
+
+	grouper := newReportGrouper(q)
+	flush := func() error {
+		rows := grouper.rows
+		grouper.reset()
+		sort.Slice(rows, func(i, j int) bool {
+			return reportKeyLess(rows[i], rows[j])
+		})
+		for _, row := range rows {
+			if err := w.WriteRow(row); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	var current time.Time
+	err := d.store.EachBannerRollup(ctx, reportSource(q), q.From, q.To, func(r BannerRollup) error {
+		if bucket := grouper.bucket(r); grouper.byBucket && !bucket.Equal(current) {
+			if err := flush(); err != nil {
+				return err
+			}
+			current = bucket
+		}
+		grouper.add(r)
+		return nil
+	})
+	if err == nil {
+		err = flush()
+	}
+	if err != nil {
+		d.log.WithContext(ctx).Error("can't export report", d.log.String("msg", err.Error()))
+		return newError("export error", err)
+	}
+
+	return nil
+}
+
+// reportSource - для часовых интервалов и периодов, не выровненных по суткам (UTC), нужны почасовые агрегаты.
+func reportSource(q ReportQuery) Granularity {
+	if q.Bucket == GranularityHour || !isDayAligned(q.From) || !isDayAligned(q.To) {
+		return GranularityHour
+	}
+	return GranularityDay
+}
+
+func normalizeReportQuery(q *ReportQuery) error {
+	q.From, q.To = q.From.UTC(), q.To.UTC()
+	if !q.From.Before(q.To) {
+		return newError("report range is empty", ErrInvalidReportQuery)
+	}
+	// Мельче часа агрегатов нет: неполный час на границе молча выпал бы из отчета или попал в него целиком.
+	if !isHourAligned(q.From) || !isHourAligned(q.To) {
+		return newError("report range must start and end on a whole hour", ErrInvalidReportQuery)
+	}
+
+	switch q.Bucket {
+	case "":
+		q.Bucket = GranularityDay
+	case GranularityHour, GranularityDay, GranularityWeek:
+	default:
+		return newError("unknown bucket "+string(q.Bucket), ErrInvalidReportQuery)
+	}
+
+	seen := make(map[ReportDimension]bool, len(q.GroupBy))
+	for _, dim := range q.GroupBy {
+		switch dim {
+		case ReportByBanner, ReportBySlot, ReportBySocial, ReportByBucket:
+		default:
+			return newError("unknown group by "+string(dim), ErrInvalidReportQuery)
+		}
+		if seen[dim] {
+			return newError("duplicate group by "+string(dim), ErrInvalidReportQuery)
+		}
+		seen[dim] = true
+	}
+
+	switch {
+	case q.Confidence == 0:
+		q.Confidence = DefaultReportConfidence
+	case q.Confidence <= 0 || q.Confidence >= 1:
+		return newError("confidence must be between 0 and 1", ErrInvalidReportQuery)
+	}
+	if q.Compare && !seen[ReportByBanner] {
+		return newError("comparison requires group by banner", ErrInvalidReportQuery)
+	}
+
+	if q.Sort != "" {
+		switch field, _ := q.SortField(); field {
+		case ReportSortBucket, ReportSortBanner, ReportSortSlot, ReportSortSocial,
+			ReportSortShows, ReportSortClicks, ReportSortCTR:
+		default:
+			return newError("unknown sort field "+field, ErrInvalidReportQuery)
+		}
+	}
+
+	if q.Limit < 0 || q.Offset < 0 {
+		return newError("limit and offset must not be negative", ErrInvalidReportQuery)
+	}
+	if q.Limit == 0 {
+		q.Limit = defaultReportLimit
+	}
+	if q.Limit > maxReportLimit {
+		q.Limit = maxReportLimit
+	}
+
+	return nil
+}
+
+// reportGrouper - суммирует агрегаты в строки выгрузки с учетом фильтров и группировки.
+type reportGrouper struct {
+	query                                ReportQuery
+	byBanner, bySlot, bySocial, byBucket bool
+	index                                map[ReportRow]int
+	rows                                 []ReportRow
+}
+
+func newReportGrouper(q ReportQuery) *reportGrouper {
+	return &reportGrouper{
+		query:    q,
+		byBanner: q.GroupedBy(ReportByBanner),
+		bySlot:   q.GroupedBy(ReportBySlot),
+		bySocial: q.GroupedBy(ReportBySocial),
+		byBucket: q.GroupedBy(ReportByBucket),
+		index:    make(map[ReportRow]int),
+	}
+}
+
+// bucket - начало интервала отчета, в который попадает агрегат.
+// Нулевое время Go - понедельник, поэтому недели выравниваются по понедельникам.
+func (g *reportGrouper) bucket(r BannerRollup) time.Time {
+	return r.Bucket.UTC().Truncate(g.query.Bucket.Duration())
+}
+
+func (g *reportGrouper) add(r BannerRollup) {
+	q := g.query
+	if (q.BannerID != 0 && r.BannerID != q.BannerID) ||
+		(q.SlotID != 0 && r.SlotID != q.SlotID) ||
+		(q.SocialID != 0 && r.SocialID != q.SocialID) {
+		return
+	}
+
+	var key ReportRow
+	if g.byBanner {
+		key.BannerID = r.BannerID
+	}
+	if g.bySlot {
+		key.SlotID = r.SlotID
+	}
+	if g.bySocial {
+		key.SocialID = r.SocialID
+	}
+	if g.byBucket {
+		key.Bucket = g.bucket(r)
+	}
+
+	i, ok := g.index[key]
+	if !ok {
+		i = len(g.rows)
+		g.index[key] = i
+		g.rows = append(g.rows, key)
+	}
+	g.rows[i].Shows += r.Shows
+	g.rows[i].Clicks += r.Clicks
+}
+
+func (g *reportGrouper) reset() {
+	g.index = make(map[ReportRow]int)
+	g.rows = nil
+}
+
+// compareBanners - попарно сравнивает баннеры внутри групп строк с одинаковыми интервалом, слотом и соцгруппой.
+func compareBanners(rows []ReportRow, confidence float64) []BannerComparison {
+	groups := make(map[ReportRow][]ReportRow)
+	var keys []ReportRow
+	for _, row := range rows {
+		key := ReportRow{Bucket: row.Bucket, SlotID: row.SlotID, SocialID: row.SocialID}
+		if _, ok := groups[key]; !ok {
+			keys = append(keys, key)
+		}
+		groups[key] = append(groups[key], row)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return reportKeyLess(keys[i], keys[j])
+	})
+
+	var comparisons []BannerComparison
+	for _, key := range keys {
+		banners := groups[key]
+		sort.Slice(banners, func(i, j int) bool {
+			return banners[i].BannerID < banners[j].BannerID
+		})
+
+		pairs := len(banners) * (len(banners) - 1) / 2
+		alpha := (1 - confidence) / float64(pairs)
+		for i := range banners {
+			for j := i + 1; j < len(banners); j++ {
+				a, b := banners[i], banners[j]
+				z, p := utils.TwoProportionZTest(a.Clicks, a.Shows, b.Clicks, b.Shows)
+				c := BannerComparison{
+					Bucket:      key.Bucket,
+					SlotID:      key.SlotID,
+					SocialID:    key.SocialID,
+					BannerA:     a.BannerID,
+					BannerB:     b.BannerID,
+					Z:           z,
+					PValue:      p,
+					Significant: p < alpha,
+				}
+				if c.Significant {
+					c.Winner = a.BannerID
+					if z < 0 {
+						c.Winner = b.BannerID
+					}
+				}
+				comparisons = append(comparisons, c)
+			}
+		}
+	}
+
+	return comparisons
+}
+
+// reportKeyLess - порядок строк по умолчанию и для равных значений: по интервалу, баннеру, слоту и группе.
+func reportKeyLess(a, b ReportRow) bool {
+	switch {
+	case !a.Bucket.Equal(b.Bucket):
+		return a.Bucket.Before(b.Bucket)
+	case a.BannerID != b.BannerID:
+		return a.BannerID < b.BannerID
+	case a.SlotID != b.SlotID:
+		return a.SlotID < b.SlotID
+	default:
+		return a.SocialID < b.SocialID
+	}
+}
+
+func isHourAligned(t time.Time) bool {
+	return t.Equal(t.Truncate(time.Hour))
+}
+
+func isDayAligned(t time.Time) bool {
+	return t.Equal(t.Truncate(24 * time.Hour))
+}
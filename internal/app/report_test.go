@@ -0,0 +1,280 @@
+package app_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/nsmak/bannersRotation/internal/app"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeReports - отдает заранее заданные строки отчета: группировку и сортировку делает хранилище,
+// они проверяются в интеграционных тестах. Выгрузка группирует агрегаты сама.
+type fakeReports struct {
+	rollups    map[app.Granularity][]app.BannerRollup
+	rows       []app.ReportRow
+	watermarks map[app.Granularity]time.Time
+	requested  []app.Granularity
+	queries    []app.ReportQuery
+}
+
+func (f *fakeReports) ReportRows(_ context.Context, g app.Granularity, q app.ReportQuery) ([]app.ReportRow, int, error) {
+	f.requested = append(f.requested, g)
+	f.queries = append(f.queries, q)
+	if q.Limit == 0 {
+		return f.rows, len(f.rows), nil
+	}
+	if q.Offset >= len(f.rows) {
+		return nil, len(f.rows), nil
+	}
+	end := q.Offset + q.Limit
+	if end > len(f.rows) {
+		end = len(f.rows)
+	}
+	return f.rows[q.Offset:end], len(f.rows), nil
+}
+
+func (f *fakeReports) EachBannerRollup(
+	_ context.Context,
+	g app.Granularity,
+	from, to time.Time,
+	fn func(app.BannerRollup) error,
+) error {
+	f.requested = append(f.requested, g)
+	for _, r := range f.rollups[g] {
+		if r.Bucket.Before(from) || !r.Bucket.Before(to) {
+			continue
+		}
+		if err := fn(r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (f *fakeReports) RollupWatermark(_ context.Context, g app.Granularity) (time.Time, bool, error) {
+	t, ok := f.watermarks[g]
+	return t, ok, nil
+}
+
+func newFakeReports() *fakeReports {
+	return &fakeReports{
+		rollups: map[app.Granularity][]app.BannerRollup{
+			app.GranularityHour: {
+				{Bucket: date(1, 10, 0), BannerID: 1, SlotID: 1, SocialID: 1, Shows: 10, Clicks: 1},
+				{Bucket: date(1, 11, 0), BannerID: 1, SlotID: 1, SocialID: 2, Shows: 10, Clicks: 3},
+				{Bucket: date(1, 11, 0), BannerID: 2, SlotID: 1, SocialID: 1, Shows: 5, Clicks: 0},
+			},
+			app.GranularityDay: {
+				{Bucket: date(1, 0, 0), BannerID: 1, SlotID: 1, SocialID: 1, Shows: 10, Clicks: 1},
+				{Bucket: date(1, 0, 0), BannerID: 1, SlotID: 1, SocialID: 2, Shows: 10, Clicks: 3},
+				{Bucket: date(1, 0, 0), BannerID: 2, SlotID: 1, SocialID: 1, Shows: 5, Clicks: 0},
+				{Bucket: date(8, 0, 0), BannerID: 2, SlotID: 2, SocialID: 1, Shows: 20, Clicks: 4},
+			},
+		},
+		rows: []app.ReportRow{
+			{BannerID: 1, Shows: 20, Clicks: 4},
+			{BannerID: 2, Shows: 25, Clicks: 4},
+		},
+		watermarks: map[app.Granularity]time.Time{
+			app.GranularityHour: date(9, 5, 0),
+			app.GranularityDay:  date(9, 0, 0),
+		},
+	}
+}
+
+func TestReportPassesQueryToStore(t *testing.T) {
+	store := newFakeReports()
+	reports := app.NewReports(store, &mockLogger{})
+
+	report, err := reports.Report(context.Background(), app.ReportQuery{
+		From:    date(1, 0, 0),
+		To:      date(10, 0, 0),
+		GroupBy: []app.ReportDimension{app.ReportByBanner},
+		Sort:    "-ctr",
+	})
+
+	require.NoError(t, err)
+	require.Equal(t, []app.Granularity{app.GranularityDay}, store.requested)
+	require.Equal(t, []app.ReportQuery{{
+		From:       date(1, 0, 0),
+		To:         date(10, 0, 0),
+		GroupBy:    []app.ReportDimension{app.ReportByBanner},
+		Bucket:     app.GranularityDay,
+		Sort:       "-ctr",
+		Limit:      100,
+		Confidence: app.DefaultReportConfidence,
+	}}, store.queries)
+	require.Equal(t, 2, report.Total)
+	require.Equal(t, date(9, 0, 0), report.CompleteUntil)
+	require.Equal(t, store.rows, report.Rows)
+	require.Nil(t, report.Comparisons)
+}
+
+func TestReportUsesHourlyRollupsForHoursAndUnalignedRange(t *testing.T) {
+	store := newFakeReports()
+	reports := app.NewReports(store, &mockLogger{})
+
+	_, err := reports.Report(context.Background(), app.ReportQuery{From: date(1, 11, 0), To: date(1, 12, 0)})
+	require.NoError(t, err)
+
+	_, err = reports.Report(context.Background(), app.ReportQuery{
+		From:   date(1, 0, 0),
+		To:     date(2, 0, 0),
+		Bucket: app.GranularityHour,
+	})
+	require.NoError(t, err)
+
+	require.Equal(t, []app.Granularity{app.GranularityHour, app.GranularityHour}, store.requested)
+}
+
+func TestReportEmptyPage(t *testing.T) {
+	reports := app.NewReports(newFakeReports(), &mockLogger{})
+
+	report, err := reports.Report(context.Background(), app.ReportQuery{From: date(1, 0, 0), To: date(10, 0, 0), Offset: 10})
+
+	require.NoError(t, err)
+	require.Equal(t, 2, report.Total)
+	require.NotNil(t, report.Rows)
+	require.Empty(t, report.Rows)
+}
+
+func TestReportInvalidQuery(t *testing.T) {
+	reports := app.NewReports(newFakeReports(), &mockLogger{})
+	queries := []app.ReportQuery{
+		{From: date(2, 0, 0), To: date(1, 0, 0)},
+		{From: date(1, 0, 0), To: date(2, 0, 0), Bucket: "month"},
+		{From: date(1, 0, 0), To: date(2, 0, 0), GroupBy: []app.ReportDimension{"campaign"}},
+		{From: date(1, 0, 0), To: date(2, 0, 0), GroupBy: []app.ReportDimension{app.ReportByBanner, app.ReportByBanner}},
+		{From: date(1, 0, 0), To: date(2, 0, 0), Sort: "-views"},
+		{From: date(1, 0, 0), To: date(2, 0, 0), Limit: -1},
+		{From: date(1, 0, 0), To: date(2, 0, 0), Confidence: 1},
+		{From: date(1, 0, 0), To: date(2, 0, 0), Compare: true, GroupBy: []app.ReportDimension{app.ReportBySlot}},
+		{From: date(1, 10, 30), To: date(1, 12, 0)},
+		{From: date(1, 10, 0), To: date(1, 11, 30)},
+		{From: date(1, 0, 0), To: date(2, 0, 0), Sort: "-"},
+	}
+
+	for i, query := range queries {
+		_, err := reports.Report(context.Background(), query)
+
+		require.Error(t, err, "at", i)
+		require.True(t, errors.Is(err, app.ErrInvalidReportQuery), "at", i)
+	}
+}
+
+func TestReportComparesBannersWithinGroup(t *testing.T) {
+	store := &fakeReports{rows: []app.ReportRow{
+		{BannerID: 1, SlotID: 1, Shows: 1000, Clicks: 200},
+		{BannerID: 2, SlotID: 1, Shows: 1000, Clicks: 150},
+		{BannerID: 3, SlotID: 1, Shows: 1000, Clicks: 195},
+		{BannerID: 1, SlotID: 2, Shows: 10, Clicks: 3},
+		{BannerID: 2, SlotID: 2, Shows: 10, Clicks: 1},
+	}}
+	reports := app.NewReports(store, &mockLogger{})
+
+	report, err := reports.Report(context.Background(), app.ReportQuery{
+		From:    date(1, 0, 0),
+		To:      date(2, 0, 0),
+		GroupBy: []app.ReportDimension{app.ReportByBanner, app.ReportBySlot},
+		Compare: true,
+		Limit:   1,
+	})
+
+	require.NoError(t, err)
+	require.Equal(t, app.DefaultReportConfidence, report.Confidence)
+	require.Len(t, report.Rows, 1)
+	require.Len(t, report.Comparisons, 4)
+	// Сравнения считаются по всем строкам отчета, а не по странице.
+	require.Len(t, store.queries, 2)
+	require.Equal(t, 0, store.queries[1].Limit)
+
+	type pair struct {
+		slot, a, b, winner int64
+		significant        bool
+	}
+	var pairs []pair
+	for _, c := range report.Comparisons {
+		pairs = append(pairs, pair{slot: c.SlotID, a: c.BannerA, b: c.BannerB, winner: c.Winner, significant: c.Significant})
+	}
+	// В слоте 1 три пары, поправка Бонферрони: значимо при p < 0.05 / 3.
+	require.Equal(t, []pair{
+		{slot: 1, a: 1, b: 2, winner: 1, significant: true},
+		{slot: 1, a: 1, b: 3},
+		{slot: 1, a: 2, b: 3, winner: 3, significant: true},
+		{slot: 2, a: 1, b: 2},
+	}, pairs)
+}
+
+func TestReportRowCTRInterval(t *testing.T) {
+	low, high := app.ReportRow{Shows: 100, Clicks: 10}.CTRInterval(0.95)
+
+	require.Less(t, low, 0.1)
+	require.Greater(t, high, 0.1)
+}
+
+type rowsWriter struct {
+	rows []app.ReportRow
+}
+
+func (w *rowsWriter) WriteRow(row app.ReportRow) error {
+	w.rows = append(w.rows, row)
+	return nil
+}
+
+func (w *rowsWriter) Close() error {
+	return nil
+}
+
+func TestReportExportStreamsByBucket(t *testing.T) {
+	store := newFakeReports()
+	reports := app.NewReports(store, &mockLogger{})
+	w := &rowsWriter{}
+
+	err := reports.Export(context.Background(), app.ReportQuery{
+		From:    date(1, 0, 0),
+		To:      date(10, 0, 0),
+		GroupBy: []app.ReportDimension{app.ReportByBucket, app.ReportByBanner},
+		Bucket:  app.GranularityWeek,
+		Sort:    "-ctr",
+		Limit:   1,
+	}, w)
+
+	require.NoError(t, err)
+	require.Equal(t, []app.ReportRow{
+		{Bucket: date(1, 0, 0), BannerID: 1, Shows: 20, Clicks: 4},
+		{Bucket: date(1, 0, 0), BannerID: 2, Shows: 5, Clicks: 0},
+		{Bucket: date(8, 0, 0), BannerID: 2, Shows: 20, Clicks: 4},
+	}, w.rows)
+}
+
+func TestReportExportInvalidQuery(t *testing.T) {
+	reports := app.NewReports(newFakeReports(), &mockLogger{})
+	w := &rowsWriter{}
+
+	for _, query := range []app.ReportQuery{
+		{From: date(2, 0, 0), To: date(1, 0, 0)},
+		{From: date(1, 10, 30), To: date(2, 0, 0)},
+	} {
+		err := reports.Export(context.Background(), query, w)
+
+		require.True(t, errors.Is(err, app.ErrInvalidReportQuery))
+		require.Empty(t, w.rows)
+	}
+}
+
+func TestReportLongRange(t *testing.T) {
+	reports := app.NewReports(newFakeReports(), &mockLogger{})
+
+	_, err := reports.Report(context.Background(), app.ReportQuery{
+		From:   date(1, 0, 0),
+		To:     date(1, 0, 0).AddDate(2, 0, 0),
+		Bucket: app.GranularityHour,
+	})
+	require.NoError(t, err)
+
+	err = reports.Export(context.Background(), app.ReportQuery{From: date(1, 0, 0), To: date(1, 0, 0).AddDate(2, 0, 0)}, &rowsWriter{})
+	require.NoError(t, err)
+}
@@ -0,0 +1,115 @@
+package app
+
+import (
+	"context"
+	"time"
+)
+
+const (
+	defaultPartitionsAhead   = 7
+	defaultRetentionInterval = time.Hour
+	defaultOutboxKeep        = 24 * time.Hour
+)
+
+// Retention - обслуживает партиции сырых событий: заранее создает партиции на ближайшие дни
+// и удаляет партиции и отправленные события outbox старше их сроков хранения. Счетчики баннеров обновляются в одной транзакции
+// с записью события, а почасовые агрегаты - по водяному знаку, поэтому партиция удаляется,
+// только когда водяной знак почасовых агрегатов прошел ее конец.
+type Retention struct {
+	log        Logger
+	store      EventPartitions
+	rollups    RollupStore
+	outbox     SentOutbox
+	keep       time.Duration
+	outboxKeep time.Duration
+	ahead      int
+	interval   time.Duration
+}
+
+// NewRetention - keep равный нулю отключает удаление партиций. Отправленные события outbox удаляются всегда,
+// через outboxKeep после отправки, по умолчанию через сутки.
+func NewRetention(
+	logger Logger,
+	store EventPartitions,
+	rollups RollupStore,
+	outbox SentOutbox,
+	keep time.Duration,
+	outboxKeep time.Duration,
+	aheadDays int,
+	interval time.Duration,
+) *Retention {
+	if aheadDays <= 0 {
+		aheadDays = defaultPartitionsAhead
+	}
+	if interval <= 0 {
+		interval = defaultRetentionInterval
+	}
+	if outboxKeep <= 0 {
+		outboxKeep = defaultOutboxKeep
+	}
+
+	return &Retention{
+		log:        logger,
+		store:      store,
+		rollups:    rollups,
+		outbox:     outbox,
+		keep:       keep,
+		outboxKeep: outboxKeep,
+		ahead:      aheadDays,
+		interval:   interval,
+	}
+}
+
+func (r *Retention) Run(ctx context.Context) {
+	r.maintain(ctx)
+
+	doneCh := make(chan struct{})
+	go startWorker(ctx, doneCh, r.interval, func() {
+		r.maintain(ctx)
+	})
+	<-doneCh
+}
+
+// Maintain - создает партиции на ahead дней вперед от now, удаляет события outbox, отправленные раньше now - outboxKeep,
+// и партиции, закончившиеся раньше now - keep и уже учтенные в почасовых агрегатах.
+func (r *Retention) Maintain(ctx context.Context, now time.Time) ([]string, error) {
+	if err := r.store.EnsureEventPartitions(ctx, now, r.ahead); err != nil {
+		return nil, err
+	}
+
+	deleted, err := r.outbox.DeleteSentOutbox(ctx, now.UTC().Add(-r.outboxKeep))
+	if err != nil {
+		return nil, newError("can't delete sent outbox events", err)
+	}
+	if deleted > 0 {
+		r.log.Info("sent outbox events deleted", r.log.Int64("count", deleted))
+	}
+
+	if r.keep <= 0 {
+		return nil, nil
+	}
+
+	before := now.UTC().Add(-r.keep).Truncate(24 * time.Hour)
+	watermark, ok, err := r.rollups.RollupWatermark(ctx, GranularityHour)
+	if err != nil {
+		return nil, newError("can't get rollup watermark", err)
+	}
+	if !ok {
+		return nil, nil
+	}
+	if watermark = watermark.UTC().Truncate(24 * time.Hour); watermark.Before(before) {
+		before = watermark
+	}
+
+	return r.store.DropEventPartitions(ctx, before)
+}
+
+func (r *Retention) maintain(ctx context.Context) {
+	dropped, err := r.Maintain(ctx, time.Now())
+	for _, name := range dropped {
+		r.log.Info("event partition dropped", r.log.String("partition", name))
+	}
+	if err != nil {
+		r.log.Error("can't maintain event partitions", r.log.String("msg", err.Error()))
+	}
+}
@@ -0,0 +1,139 @@
+package app_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/nsmak/bannersRotation/internal/app"
+	"github.com/stretchr/testify/require"
+)
+
+type fakePartitions struct {
+	ensureFrom time.Time
+	ensureDays int
+	dropBefore time.Time
+	dropCalls  int
+	err        error
+}
+
+func (f *fakePartitions) EnsureEventPartitions(_ context.Context, from time.Time, days int) error {
+	f.ensureFrom, f.ensureDays = from, days
+	return f.err
+}
+
+func (f *fakePartitions) DropEventPartitions(_ context.Context, before time.Time) ([]string, error) {
+	f.dropBefore = before
+	f.dropCalls++
+	return []string{"banner_click_p20210101"}, nil
+}
+
+type fakeOutbox struct {
+	before time.Time
+	calls  int
+	err    error
+}
+
+func (f *fakeOutbox) DeleteSentOutbox(_ context.Context, before time.Time) (int64, error) {
+	f.before = before
+	f.calls++
+	return 10, f.err
+}
+
+func TestRetentionMaintain(t *testing.T) {
+	store := &fakePartitions{}
+	rollups := &fakeRollups{watermarks: map[app.Granularity]time.Time{app.GranularityHour: date(10, 14, 0)}}
+	retention := app.NewRetention(&mockLogger{}, store, rollups, &fakeOutbox{}, 30*24*time.Hour, 0, 3, time.Hour)
+	now := date(10, 15, 30)
+
+	dropped, err := retention.Maintain(context.Background(), now)
+
+	require.NoError(t, err)
+	require.Equal(t, []string{"banner_click_p20210101"}, dropped)
+	require.Equal(t, now, store.ensureFrom)
+	require.Equal(t, 3, store.ensureDays)
+	require.Equal(t, time.Date(2021, 1, 11, 0, 0, 0, 0, time.UTC), store.dropBefore)
+}
+
+func TestRetentionKeepsEverythingWithoutLimit(t *testing.T) {
+	store := &fakePartitions{}
+	retention := app.NewRetention(&mockLogger{}, store, &fakeRollups{}, &fakeOutbox{}, 0, 0, 0, 0)
+
+	dropped, err := retention.Maintain(context.Background(), time.Now())
+
+	require.NoError(t, err)
+	require.Empty(t, dropped)
+	require.Equal(t, 7, store.ensureDays)
+	require.Zero(t, store.dropCalls)
+}
+
+func TestRetentionWaitsForRollups(t *testing.T) {
+	store := &fakePartitions{}
+	rollups := &fakeRollups{watermarks: map[app.Granularity]time.Time{app.GranularityHour: date(3, 7, 0)}}
+	retention := app.NewRetention(&mockLogger{}, store, rollups, &fakeOutbox{}, 24*time.Hour, 0, 1, time.Hour)
+
+	_, err := retention.Maintain(context.Background(), date(10, 15, 30))
+
+	require.NoError(t, err)
+	require.Equal(t, date(3, 0, 0), store.dropBefore)
+}
+
+func TestRetentionKeepsPartitionsBeforeFirstRollup(t *testing.T) {
+	store := &fakePartitions{}
+	retention := app.NewRetention(&mockLogger{}, store, &fakeRollups{}, &fakeOutbox{}, 24*time.Hour, 0, 1, time.Hour)
+
+	dropped, err := retention.Maintain(context.Background(), date(10, 15, 30))
+
+	require.NoError(t, err)
+	require.Empty(t, dropped)
+	require.Zero(t, store.dropCalls)
+}
+
+func TestRetentionDoesNotDropWhenPartitionsFail(t *testing.T) {
+	store := &fakePartitions{err: errors.New("db is down")}
+	retention := app.NewRetention(&mockLogger{}, store, &fakeRollups{}, &fakeOutbox{}, time.Hour, 0, 1, time.Hour)
+
+	_, err := retention.Maintain(context.Background(), time.Now())
+
+	require.Error(t, err)
+	require.Zero(t, store.dropCalls)
+}
+
+func TestRetentionDeletesSentOutbox(t *testing.T) {
+	outbox := &fakeOutbox{}
+	retention := app.NewRetention(
+		&mockLogger{}, &fakePartitions{}, &fakeRollups{}, outbox, 30*24*time.Hour, 2*time.Hour, 1, time.Hour,
+	)
+
+	_, err := retention.Maintain(context.Background(), date(10, 15, 30))
+
+	require.NoError(t, err)
+	require.Equal(t, 1, outbox.calls)
+	require.Equal(t, date(10, 13, 30), outbox.before)
+}
+
+func TestRetentionDeletesSentOutboxWhenEventsKeptForever(t *testing.T) {
+	store := &fakePartitions{}
+	outbox := &fakeOutbox{}
+	retention := app.NewRetention(&mockLogger{}, store, &fakeRollups{}, outbox, 0, 0, 1, time.Hour)
+
+	_, err := retention.Maintain(context.Background(), date(10, 15, 30))
+
+	require.NoError(t, err)
+	require.Equal(t, 1, outbox.calls)
+	require.Equal(t, date(9, 15, 30), outbox.before)
+	require.Zero(t, store.dropCalls)
+}
+
+func TestRetentionReportsOutboxError(t *testing.T) {
+	store := &fakePartitions{}
+	outbox := &fakeOutbox{err: errors.New("db is down")}
+	rollups := &fakeRollups{watermarks: map[app.Granularity]time.Time{app.GranularityHour: date(10, 14, 0)}}
+	retention := app.NewRetention(&mockLogger{}, store, rollups, outbox, 24*time.Hour, 0, 1, time.Hour)
+
+	_, err := retention.Maintain(context.Background(), date(10, 15, 30))
+
+	require.Error(t, err)
+	require.Zero(t, store.dropCalls)
+}
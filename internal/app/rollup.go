@@ -0,0 +1,144 @@
+package app
+
+import (
+	"context"
+	"time"
+)
+
+const (
+	defaultRollupInterval = 5 * time.Minute
+	defaultRollupLag      = 5 * time.Minute
+)
+
+// Сколько интервалов пересчитывается одним запросом при догоне водяного знака.
+var rollupChunks = map[Granularity]time.Duration{
+	GranularityHour: 24 * time.Hour,
+	GranularityDay:  31 * 24 * time.Hour,
+}
+
+// Rollup - периодически досчитывает почасовые и дневные агрегаты статистики.
+type Rollup struct {
+	log      Logger
+	store    RollupStore
+	lag      time.Duration
+	interval time.Duration
+}
+
+// NewRollup - lag - сколько ждать опоздавших событий, прежде чем считать час завершенным.
+func NewRollup(logger Logger, store RollupStore, lag, interval time.Duration) *Rollup {
+	if lag <= 0 {
+		lag = defaultRollupLag
+	}
+	if interval <= 0 {
+		interval = defaultRollupInterval
+	}
+
+	return &Rollup{
+		log:      logger,
+		store:    store,
+		lag:      lag,
+		interval: interval,
+	}
+}
+
+func (r *Rollup) Run(ctx context.Context) {
+	r.advance(ctx)
+
+	doneCh := make(chan struct{})
+	go startWorker(ctx, doneCh, r.interval, func() {
+		r.advance(ctx)
+	})
+	<-doneCh
+}
+
+// Advance - досчитывает агрегаты от водяных знаков до последнего завершенного часа и дня.
+// Без водяного знака расчет начинается с самого раннего сохраненного события.
+func (r *Rollup) Advance(ctx context.Context, now time.Time) error {
+	hourly, err := r.advanceTo(ctx, GranularityHour, now.UTC().Add(-r.lag).Truncate(time.Hour))
+	if err != nil {
+		return err
+	}
+
+	// Дневные агрегаты строятся из почасовых, поэтому не обгоняют их.
+	_, err = r.advanceTo(ctx, GranularityDay, hourly.Truncate(24*time.Hour))
+	return err
+}
+
+// Recompute - заново считает агрегаты за [from, to), расширенный до границ часов и дней.
+// Пересчет идемпотентен и не двигает водяные знаки. Период должен целиком лежать в сохраненных сырых событиях,
+// иначе пересчет затер бы агрегаты удаленных партиций.
+func (r *Rollup) Recompute(ctx context.Context, from, to time.Time) error {
+	from, to = floor(from, time.Hour), ceil(to, time.Hour)
+	if !from.Before(to) {
+		return newError("rollup range is empty", nil)
+	}
+
+	first, ok, err := r.store.FirstEventTime(ctx)
+	if err != nil {
+		return newError("can't get first event time", err)
+	}
+	if !ok || from.Before(floor(first, 24*time.Hour)) {
+		return newError("raw events for the range are already dropped, can't recompute rollups", nil)
+	}
+
+	if err := r.store.RollupEvents(ctx, GranularityHour, from, to); err != nil {
+		return newError("can't recompute hourly rollups", err)
+	}
+	if err := r.store.RollupEvents(ctx, GranularityDay, floor(from, 24*time.Hour), ceil(to, 24*time.Hour)); err != nil {
+		return newError("can't recompute daily rollups", err)
+	}
+
+	return nil
+}
+
+func (r *Rollup) advanceTo(ctx context.Context, granularity Granularity, end time.Time) (time.Time, error) {
+	start, ok, err := r.store.RollupWatermark(ctx, granularity)
+	if err != nil {
+		return time.Time{}, newError("can't get rollup watermark", err)
+	}
+	if !ok {
+		first, ok, err := r.store.FirstEventTime(ctx)
+		if err != nil {
+			return time.Time{}, newError("can't get first event time", err)
+		}
+		if !ok {
+			return end, nil
+		}
+		start = floor(first, granularity.Duration())
+	}
+
+	for start.Before(end) {
+		chunkEnd := start.Add(rollupChunks[granularity])
+		if chunkEnd.After(end) {
+			chunkEnd = end
+		}
+
+		if err := r.store.RollupEvents(ctx, granularity, start, chunkEnd); err != nil {
+			return start, newError("can't roll up "+string(granularity)+" statistics", err)
+		}
+		if err := r.store.SetRollupWatermark(ctx, granularity, chunkEnd); err != nil {
+			return start, newError("can't save rollup watermark", err)
+		}
+		start = chunkEnd
+	}
+
+	return start, nil
+}
+
+func (r *Rollup) advance(ctx context.Context) {
+	if err := r.Advance(ctx, time.Now()); err != nil {
+		r.log.Error("can't roll up statistics", r.log.String("msg", err.Error()))
+	}
+}
+
+func floor(t time.Time, d time.Duration) time.Time {
+	return t.UTC().Truncate(d)
+}
+
+func ceil(t time.Time, d time.Duration) time.Time {
+	f := floor(t, d)
+	if f.Equal(t) {
+		return f
+	}
+	return f.Add(d)
+}
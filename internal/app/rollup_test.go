@@ -0,0 +1,132 @@
+package app_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/nsmak/bannersRotation/internal/app"
+	"github.com/stretchr/testify/require"
+)
+
+type rollupCall struct {
+	granularity app.Granularity
+	from, to    time.Time
+}
+
+type fakeRollups struct {
+	watermarks map[app.Granularity]time.Time
+	firstEvent time.Time
+	calls      []rollupCall
+}
+
+func (f *fakeRollups) RollupEvents(_ context.Context, granularity app.Granularity, from, to time.Time) error {
+	f.calls = append(f.calls, rollupCall{granularity: granularity, from: from, to: to})
+	return nil
+}
+
+func (f *fakeRollups) RollupWatermark(_ context.Context, granularity app.Granularity) (time.Time, bool, error) {
+	t, ok := f.watermarks[granularity]
+	return t, ok, nil
+}
+
+func (f *fakeRollups) SetRollupWatermark(_ context.Context, granularity app.Granularity, to time.Time) error {
+	if f.watermarks == nil {
+		f.watermarks = map[app.Granularity]time.Time{}
+	}
+	f.watermarks[granularity] = to
+	return nil
+}
+
+func (f *fakeRollups) FirstEventTime(_ context.Context) (time.Time, bool, error) {
+	return f.firstEvent, !f.firstEvent.IsZero(), nil
+}
+
+func (f *fakeRollups) ReportRows(context.Context, app.Granularity, app.ReportQuery) ([]app.ReportRow, int, error) {
+	return nil, 0, nil
+}
+
+func (f *fakeRollups) EachBannerRollup(
+	context.Context, app.Granularity, time.Time, time.Time, func(app.BannerRollup) error,
+) error {
+	return nil
+}
+
+func date(day, hour, min int) time.Time {
+	return time.Date(2021, 2, day, hour, min, 0, 0, time.UTC)
+}
+
+func TestRollupAdvanceFromFirstEvent(t *testing.T) {
+	store := &fakeRollups{firstEvent: date(1, 22, 15)}
+	rollup := app.NewRollup(&mockLogger{}, store, 10*time.Minute, time.Minute)
+
+	err := rollup.Advance(context.Background(), date(3, 1, 5))
+
+	require.NoError(t, err)
+	require.Equal(t, []rollupCall{
+		{app.GranularityHour, date(1, 22, 0), date(2, 22, 0)},
+		{app.GranularityHour, date(2, 22, 0), date(3, 0, 0)},
+		{app.GranularityDay, date(1, 0, 0), date(3, 0, 0)},
+	}, store.calls)
+	require.Equal(t, date(3, 0, 0), store.watermarks[app.GranularityHour])
+	require.Equal(t, date(3, 0, 0), store.watermarks[app.GranularityDay])
+}
+
+func TestRollupAdvanceFromWatermark(t *testing.T) {
+	store := &fakeRollups{
+		firstEvent: date(1, 0, 0),
+		watermarks: map[app.Granularity]time.Time{
+			app.GranularityHour: date(3, 10, 0),
+			app.GranularityDay:  date(3, 0, 0),
+		},
+	}
+	rollup := app.NewRollup(&mockLogger{}, store, 5*time.Minute, time.Minute)
+
+	require.NoError(t, rollup.Advance(context.Background(), date(3, 12, 30)))
+
+	require.Equal(t, []rollupCall{{app.GranularityHour, date(3, 10, 0), date(3, 12, 0)}}, store.calls)
+	require.Equal(t, date(3, 12, 0), store.watermarks[app.GranularityHour])
+	require.Equal(t, date(3, 0, 0), store.watermarks[app.GranularityDay])
+}
+
+func TestRollupAdvanceWithoutEvents(t *testing.T) {
+	store := &fakeRollups{}
+	rollup := app.NewRollup(&mockLogger{}, store, 0, 0)
+
+	require.NoError(t, rollup.Advance(context.Background(), date(3, 12, 30)))
+
+	require.Empty(t, store.calls)
+	require.Empty(t, store.watermarks)
+}
+
+func TestRollupRecompute(t *testing.T) {
+	store := &fakeRollups{
+		firstEvent: date(1, 5, 0),
+		watermarks: map[app.Granularity]time.Time{app.GranularityHour: date(5, 0, 0)},
+	}
+	rollup := app.NewRollup(&mockLogger{}, store, 0, 0)
+
+	err := rollup.Recompute(context.Background(), date(2, 10, 30), date(2, 11, 10))
+
+	require.NoError(t, err)
+	require.Equal(t, []rollupCall{
+		{app.GranularityHour, date(2, 10, 0), date(2, 12, 0)},
+		{app.GranularityDay, date(2, 0, 0), date(3, 0, 0)},
+	}, store.calls)
+	require.Equal(t, date(5, 0, 0), store.watermarks[app.GranularityHour])
+}
+
+func TestRollupRecomputeRefusesDroppedRange(t *testing.T) {
+	store := &fakeRollups{firstEvent: date(2, 5, 0)}
+	rollup := app.NewRollup(&mockLogger{}, store, 0, 0)
+
+	err := rollup.Recompute(context.Background(), date(1, 10, 0), date(3, 0, 0))
+
+	require.Error(t, err)
+	require.Empty(t, store.calls)
+}
+
+func TestBannerRollupCTR(t *testing.T) {
+	require.Equal(t, 0.25, app.BannerRollup{Shows: 8, Clicks: 2}.CTR())
+	require.Zero(t, app.BannerRollup{}.CTR())
+}
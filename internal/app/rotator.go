@@ -2,10 +2,17 @@ package app
 
 import (
 	"context"
+	"time"
 
+	"github.com/nsmak/bannersRotation/internal/tracing"
 	"github.com/nsmak/bannersRotation/internal/utils"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
+var tracer = otel.Tracer("github.com/nsmak/bannersRotation/internal/app")
+
 type domainError struct {
 	BaseError
 }
@@ -16,20 +23,37 @@ func newError(msg string, err error) *domainError {
 
 // RotatorDomain отвечает за работу с баннерами.
 type RotatorDomain struct {
-	store Storage
-	log   Logger
+	store   Storage
+	log     Logger
+	metrics RotatorMetrics
+	live    *liveHub
+}
+
+// NewRotator - возвращает новый инстанс домена. m может быть nil.
+func NewRotator(s Storage, l Logger, m RotatorMetrics) *RotatorDomain {
+	if m == nil {
+		m = nopMetrics{}
+	}
+	return &RotatorDomain{store: s, log: l, metrics: m, live: newLiveHub()}
 }
 
-// NewRotator - возвращает новый инстанс домена.
-func NewRotator(s Storage, l Logger) *RotatorDomain {
-	return &RotatorDomain{store: s, log: l}
+// Subscribe - подписка на счетчики слота slotID (0 - всех слотов), которые рассылаются после каждого
+// показа и клика. Медленный подписчик пропускает обновления. cancel отписывает и закрывает канал.
+func (r *RotatorDomain) Subscribe(slotID int64) (updates <-chan SlotUpdate, cancel func()) {
+	return r.live.subscribe(slotID)
 }
 
 // AddBannerToSlot - добавляет новый баннер в ротацию в данном слоте.
-func (r *RotatorDomain) AddBannerToSlot(ctx context.Context, bannerID, slotID int64) error {
-	err := r.store.AddBannerToSlot(ctx, bannerID, slotID)
+func (r *RotatorDomain) AddBannerToSlot(ctx context.Context, bannerID, slotID int64) (err error) {
+	ctx, span := tracer.Start(ctx, "RotatorDomain.AddBannerToSlot", trace.WithAttributes(
+		attribute.Int64("banner_id", bannerID), attribute.Int64("slot_id", slotID),
+	))
+	defer func() { tracing.End(span, err) }()
+	log := r.log.WithContext(ctx)
+
+	err = r.store.AddBannerToSlot(ctx, bannerID, slotID)
 	if err != nil {
-		r.log.Error("can't add banner to slot", r.log.String("msg", err.Error()))
+		log.Error("can't add banner to slot", log.String("msg", err.Error()))
 		return newError("add banner to slot error", err)
 	}
 
@@ -37,52 +61,101 @@ func (r *RotatorDomain) AddBannerToSlot(ctx context.Context, bannerID, slotID in
 }
 
 // RemoveBannerFromSlot - удаляет баннер из ротации в данном слоте.
-func (r *RotatorDomain) RemoveBannerFromSlot(ctx context.Context, bannerID, slotID int64) error {
-	err := r.store.RemoveBannerFromSlot(ctx, bannerID, slotID)
+func (r *RotatorDomain) RemoveBannerFromSlot(ctx context.Context, bannerID, slotID int64) (err error) {
+	ctx, span := tracer.Start(ctx, "RotatorDomain.RemoveBannerFromSlot", trace.WithAttributes(
+		attribute.Int64("banner_id", bannerID), attribute.Int64("slot_id", slotID),
+	))
+	defer func() { tracing.End(span, err) }()
+	log := r.log.WithContext(ctx)
+
+	err = r.store.RemoveBannerFromSlot(ctx, bannerID, slotID)
 	if err != nil {
-		r.log.Error("can't remove banner from slot", r.log.String("msg", err.Error()))
+		log.Error("can't remove banner from slot", log.String("msg", err.Error()))
 		return newError("remove banner from slot error", err)
 	}
 
 	return nil
 }
 
-func (r *RotatorDomain) BannerIDForSlot(ctx context.Context, slotID, socialID int64) (int64, error) {
+func (r *RotatorDomain) BannerIDForSlot(ctx context.Context, slotID, socialID int64) (_ int64, err error) {
+	ctx, span := tracer.Start(ctx, "RotatorDomain.BannerIDForSlot", trace.WithAttributes(
+		attribute.Int64("slot_id", slotID), attribute.Int64("social_id", socialID),
+	))
+	defer func() { tracing.End(span, err) }()
+	log := r.log.WithContext(ctx)
+
 	stats, err := r.store.BannersStatistics(ctx, slotID, socialID)
 	if err != nil {
-		r.log.Error("can't get statistics about slot", r.log.String("msg", err.Error()))
+		log.Error("can't get statistics about slot", log.String("msg", err.Error()))
 		return 0, newError("slot statistics error", err)
 	}
 
-	lenStats := len(stats)
-
-	showsCount := make([]int64, lenStats)
-	clicksCount := make([]int64, lenStats)
-
-	for i, s := range stats {
-		showsCount[i] = s.ShowCount
-		clicksCount[i] = s.ClickCount
-	}
-
-	index := utils.PlayWithBandit(showsCount, clicksCount)
+	index := playWithBandit(stats)
 
 	bannerID := stats[index].BannerID
+	span.SetAttributes(attribute.Int64("banner_id", bannerID))
 
 	err = r.store.AddViewForBanner(ctx, bannerID, slotID, socialID)
 	if err != nil {
-		r.log.Error("add view for banner error", r.log.String("msg", err.Error()))
+		log.Error("add view for banner error", log.String("msg", err.Error()))
+		r.metrics.EventWriteFailed(StatTypeShow)
 		return 0, newError("add view for banner error", err)
 	}
+	r.metrics.BannerSelected(slotID, bannerID)
+
+	if r.live.watched(slotID) {
+		stats[index].ShowCount++
+		r.live.publish(newSlotUpdate(slotID, socialID, stats))
+	}
 
 	return bannerID, nil
 }
 
-func (r *RotatorDomain) AddClickForBanner(ctx context.Context, bannerID, slotID, socialID int64) error {
-	err := r.store.AddClickForBanner(ctx, bannerID, slotID, socialID)
+func (r *RotatorDomain) AddClickForBanner(ctx context.Context, bannerID, slotID, socialID int64) (err error) {
+	ctx, span := tracer.Start(ctx, "RotatorDomain.AddClickForBanner", trace.WithAttributes(
+		attribute.Int64("banner_id", bannerID), attribute.Int64("slot_id", slotID), attribute.Int64("social_id", socialID),
+	))
+	defer func() { tracing.End(span, err) }()
+	log := r.log.WithContext(ctx)
+
+	err = r.store.AddClickForBanner(ctx, bannerID, slotID, socialID)
 	if err != nil {
-		r.log.Error("add click for banner error", r.log.String("msg", err.Error()))
+		log.Error("add click for banner error", log.String("msg", err.Error()))
+		r.metrics.EventWriteFailed(StatTypeClick)
 		return newError("add click for banner error", err)
 	}
 
+	if r.live.watched(slotID) {
+		// Клик уже записан, поэтому ошибка чтения счетчиков не должна превращаться в ошибку клика.
+		// Отстающая реплика могла еще не получить клик, поэтому счетчики читаются с primary.
+		stats, err := r.store.BannersStatistics(WithFreshReads(ctx), slotID, socialID)
+		if err != nil {
+			log.Warn("can't get slot statistics for live update", log.String("msg", err.Error()))
+			return nil
+		}
+		r.live.publish(newSlotUpdate(slotID, socialID, stats))
+	}
+
 	return nil
 }
+
+// newSlotUpdate - лидер - баннер, который бандит выбрал бы следующим показом.
+func newSlotUpdate(slotID, socialID int64, stats []BannerSummary) SlotUpdate {
+	update := SlotUpdate{SlotID: slotID, SocialID: socialID, Banners: stats, At: time.Now().UTC()}
+	if len(stats) > 0 {
+		update.Leader = stats[playWithBandit(stats)].BannerID
+	}
+	return update
+}
+
+// playWithBandit - индекс баннера, который выбирает бандит по счетчикам показов и кликов.
+func playWithBandit(stats []BannerSummary) int {
+	showsCount := make([]int64, len(stats))
+	clicksCount := make([]int64, len(stats))
+	for i, s := range stats {
+		showsCount[i] = s.ShowCount
+		clicksCount[i] = s.ClickCount
+	}
+
+	return utils.PlayWithBandit(showsCount, clicksCount)
+}
@@ -24,7 +24,7 @@ type RotatorDomainSuite struct {
 func (s *RotatorDomainSuite) SetupTest() {
 	s.mockCtl = gomock.NewController(s.T())
 	s.mockStore = NewMockStorage(s.mockCtl)
-	s.rotator = app.NewRotator(s.mockStore, &mockLogger{})
+	s.rotator = app.NewRotator(s.mockStore, &mockLogger{}, nil)
 }
 
 func (s *RotatorDomainSuite) TearDownTest() {
@@ -36,7 +36,7 @@ func (s *RotatorDomainSuite) TestAddBannerToSlotSuccess() {
 	var slotID int64 = 2
 	ctx := context.Background()
 
-	s.mockStore.EXPECT().AddBannerToSlot(ctx, bannerID, slotID).Return(nil)
+	s.mockStore.EXPECT().AddBannerToSlot(gomock.Any(), bannerID, slotID).Return(nil)
 	err := s.rotator.AddBannerToSlot(ctx, bannerID, slotID)
 
 	s.Require().NoError(err)
@@ -47,7 +47,7 @@ func (s *RotatorDomainSuite) TestAddBannerToSlotFail() {
 	var slotID int64 = 2
 	ctx := context.Background()
 
-	s.mockStore.EXPECT().AddBannerToSlot(ctx, bannerID, slotID).Return(errStore)
+	s.mockStore.EXPECT().AddBannerToSlot(gomock.Any(), bannerID, slotID).Return(errStore)
 	err := s.rotator.AddBannerToSlot(ctx, bannerID, slotID)
 
 	s.Require().Error(err)
@@ -58,7 +58,7 @@ func (s *RotatorDomainSuite) TestRemoveBannerFromSlotSuccess() {
 	var slotID int64 = 2
 	ctx := context.Background()
 
-	s.mockStore.EXPECT().RemoveBannerFromSlot(ctx, bannerID, slotID).Return(nil)
+	s.mockStore.EXPECT().RemoveBannerFromSlot(gomock.Any(), bannerID, slotID).Return(nil)
 	err := s.rotator.RemoveBannerFromSlot(ctx, bannerID, slotID)
 
 	s.Require().NoError(err)
@@ -69,7 +69,7 @@ func (s *RotatorDomainSuite) TestRemoveBannerFromSlotFail() {
 	var slotID int64 = 2
 	ctx := context.Background()
 
-	s.mockStore.EXPECT().RemoveBannerFromSlot(ctx, bannerID, slotID).Return(errStore)
+	s.mockStore.EXPECT().RemoveBannerFromSlot(gomock.Any(), bannerID, slotID).Return(errStore)
 	err := s.rotator.RemoveBannerFromSlot(ctx, bannerID, slotID)
 
 	s.Require().Error(err)
@@ -82,8 +82,8 @@ func (s *RotatorDomainSuite) TestBannerIDForSlotSuccess() {
 	var expected int64 = 3
 	ctx := context.Background()
 
-	s.mockStore.EXPECT().BannersStatistics(ctx, slotID, socialID).Return(stats, nil)
-	s.mockStore.EXPECT().AddViewForBanner(ctx, int64(3), slotID, socialID).Return(nil)
+	s.mockStore.EXPECT().BannersStatistics(gomock.Any(), slotID, socialID).Return(stats, nil)
+	s.mockStore.EXPECT().AddViewForBanner(gomock.Any(), int64(3), slotID, socialID).Return(nil)
 	bannerID, err := s.rotator.BannerIDForSlot(ctx, slotID, socialID)
 
 	s.Require().NoError(err)
@@ -95,7 +95,7 @@ func (s *RotatorDomainSuite) TestBannerIDForSlotStoreStatsFail() {
 	var socialID int64 = 1
 	ctx := context.Background()
 
-	s.mockStore.EXPECT().BannersStatistics(ctx, slotID, socialID).Return(nil, errStore)
+	s.mockStore.EXPECT().BannersStatistics(gomock.Any(), slotID, socialID).Return(nil, errStore)
 	bannerID, err := s.rotator.BannerIDForSlot(ctx, slotID, socialID)
 
 	s.Require().Error(err)
@@ -109,8 +109,8 @@ func (s *RotatorDomainSuite) TestBannerIDForSlotStoreAddViewFail() {
 	stats := mockStatistics()
 	ctx := context.Background()
 
-	s.mockStore.EXPECT().BannersStatistics(ctx, slotID, socialID).Return(stats, nil)
-	s.mockStore.EXPECT().AddViewForBanner(ctx, int64(3), slotID, socialID).Return(errStore)
+	s.mockStore.EXPECT().BannersStatistics(gomock.Any(), slotID, socialID).Return(stats, nil)
+	s.mockStore.EXPECT().AddViewForBanner(gomock.Any(), int64(3), slotID, socialID).Return(errStore)
 	bannerID, err := s.rotator.BannerIDForSlot(ctx, slotID, socialID)
 
 	s.Require().Error(err)
@@ -124,7 +124,7 @@ func (s *RotatorDomainSuite) TestAddClickForBannerSuccess() {
 	var socialID int64 = 1
 	ctx := context.Background()
 
-	s.mockStore.EXPECT().AddClickForBanner(ctx, bannerID, slotID, socialID).Return(nil)
+	s.mockStore.EXPECT().AddClickForBanner(gomock.Any(), bannerID, slotID, socialID).Return(nil)
 	err := s.rotator.AddClickForBanner(ctx, bannerID, slotID, socialID)
 
 	s.Require().NoError(err)
@@ -136,13 +136,96 @@ func (s *RotatorDomainSuite) TestAddClickForBannerFail() {
 	var socialID int64 = 1
 	ctx := context.Background()
 
-	s.mockStore.EXPECT().AddClickForBanner(ctx, bannerID, slotID, socialID).Return(errStore)
+	s.mockStore.EXPECT().AddClickForBanner(gomock.Any(), bannerID, slotID, socialID).Return(errStore)
 	err := s.rotator.AddClickForBanner(ctx, bannerID, slotID, socialID)
 
 	s.Require().Error(err)
 	s.Require().True(errors.Is(err, errStore))
 }
 
+func (s *RotatorDomainSuite) TestBannerIDForSlotPublishesUpdate() {
+	var slotID int64 = 1
+	var socialID int64 = 1
+	ctx := context.Background()
+	updates, cancel := s.rotator.Subscribe(slotID)
+	defer cancel()
+	other, cancelOther := s.rotator.Subscribe(2)
+	defer cancelOther()
+
+	s.mockStore.EXPECT().BannersStatistics(gomock.Any(), slotID, socialID).Return(mockStatistics(), nil)
+	s.mockStore.EXPECT().AddViewForBanner(gomock.Any(), int64(3), slotID, socialID).Return(nil)
+	_, err := s.rotator.BannerIDForSlot(ctx, slotID, socialID)
+	s.Require().NoError(err)
+
+	update := <-updates
+	s.Require().Equal(slotID, update.SlotID)
+	s.Require().Equal(socialID, update.SocialID)
+	s.Require().Equal(int64(6), update.Banners[2].ShowCount)
+	s.Require().Equal(int64(2), update.Leader)
+	s.Require().Empty(other)
+}
+
+func (s *RotatorDomainSuite) TestAddClickForBannerPublishesUpdate() {
+	var bannerID int64 = 1
+	var slotID int64 = 1
+	var socialID int64 = 1
+	ctx := context.Background()
+	updates, cancel := s.rotator.Subscribe(0)
+
+	stats := mockStatistics()
+	stats[0].ClickCount = 5
+	s.mockStore.EXPECT().AddClickForBanner(gomock.Any(), bannerID, slotID, socialID).Return(nil)
+	s.mockStore.EXPECT().BannersStatistics(freshReads{}, slotID, socialID).Return(stats, nil)
+	err := s.rotator.AddClickForBanner(ctx, bannerID, slotID, socialID)
+	s.Require().NoError(err)
+
+	update := <-updates
+	s.Require().Equal(bannerID, update.Leader)
+
+	cancel()
+	_, ok := <-updates
+	s.Require().False(ok)
+
+	// Без подписчиков счетчики не читаются.
+	s.mockStore.EXPECT().AddClickForBanner(gomock.Any(), bannerID, slotID, socialID).Return(nil)
+	s.Require().NoError(s.rotator.AddClickForBanner(ctx, bannerID, slotID, socialID))
+}
+
+func (s *RotatorDomainSuite) TestAddClickForBannerIgnoresLiveUpdateError() {
+	var bannerID int64 = 1
+	var slotID int64 = 1
+	var socialID int64 = 1
+	ctx := context.Background()
+	updates, cancel := s.rotator.Subscribe(slotID)
+	defer cancel()
+
+	s.mockStore.EXPECT().AddClickForBanner(gomock.Any(), bannerID, slotID, socialID).Return(nil)
+	s.mockStore.EXPECT().BannersStatistics(gomock.Any(), slotID, socialID).Return(nil, errStore)
+	err := s.rotator.AddClickForBanner(ctx, bannerID, slotID, socialID)
+
+	s.Require().NoError(err)
+	s.Require().Empty(updates)
+}
+
+func (s *RotatorDomainSuite) TestLiveLeaderIsBanditChoice() {
+	var slotID int64 = 1
+	var socialID int64 = 1
+	updates, cancel := s.rotator.Subscribe(slotID)
+	defer cancel()
+
+	// У первого баннера CTR выше, но второй показан мало, и бандит выберет его.
+	stats := []app.BannerSummary{
+		{BannerID: 1, SlotID: slotID, SocialID: socialID, ShowCount: 100, ClickCount: 10},
+		{BannerID: 2, SlotID: slotID, SocialID: socialID, ShowCount: 2, ClickCount: 0},
+	}
+	s.mockStore.EXPECT().AddClickForBanner(gomock.Any(), int64(1), slotID, socialID).Return(nil)
+	s.mockStore.EXPECT().BannersStatistics(gomock.Any(), slotID, socialID).Return(stats, nil)
+	s.Require().NoError(s.rotator.AddClickForBanner(context.Background(), 1, slotID, socialID))
+
+	update := <-updates
+	s.Require().Equal(int64(2), update.Leader)
+}
+
 func TestRotatorDomainSuite(t *testing.T) {
 	suite.Run(t, new(RotatorDomainSuite))
 }
@@ -173,9 +256,25 @@ func mockStatistics() []app.BannerSummary {
 	}
 }
 
+// freshReads - контекст, в котором хранилище должно читать с primary.
+type freshReads struct{}
+
+func (freshReads) Matches(x interface{}) bool {
+	ctx, ok := x.(context.Context)
+	return ok && app.FreshReads(ctx)
+}
+
+func (freshReads) String() string {
+	return "context with fresh reads"
+}
+
 type mockLogger struct {
 }
 
+func (m *mockLogger) WithContext(ctx context.Context) app.Logger {
+	return m
+}
+
 func (m *mockLogger) Info(msg string, fields ...zap.Field) {
 }
 
@@ -2,88 +2,206 @@ package app
 
 import (
 	"context"
-	"encoding/json"
-	"log"
 	"time"
+
+	"github.com/nsmak/bannersRotation/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
-var (
-	typeShow  StatType = "show"
-	typeClick StatType = "click"
+const (
+	defaultOutboxBatchSize = 500
+	replayDeleteBatch      = 100
 )
 
 type Statistic struct {
-	log      Logger
-	storage  Storage
-	producer MQProducer
-	interval time.Duration
+	log         Logger
+	storage     StatisticStore
+	sink        EventSink
+	encoder     EventEncoder
+	deadLetters DeadLetterStore
+	metrics     StatisticMetrics
+	interval    time.Duration
+	batchSize   int
 }
 
-func NewStatistic(logger Logger, storage Storage, producer MQProducer, interval time.Duration) *Statistic {
-	return &Statistic{log: logger, storage: storage, producer: producer, interval: interval}
+func NewStatistic(
+	logger Logger,
+	storage StatisticStore,
+	sink EventSink,
+	encoder EventEncoder,
+	deadLetters DeadLetterStore,
+	metrics StatisticMetrics,
+	interval time.Duration,
+	batchSize int,
+) *Statistic {
+	if batchSize <= 0 {
+		batchSize = defaultOutboxBatchSize
+	}
+	if metrics == nil {
+		metrics = nopMetrics{}
+	}
+
+	return &Statistic{
+		log:         logger,
+		storage:     storage,
+		sink:        sink,
+		encoder:     encoder,
+		deadLetters: deadLetters,
+		metrics:     metrics,
+		interval:    interval,
+		batchSize:   batchSize,
+	}
 }
 
 func (s *Statistic) Run(ctx context.Context) {
 	doneCh := make(chan struct{})
 	go startWorker(ctx, doneCh, s.interval, func() {
-		s.publishStatisticMessage(ctx)
+		if err := s.RelayOutbox(ctx); err != nil {
+			s.log.Error("can't relay outbox", s.log.String("msg", err.Error()))
+		}
 	})
 	<-doneCh
 }
 
-func (s *Statistic) publishStatisticMessage(ctx context.Context) {
-	err := s.producer.OpenChannel()
-	if err != nil {
-		s.log.Error("can't open channel", s.log.String("msg", err.Error()))
-		return
-	}
-	defer func() {
-		err := s.producer.CloseChannel()
+// RelayOutbox - отправляет все накопившиеся события из outbox пачками и помечает их отправленными.
+// Событие считается обработанным, если оно опубликовано или сохранено в dead-letter хранилище;
+// если не удалось ни то, ни другое, событие и все последующие остаются в outbox до следующего запуска.
+func (s *Statistic) RelayOutbox(ctx context.Context) error {
+	for {
+		events, err := s.storage.OutboxEvents(ctx, s.batchSize)
 		if err != nil {
-			s.log.Error("can't close channel", s.log.String("msg", err.Error()))
+			return newError("can't get outbox events", err)
 		}
-	}()
 
-	from := time.Now()
-	to := from.Add(s.interval)
+		// Outbox отдает события в порядке записи, первое - самое старое из неотправленных.
+		if len(events) > 0 {
+			first := NewStatisticEvent(events[0].Type, events[0].BannerStatistic)
+			s.metrics.ExportLag(time.Since(first.OccurredAt))
+		} else {
+			s.metrics.ExportLag(0)
+		}
 
-	shows, err := s.storage.BannersShowStatisticsFilterByDate(ctx, from.Unix(), to.Unix())
-	if err != nil {
-		log.Println(err.Error())
-		// s.log.Error("can't get events", s.log.String("msg", err.Error()))
-		return
+		handled := make([]int64, 0, len(events))
+		var publishErr error
+		for _, e := range events {
+			eventCtx := tracing.WithTraceParent(ctx, e.TraceParent)
+			if publishErr = s.publish(eventCtx, NewStatisticEvent(e.Type, e.BannerStatistic)); publishErr != nil {
+				break
+			}
+			handled = append(handled, e.ID)
+		}
+
+		if len(handled) > 0 {
+			if err := s.storage.MarkOutboxSent(ctx, handled); err != nil {
+				return newError("can't mark outbox events as sent", err)
+			}
+		}
+
+		if publishErr != nil {
+			return publishErr
+		}
+		if len(events) < s.batchSize {
+			return nil
+		}
 	}
+}
 
-	clicks, err := s.storage.BannersClickStatisticsFilterByDate(ctx, from.Unix(), to.Unix())
+// ReplayDeadLetters - повторно отправляет до limit событий из dead-letter хранилища.
+// Останавливается на первой ошибке, чтобы не гонять события по кругу, пока проблема не исправлена.
+// Отправленные события удаляются пачками по replayDeleteBatch: если процесс упадет посреди пачки,
+// ее события будут отправлены повторно, потребители отбрасывают дубли по идентификатору события.
+func (s *Statistic) ReplayDeadLetters(ctx context.Context, limit int) (int, error) {
+	letters, err := s.deadLetters.DeadLetters(ctx, limit)
 	if err != nil {
-		log.Println(err.Error())
-		// s.log.Error("can't get events", s.log.String("msg", err.Error()))
-		return
+		return 0, newError("can't get dead letters", err)
 	}
 
-	for _, show := range shows {
-		data, err := json.Marshal(NewMQBannerStatistic(typeShow, show))
-		if err != nil {
-			s.log.Error("can't marshal event notification", s.log.String("msg", err.Error()))
-			continue
+	var (
+		replayed int
+		sent     []int64
+	)
+	deleteSent := func() error {
+		if len(sent) == 0 {
+			return nil
 		}
-		err = s.producer.Publish(data)
-		if err != nil {
-			s.log.Error("can't publish event notification", s.log.String("msg", err.Error()))
+		if err := s.deadLetters.DeleteDeadLetters(ctx, sent); err != nil {
+			return newError("can't delete replayed dead letters", err)
 		}
+		replayed += len(sent)
+		sent = sent[:0]
+		return nil
 	}
 
-	for _, click := range clicks {
-		data, err := json.Marshal(NewMQBannerStatistic(typeClick, click))
-		if err != nil {
-			s.log.Error("can't marshal event notification", s.log.String("msg", err.Error()))
-			continue
+	for _, letter := range letters {
+		if err := s.replay(ctx, letter); err != nil {
+			if deleteErr := deleteSent(); deleteErr != nil {
+				return replayed, deleteErr
+			}
+			return replayed, err
 		}
-		err = s.producer.Publish(data)
-		if err != nil {
-			s.log.Error("can't publish event notification", s.log.String("msg", err.Error()))
+		sent = append(sent, letter.ID)
+		if len(sent) >= replayDeleteBatch {
+			if err := deleteSent(); err != nil {
+				return replayed, err
+			}
 		}
 	}
+
+	return replayed, deleteSent()
+}
+
+func (s *Statistic) replay(ctx context.Context, letter DeadLetter) error {
+	msg, err := s.encoder.Encode(letter.Event)
+	if err != nil {
+		return newError("can't encode dead letter", err)
+	}
+	if err := s.sink.Publish(ctx, msg); err != nil {
+		return newError("can't publish dead letter", err)
+	}
+	return nil
+}
+
+// publish - отправляет событие, при ошибке кладет его в dead-letter хранилище.
+// Возвращает ошибку, только если событие не удалось сохранить ни там, ни там.
+func (s *Statistic) publish(ctx context.Context, event StatisticEvent) error {
+	ctx, span := tracer.Start(ctx, "Statistic.publish", trace.WithAttributes(
+		attribute.String("event_id", event.ID), attribute.String("type", string(event.Type)),
+	))
+	defer span.End()
+
+	msg, err := s.encoder.Encode(event)
+	if err != nil {
+		s.log.Error("can't encode event notification", s.log.String("msg", err.Error()))
+		span.RecordError(err)
+		s.metrics.PublishFailed()
+		return s.deadLetter(ctx, event, err)
+	}
+
+	err = s.sink.Publish(ctx, msg)
+	if err != nil {
+		s.log.Error("can't publish event notification", s.log.String("msg", err.Error()))
+		span.RecordError(err)
+		s.metrics.PublishFailed()
+		return s.deadLetter(ctx, event, err)
+	}
+	s.metrics.EventPublished()
+
+	return nil
+}
+
+func (s *Statistic) deadLetter(ctx context.Context, event StatisticEvent, reason error) error {
+	err := s.deadLetters.PutDeadLetter(ctx, DeadLetter{Event: event, Reason: reason.Error(), FailedAt: time.Now()})
+	if err != nil {
+		s.log.Error(
+			"can't save dead letter",
+			s.log.String("event_id", event.ID),
+			s.log.String("msg", err.Error()),
+		)
+		return newError("can't publish nor dead-letter event", err)
+	}
+
+	return nil
 }
 
 func startWorker(ctx context.Context, done chan struct{}, interval time.Duration, fn func()) {
@@ -0,0 +1,348 @@
+package app_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/nsmak/bannersRotation/internal/app"
+	"github.com/nsmak/bannersRotation/internal/event"
+	"github.com/stretchr/testify/suite"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var errSink = errors.New("sink error")
+
+type StatisticSuite struct {
+	suite.Suite
+	mockCtl     *gomock.Controller
+	mockStore   *MockStatisticStore
+	sink        *fakeSink
+	deadLetters *fakeDeadLetters
+	statistic   *app.Statistic
+}
+
+func (s *StatisticSuite) SetupTest() {
+	s.mockCtl = gomock.NewController(s.T())
+	s.mockStore = NewMockStatisticStore(s.mockCtl)
+	s.sink = &fakeSink{}
+	s.deadLetters = &fakeDeadLetters{}
+	s.statistic = app.NewStatistic(&mockLogger{}, s.mockStore, s.sink, event.JSONEncoder{}, s.deadLetters, nil, time.Second, 2)
+}
+
+func (s *StatisticSuite) TearDownTest() {
+	s.mockCtl.Finish()
+}
+
+func (s *StatisticSuite) TestRelayOutboxInBatches() {
+	ctx := context.Background()
+	gomock.InOrder(
+		s.mockStore.EXPECT().OutboxEvents(ctx, 2).Return(outboxEvents(1, 2), nil),
+		s.mockStore.EXPECT().MarkOutboxSent(ctx, []int64{1, 2}).Return(nil),
+		s.mockStore.EXPECT().OutboxEvents(ctx, 2).Return(outboxEvents(3), nil),
+		s.mockStore.EXPECT().MarkOutboxSent(ctx, []int64{3}).Return(nil),
+	)
+
+	err := s.statistic.RelayOutbox(ctx)
+
+	s.Require().NoError(err)
+	s.Require().Len(s.sink.published, 3)
+}
+
+func (s *StatisticSuite) TestRelayOutboxContinuesRequestTrace() {
+	ctx := context.Background()
+	events := outboxEvents(1)
+	events[0].TraceParent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	s.mockStore.EXPECT().OutboxEvents(ctx, 2).Return(events, nil)
+	s.mockStore.EXPECT().MarkOutboxSent(ctx, []int64{1}).Return(nil)
+
+	s.Require().NoError(s.statistic.RelayOutbox(ctx))
+	s.Require().Equal([]string{"4bf92f3577b34da6a3ce929d0e0e4736"}, s.sink.traceIDs)
+}
+
+func (s *StatisticSuite) TestRelayOutboxEmpty() {
+	ctx := context.Background()
+	s.mockStore.EXPECT().OutboxEvents(ctx, 2).Return(nil, nil)
+
+	s.Require().NoError(s.statistic.RelayOutbox(ctx))
+}
+
+func (s *StatisticSuite) TestFailedPublishGoesToDeadLetters() {
+	ctx := context.Background()
+	s.sink.err = errSink
+	s.mockStore.EXPECT().OutboxEvents(ctx, 2).Return(outboxEvents(7), nil)
+	s.mockStore.EXPECT().MarkOutboxSent(ctx, []int64{7}).Return(nil)
+
+	err := s.statistic.RelayOutbox(ctx)
+
+	s.Require().NoError(err)
+	letters, err := s.deadLetters.DeadLetters(ctx, 10)
+	s.Require().NoError(err)
+	s.Require().Len(letters, 1)
+	s.Require().Equal(int64(7), letters[0].Event.BannerID)
+	s.Require().Equal(errSink.Error(), letters[0].Reason)
+}
+
+func (s *StatisticSuite) TestUnsavedEventStaysInOutbox() {
+	ctx := context.Background()
+	s.mockStore.EXPECT().OutboxEvents(ctx, 2).Return(outboxEvents(1, 2), nil)
+	s.mockStore.EXPECT().MarkOutboxSent(ctx, []int64{1}).Return(nil)
+	s.sink.failAfter = 1
+	s.deadLetters.err = errStore
+
+	err := s.statistic.RelayOutbox(ctx)
+
+	s.Require().Error(err)
+	s.Require().True(errors.Is(err, errStore))
+	s.Require().Len(s.sink.published, 1)
+}
+
+func (s *StatisticSuite) TestRelayOutboxStoreFail() {
+	ctx := context.Background()
+	s.mockStore.EXPECT().OutboxEvents(ctx, 2).Return(nil, errStore)
+
+	err := s.statistic.RelayOutbox(ctx)
+
+	s.Require().Error(err)
+	s.Require().True(errors.Is(err, errStore))
+}
+
+func (s *StatisticSuite) TestReplayDeadLetters() {
+	ctx := context.Background()
+	for i := 0; i < 3; i++ {
+		e := app.StatisticEvent{ID: "id", SchemaVersion: 1, Type: "show", OccurredAt: time.Now(), BannerID: int64(i)}
+		s.Require().NoError(s.deadLetters.PutDeadLetter(ctx, app.DeadLetter{Event: e}))
+	}
+
+	replayed, err := s.statistic.ReplayDeadLetters(ctx, 10)
+
+	s.Require().NoError(err)
+	s.Require().Equal(3, replayed)
+	s.Require().Len(s.sink.published, 3)
+	s.Require().Equal(1, s.deadLetters.deletes)
+	letters, _ := s.deadLetters.DeadLetters(ctx, 10)
+	s.Require().Empty(letters)
+}
+
+func (s *StatisticSuite) TestReplayDeletesPublishedBeforeFailure() {
+	ctx := context.Background()
+	for i := 0; i < 3; i++ {
+		e := app.StatisticEvent{ID: "id", SchemaVersion: 1, Type: "show", OccurredAt: time.Now(), BannerID: int64(i)}
+		s.Require().NoError(s.deadLetters.PutDeadLetter(ctx, app.DeadLetter{Event: e}))
+	}
+	s.sink.failAfter = 2
+
+	replayed, err := s.statistic.ReplayDeadLetters(ctx, 0)
+
+	s.Require().True(errors.Is(err, errSink))
+	s.Require().Equal(2, replayed)
+	letters, _ := s.deadLetters.DeadLetters(ctx, 0)
+	s.Require().Len(letters, 1)
+	s.Require().Equal(int64(2), letters[0].Event.BannerID)
+}
+
+func (s *StatisticSuite) TestReplayStopsOnFailure() {
+	ctx := context.Background()
+	e := app.StatisticEvent{ID: "id", SchemaVersion: 1, Type: "show", OccurredAt: time.Now()}
+	s.Require().NoError(s.deadLetters.PutDeadLetter(ctx, app.DeadLetter{Event: e}))
+	s.Require().NoError(s.deadLetters.PutDeadLetter(ctx, app.DeadLetter{Event: e}))
+	s.sink.err = errSink
+
+	replayed, err := s.statistic.ReplayDeadLetters(ctx, 10)
+
+	s.Require().Error(err)
+	s.Require().True(errors.Is(err, errSink))
+	s.Require().Equal(0, replayed)
+	letters, _ := s.deadLetters.DeadLetters(ctx, 10)
+	s.Require().Len(letters, 2)
+}
+
+func (s *StatisticSuite) TestBackfillExportsWindows() {
+	ctx := context.Background()
+	from := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	to := from.Add(150 * time.Minute)
+	checkpoint := &fakeCheckpoint{}
+
+	gomock.InOrder(
+		s.mockStore.EXPECT().BannersShowStatisticsFilterByDate(ctx, from.Unix(), from.Add(time.Hour).Unix()).
+			Return([]app.BannerStatistic{{BannerID: 1, Date: float64(from.Unix())}}, nil),
+		s.mockStore.EXPECT().BannersClickStatisticsFilterByDate(ctx, from.Unix(), from.Add(time.Hour).Unix()).
+			Return(nil, nil),
+		s.mockStore.EXPECT().BannersShowStatisticsFilterByDate(ctx, from.Add(time.Hour).Unix(), from.Add(2*time.Hour).Unix()).
+			Return(nil, nil),
+		s.mockStore.EXPECT().BannersClickStatisticsFilterByDate(ctx, from.Add(time.Hour).Unix(), from.Add(2*time.Hour).Unix()).
+			Return([]app.BannerStatistic{{BannerID: 2}, {BannerID: 3}}, nil),
+		s.mockStore.EXPECT().BannersShowStatisticsFilterByDate(ctx, from.Add(2*time.Hour).Unix(), to.Unix()).
+			Return(nil, nil),
+		s.mockStore.EXPECT().BannersClickStatisticsFilterByDate(ctx, from.Add(2*time.Hour).Unix(), to.Unix()).
+			Return(nil, nil),
+	)
+
+	var progress []float64
+	err := s.statistic.Backfill(ctx, from, to, time.Hour, checkpoint, func(state app.BackfillState) {
+		progress = append(progress, state.Percent())
+	})
+
+	s.Require().NoError(err)
+	s.Require().Len(s.sink.published, 3)
+	s.Require().Equal(to, checkpoint.state.Done)
+	s.Require().Equal(int64(3), checkpoint.state.Published)
+	s.Require().Equal(100.0, progress[len(progress)-1])
+}
+
+func (s *StatisticSuite) TestBackfillResumesFromCheckpoint() {
+	ctx := context.Background()
+	from := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	to := from.Add(2 * time.Hour)
+	checkpoint := &fakeCheckpoint{
+		saved: true,
+		state: app.BackfillState{From: from, To: to, Done: from.Add(time.Hour), Published: 10},
+	}
+
+	s.mockStore.EXPECT().BannersShowStatisticsFilterByDate(ctx, from.Add(time.Hour).Unix(), to.Unix()).Return(nil, nil)
+	s.mockStore.EXPECT().BannersClickStatisticsFilterByDate(ctx, from.Add(time.Hour).Unix(), to.Unix()).
+		Return([]app.BannerStatistic{{BannerID: 1}}, nil)
+
+	err := s.statistic.Backfill(ctx, from, to, time.Hour, checkpoint, nil)
+
+	s.Require().NoError(err)
+	s.Require().Equal(int64(11), checkpoint.state.Published)
+}
+
+func (s *StatisticSuite) TestBackfillIgnoresCheckpointForOtherRange() {
+	ctx := context.Background()
+	from := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	to := from.Add(time.Hour)
+	checkpoint := &fakeCheckpoint{
+		saved: true,
+		state: app.BackfillState{From: from.Add(-time.Hour), To: to, Done: to.Add(-time.Minute)},
+	}
+
+	s.mockStore.EXPECT().BannersShowStatisticsFilterByDate(ctx, from.Unix(), to.Unix()).Return(nil, nil)
+	s.mockStore.EXPECT().BannersClickStatisticsFilterByDate(ctx, from.Unix(), to.Unix()).Return(nil, nil)
+
+	s.Require().NoError(s.statistic.Backfill(ctx, from, to, time.Hour, checkpoint, nil))
+}
+
+func (s *StatisticSuite) TestBackfillStorageFail() {
+	ctx := context.Background()
+	from := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	checkpoint := &fakeCheckpoint{}
+
+	s.mockStore.EXPECT().BannersShowStatisticsFilterByDate(ctx, gomock.Any(), gomock.Any()).Return(nil, errStore)
+
+	err := s.statistic.Backfill(ctx, from, from.Add(time.Hour), time.Hour, checkpoint, nil)
+
+	s.Require().Error(err)
+	s.Require().True(errors.Is(err, errStore))
+	s.Require().False(checkpoint.saved)
+}
+
+func TestStatisticSuite(t *testing.T) {
+	suite.Run(t, new(StatisticSuite))
+}
+
+type fakeSink struct {
+	mu        sync.Mutex
+	err       error
+	failAfter int
+	published []app.Message
+	traceIDs  []string
+}
+
+func (f *fakeSink) Publish(ctx context.Context, msg app.Message) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.traceIDs = append(f.traceIDs, trace.SpanContextFromContext(ctx).TraceID().String())
+
+	if f.err != nil {
+		return f.err
+	}
+	if f.failAfter > 0 && len(f.published) >= f.failAfter {
+		return errSink
+	}
+	f.published = append(f.published, msg)
+	return nil
+}
+
+func (f *fakeSink) Close() error {
+	return nil
+}
+
+type fakeDeadLetters struct {
+	mu      sync.Mutex
+	err     error
+	letters []app.DeadLetter
+	nextID  int64
+	deletes int
+}
+
+func (f *fakeDeadLetters) PutDeadLetter(_ context.Context, letter app.DeadLetter) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.err != nil {
+		return f.err
+	}
+	f.nextID++
+	letter.ID = f.nextID
+	f.letters = append(f.letters, letter)
+	return nil
+}
+
+func (f *fakeDeadLetters) DeadLetters(_ context.Context, limit int) ([]app.DeadLetter, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if limit <= 0 || len(f.letters) < limit {
+		limit = len(f.letters)
+	}
+	return append([]app.DeadLetter(nil), f.letters[:limit]...), nil
+}
+
+func (f *fakeDeadLetters) DeleteDeadLetters(_ context.Context, ids []int64) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.deletes++
+	for _, id := range ids {
+		for i, l := range f.letters {
+			if l.ID == id {
+				f.letters = append(f.letters[:i], f.letters[i+1:]...)
+				break
+			}
+		}
+	}
+	return nil
+}
+
+type fakeCheckpoint struct {
+	saved bool
+	state app.BackfillState
+}
+
+func (f *fakeCheckpoint) Load(_ context.Context) (app.BackfillState, bool, error) {
+	return f.state, f.saved, nil
+}
+
+func (f *fakeCheckpoint) Save(_ context.Context, state app.BackfillState) error {
+	f.saved = true
+	f.state = state
+	return nil
+}
+
+func outboxEvents(ids ...int64) []app.OutboxEvent {
+	events := make([]app.OutboxEvent, 0, len(ids))
+	for _, id := range ids {
+		events = append(events, app.OutboxEvent{
+			ID:              id,
+			Type:            app.StatTypeShow,
+			BannerStatistic: app.BannerStatistic{BannerID: id, SlotID: 1, SocialID: 1, Date: 1611007084},
+		})
+	}
+	return events
+}
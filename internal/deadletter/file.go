@@ -0,0 +1,185 @@
+package deadletter
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/nsmak/bannersRotation/internal/app"
+	"github.com/nsmak/bannersRotation/internal/event"
+)
+
+type deadLetterError struct {
+	app.BaseError
+}
+
+func newError(msg string, err error) *deadLetterError {
+	return &deadLetterError{BaseError: app.BaseError{Message: msg, Err: err}}
+}
+
+type record struct {
+	ID       int64           `json:"id"`
+	Event    json.RawMessage `json:"event"`
+	Reason   string          `json:"reason"`
+	FailedAt time.Time       `json:"failed_at"`
+}
+
+// FileStore хранит dead letters построчно в JSON-файле. Подходит для sink'ов без базы данных.
+type FileStore struct {
+	path   string
+	mu     sync.Mutex
+	nextID int64
+}
+
+func NewFileStore(path string) (*FileStore, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, newError("can't create dead letter dir", err)
+	}
+
+	s := &FileStore{path: path, nextID: 1}
+	records, err := s.read()
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range records {
+		if r.ID >= s.nextID {
+			s.nextID = r.ID + 1
+		}
+	}
+
+	return s, nil
+}
+
+func (s *FileStore) PutDeadLetter(_ context.Context, letter app.DeadLetter) error {
+	msg, err := event.JSONEncoder{}.Encode(letter.Event)
+	if err != nil {
+		return newError("can't encode dead letter event", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, err := json.Marshal(record{ID: s.nextID, Event: msg.Body, Reason: letter.Reason, FailedAt: letter.FailedAt})
+	if err != nil {
+		return newError("can't marshal dead letter", err)
+	}
+
+	file, err := os.OpenFile(s.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return newError("can't open dead letter file", err)
+	}
+	defer file.Close()
+
+	if _, err := file.Write(append(data, '\n')); err != nil {
+		return newError("can't write dead letter", err)
+	}
+	s.nextID++
+
+	return nil
+}
+
+func (s *FileStore) DeadLetters(_ context.Context, limit int) ([]app.DeadLetter, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	records, err := s.read()
+	if err != nil {
+		return nil, err
+	}
+	if limit > 0 && len(records) > limit {
+		records = records[:limit]
+	}
+
+	letters := make([]app.DeadLetter, 0, len(records))
+	for _, r := range records {
+		e, err := event.JSONEncoder{}.Decode(r.Event)
+		if err != nil {
+			return nil, newError("can't decode dead letter event", err)
+		}
+		letters = append(letters, app.DeadLetter{ID: r.ID, Event: e, Reason: r.Reason, FailedAt: r.FailedAt})
+	}
+
+	return letters, nil
+}
+
+// DeleteDeadLetters - файл переписывается целиком, поэтому удалять лучше сразу пачку.
+func (s *FileStore) DeleteDeadLetters(_ context.Context, ids []int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	deleted := make(map[int64]bool, len(ids))
+	for _, id := range ids {
+		deleted[id] = true
+	}
+
+	records, err := s.read()
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.Create(s.path + ".tmp")
+	if err != nil {
+		return newError("can't create temp dead letter file", err)
+	}
+	defer os.Remove(tmp.Name()) // nolint: errcheck
+
+	w := bufio.NewWriter(tmp)
+	for _, r := range records {
+		if deleted[r.ID] {
+			continue
+		}
+		data, err := json.Marshal(r)
+		if err != nil {
+			_ = tmp.Close()
+			return newError("can't marshal dead letter", err)
+		}
+		_, _ = w.Write(append(data, '\n'))
+	}
+	if err := w.Flush(); err != nil {
+		_ = tmp.Close()
+		return newError("can't write dead letters", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return newError("can't close temp dead letter file", err)
+	}
+
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		return newError("can't replace dead letter file", err)
+	}
+
+	return nil
+}
+
+func (s *FileStore) read() ([]record, error) {
+	file, err := os.Open(s.path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, newError("can't open dead letter file", err)
+	}
+	defer file.Close()
+
+	var records []record
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1<<20)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var r record
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			return nil, newError("can't parse dead letter file", err)
+		}
+		records = append(records, r)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, newError("can't read dead letter file", err)
+	}
+
+	return records, nil
+}
@@ -0,0 +1,54 @@
+package deadletter_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/nsmak/bannersRotation/internal/app"
+	"github.com/nsmak/bannersRotation/internal/deadletter"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileStore(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "dlq", "dead_letters.ndjson")
+	store, err := deadletter.NewFileStore(path)
+	require.NoError(t, err)
+
+	occurredAt := time.Date(2021, 2, 1, 10, 0, 0, 5000, time.UTC)
+	for i := int64(1); i <= 3; i++ {
+		e := app.StatisticEvent{ID: "e", SchemaVersion: 1, Type: "click", OccurredAt: occurredAt, BannerID: i}
+		require.NoError(t, store.PutDeadLetter(ctx, app.DeadLetter{Event: e, Reason: "broker down", FailedAt: occurredAt}))
+	}
+
+	letters, err := store.DeadLetters(ctx, 2)
+	require.NoError(t, err)
+	require.Len(t, letters, 2)
+	require.Equal(t, int64(1), letters[0].ID)
+	require.Equal(t, occurredAt, letters[0].Event.OccurredAt)
+	require.Equal(t, "broker down", letters[0].Reason)
+
+	require.NoError(t, store.DeleteDeadLetters(ctx, []int64{2}))
+
+	// Новый экземпляр продолжает нумерацию после перезапуска.
+	store, err = deadletter.NewFileStore(path)
+	require.NoError(t, err)
+	e := app.StatisticEvent{ID: "e", SchemaVersion: 1, Type: "show", OccurredAt: occurredAt}
+	require.NoError(t, store.PutDeadLetter(ctx, app.DeadLetter{Event: e}))
+
+	letters, err = store.DeadLetters(ctx, 10)
+	require.NoError(t, err)
+	ids := make([]int64, 0, len(letters))
+	for _, l := range letters {
+		ids = append(ids, l.ID)
+	}
+	require.Equal(t, []int64{1, 3, 4}, ids)
+
+	require.NoError(t, store.DeleteDeadLetters(ctx, []int64{1, 4}))
+	letters, err = store.DeadLetters(ctx, 0)
+	require.NoError(t, err)
+	require.Len(t, letters, 1)
+	require.Equal(t, int64(3), letters[0].ID)
+}
@@ -0,0 +1,58 @@
+package event
+
+import (
+	"github.com/nsmak/bannersRotation/internal/app"
+)
+
+const (
+	FormatJSON     = "json"
+	FormatProtobuf = "protobuf"
+
+	ContentTypeJSON     = "application/json"
+	ContentTypeProtobuf = "application/x-protobuf"
+)
+
+type eventError struct {
+	app.BaseError
+}
+
+func newError(msg string, err error) *eventError {
+	return &eventError{BaseError: app.BaseError{Message: msg, Err: err}}
+}
+
+var (
+	ErrUnknownFormat      = newError("unknown event format", nil)
+	ErrUnknownContentType = newError("unknown content type", nil)
+	ErrUnsupportedVersion = newError("unsupported schema version", nil)
+)
+
+// NewEncoder возвращает кодировщик событий для формата из конфига. Пустой формат означает JSON.
+func NewEncoder(format string) (app.EventEncoder, error) {
+	switch format {
+	case "", FormatJSON:
+		return JSONEncoder{}, nil
+	case FormatProtobuf:
+		return ProtobufEncoder{}, nil
+	default:
+		return nil, newError(format, ErrUnknownFormat)
+	}
+}
+
+// Decode восстанавливает событие из сообщения по его content type.
+func Decode(msg app.Message) (app.StatisticEvent, error) {
+	switch msg.ContentType {
+	case ContentTypeJSON:
+		return JSONEncoder{}.Decode(msg.Body)
+	case ContentTypeProtobuf:
+		return ProtobufEncoder{}.Decode(msg.Body)
+	default:
+		return app.StatisticEvent{}, newError(msg.ContentType, ErrUnknownContentType)
+	}
+}
+
+func checkVersion(event app.StatisticEvent) error {
+	if event.SchemaVersion < 1 || event.SchemaVersion > app.StatisticEventSchemaVersion {
+		return ErrUnsupportedVersion
+	}
+	return nil
+}
@@ -0,0 +1,107 @@
+package event_test
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/nsmak/bannersRotation/internal/app"
+	"github.com/nsmak/bannersRotation/internal/event"
+	"github.com/stretchr/testify/require"
+)
+
+func testEvent() app.StatisticEvent {
+	return app.StatisticEvent{
+		ID:            "5b0e3c5e-6d8e-4a8e-9e38-2f1d2c1f6a10",
+		SchemaVersion: app.StatisticEventSchemaVersion,
+		Type:          "click",
+		OccurredAt:    time.Date(2021, 1, 18, 21, 58, 4, 123456000, time.UTC),
+		BannerID:      1,
+		SlotID:        2,
+		SocialID:      3,
+	}
+}
+
+func TestEncodeDecode(t *testing.T) {
+	formats := map[string]string{
+		event.FormatJSON:     event.ContentTypeJSON,
+		event.FormatProtobuf: event.ContentTypeProtobuf,
+	}
+
+	for format, contentType := range formats {
+		format, contentType := format, contentType
+		t.Run(format, func(t *testing.T) {
+			enc, err := event.NewEncoder(format)
+			require.NoError(t, err)
+
+			msg, err := enc.Encode(testEvent())
+			require.NoError(t, err)
+			require.Equal(t, contentType, msg.ContentType)
+			require.Equal(t, testEvent().ID, msg.ID)
+
+			decoded, err := event.Decode(msg)
+			require.NoError(t, err)
+			require.Equal(t, testEvent(), decoded)
+		})
+	}
+}
+
+func TestJSONLayout(t *testing.T) {
+	msg, err := event.JSONEncoder{}.Encode(testEvent())
+	require.NoError(t, err)
+
+	var fields map[string]interface{}
+	require.NoError(t, json.Unmarshal(msg.Body, &fields))
+	require.Equal(t, "2021-01-18T21:58:04.123456Z", fields["occurred_at"])
+	require.Equal(t, float64(1), fields["schema_version"])
+	require.Equal(t, "click", fields["type"])
+}
+
+func TestDefaultFormatIsJSON(t *testing.T) {
+	enc, err := event.NewEncoder("")
+	require.NoError(t, err)
+	require.IsType(t, event.JSONEncoder{}, enc)
+}
+
+func TestUnknownFormat(t *testing.T) {
+	_, err := event.NewEncoder("xml")
+	require.Error(t, err)
+}
+
+func TestDecodeUnsupportedVersion(t *testing.T) {
+	e := testEvent()
+	e.SchemaVersion = app.StatisticEventSchemaVersion + 1
+	msg, err := event.ProtobufEncoder{}.Encode(e)
+	require.NoError(t, err)
+
+	_, err = event.Decode(msg)
+	require.Error(t, err)
+}
+
+func TestNewStatisticEventDate(t *testing.T) {
+	e := app.NewStatisticEvent("show", app.BannerStatistic{BannerID: 1, SlotID: 2, SocialID: 3, Date: 1611007084.123456})
+
+	require.Equal(t, time.Date(2021, 1, 18, 21, 58, 4, 123456000, time.UTC), e.OccurredAt)
+	require.Equal(t, int32(app.StatisticEventSchemaVersion), e.SchemaVersion)
+	require.NotEmpty(t, e.ID)
+
+	same := app.NewStatisticEvent("show", app.BannerStatistic{BannerID: 1, SlotID: 2, SocialID: 3, Date: 1611007084.123456})
+	other := app.NewStatisticEvent("click", app.BannerStatistic{BannerID: 1, SlotID: 2, SocialID: 3, Date: 1611007084.123456})
+	require.Equal(t, e.ID, same.ID)
+	require.NotEqual(t, e.ID, other.ID)
+}
+
+func TestNewStatisticEventIDFromEventID(t *testing.T) {
+	stat := app.BannerStatistic{EventID: 7, BannerID: 1, SlotID: 2, SocialID: 3, Date: 1611007084.123456}
+	e := app.NewStatisticEvent("show", stat)
+
+	// Два события в одну микросекунду различаются только id строки.
+	twin := stat
+	twin.EventID = 8
+	require.NotEqual(t, e.ID, app.NewStatisticEvent("show", twin).ID)
+
+	// Повторная выгрузка той же строки дает тот же ID, даже если дата прочитана с другой точностью.
+	stat.Date = 1611007084.1234561
+	require.Equal(t, e.ID, app.NewStatisticEvent("show", stat).ID)
+	require.NotEqual(t, e.ID, app.NewStatisticEvent("click", stat).ID)
+}
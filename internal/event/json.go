@@ -0,0 +1,65 @@
+package event
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/nsmak/bannersRotation/internal/app"
+)
+
+type jsonEvent struct {
+	EventID       string       `json:"event_id"`
+	SchemaVersion int32        `json:"schema_version"`
+	Type          app.StatType `json:"type"`
+	OccurredAt    string       `json:"occurred_at"`
+	BannerID      int64        `json:"banner_id"`
+	SlotID        int64        `json:"slot_id"`
+	SocialID      int64        `json:"social_id"`
+}
+
+type JSONEncoder struct{}
+
+func (JSONEncoder) Encode(event app.StatisticEvent) (app.Message, error) {
+	body, err := json.Marshal(jsonEvent{
+		EventID:       event.ID,
+		SchemaVersion: event.SchemaVersion,
+		Type:          event.Type,
+		OccurredAt:    event.OccurredAt.UTC().Format(time.RFC3339Nano),
+		BannerID:      event.BannerID,
+		SlotID:        event.SlotID,
+		SocialID:      event.SocialID,
+	})
+	if err != nil {
+		return app.Message{}, newError("can't marshal json event", err)
+	}
+
+	return app.Message{ID: event.ID, ContentType: ContentTypeJSON, Body: body}, nil
+}
+
+func (JSONEncoder) Decode(body []byte) (app.StatisticEvent, error) {
+	var e jsonEvent
+	if err := json.Unmarshal(body, &e); err != nil {
+		return app.StatisticEvent{}, newError("can't unmarshal json event", err)
+	}
+
+	occurredAt, err := time.Parse(time.RFC3339Nano, e.OccurredAt)
+	if err != nil {
+		return app.StatisticEvent{}, newError("invalid occurred_at", err)
+	}
+
+	event := app.StatisticEvent{
+		ID:            e.EventID,
+		SchemaVersion: e.SchemaVersion,
+		Type:          e.Type,
+		OccurredAt:    occurredAt,
+		BannerID:      e.BannerID,
+		SlotID:        e.SlotID,
+		SocialID:      e.SocialID,
+	}
+
+	if err := checkVersion(event); err != nil {
+		return app.StatisticEvent{}, err
+	}
+
+	return event, nil
+}
@@ -0,0 +1,153 @@
+package event
+
+import (
+	"time"
+
+	"github.com/nsmak/bannersRotation/internal/app"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// Номера полей из api/proto/statistic_event.proto.
+const (
+	fieldEventID       protowire.Number = 1
+	fieldSchemaVersion protowire.Number = 2
+	fieldType          protowire.Number = 3
+	fieldOccurredAt    protowire.Number = 4
+	fieldBannerID      protowire.Number = 5
+	fieldSlotID        protowire.Number = 6
+	fieldSocialID      protowire.Number = 7
+
+	fieldTimestampSeconds protowire.Number = 1
+	fieldTimestampNanos   protowire.Number = 2
+)
+
+var errMalformedProtobuf = newError("malformed protobuf event", nil)
+
+type ProtobufEncoder struct{}
+
+func (ProtobufEncoder) Encode(event app.StatisticEvent) (app.Message, error) {
+	var ts []byte
+	ts = protowire.AppendTag(ts, fieldTimestampSeconds, protowire.VarintType)
+	ts = protowire.AppendVarint(ts, uint64(event.OccurredAt.Unix()))
+	ts = protowire.AppendTag(ts, fieldTimestampNanos, protowire.VarintType)
+	ts = protowire.AppendVarint(ts, uint64(event.OccurredAt.Nanosecond()))
+
+	var b []byte
+	b = protowire.AppendTag(b, fieldEventID, protowire.BytesType)
+	b = protowire.AppendString(b, event.ID)
+	b = protowire.AppendTag(b, fieldSchemaVersion, protowire.VarintType)
+	b = protowire.AppendVarint(b, uint64(event.SchemaVersion))
+	b = protowire.AppendTag(b, fieldType, protowire.BytesType)
+	b = protowire.AppendString(b, string(event.Type))
+	b = protowire.AppendTag(b, fieldOccurredAt, protowire.BytesType)
+	b = protowire.AppendBytes(b, ts)
+	b = protowire.AppendTag(b, fieldBannerID, protowire.VarintType)
+	b = protowire.AppendVarint(b, uint64(event.BannerID))
+	b = protowire.AppendTag(b, fieldSlotID, protowire.VarintType)
+	b = protowire.AppendVarint(b, uint64(event.SlotID))
+	b = protowire.AppendTag(b, fieldSocialID, protowire.VarintType)
+	b = protowire.AppendVarint(b, uint64(event.SocialID))
+
+	return app.Message{ID: event.ID, ContentType: ContentTypeProtobuf, Body: b}, nil
+}
+
+func (ProtobufEncoder) Decode(body []byte) (app.StatisticEvent, error) {
+	var event app.StatisticEvent
+	for len(body) > 0 {
+		num, typ, n := protowire.ConsumeTag(body)
+		if n < 0 {
+			return app.StatisticEvent{}, newError("can't read tag", protowire.ParseError(n))
+		}
+		body = body[n:]
+
+		switch {
+		case num == fieldEventID && typ == protowire.BytesType:
+			v, n := protowire.ConsumeString(body)
+			if n < 0 {
+				return app.StatisticEvent{}, errMalformedProtobuf
+			}
+			event.ID = v
+			body = body[n:]
+		case num == fieldType && typ == protowire.BytesType:
+			v, n := protowire.ConsumeString(body)
+			if n < 0 {
+				return app.StatisticEvent{}, errMalformedProtobuf
+			}
+			event.Type = app.StatType(v)
+			body = body[n:]
+		case num == fieldOccurredAt && typ == protowire.BytesType:
+			v, n := protowire.ConsumeBytes(body)
+			if n < 0 {
+				return app.StatisticEvent{}, errMalformedProtobuf
+			}
+			occurredAt, err := decodeTimestamp(v)
+			if err != nil {
+				return app.StatisticEvent{}, err
+			}
+			event.OccurredAt = occurredAt
+			body = body[n:]
+		case typ == protowire.VarintType:
+			v, n := protowire.ConsumeVarint(body)
+			if n < 0 {
+				return app.StatisticEvent{}, errMalformedProtobuf
+			}
+			switch num {
+			case fieldSchemaVersion:
+				event.SchemaVersion = int32(v)
+			case fieldBannerID:
+				event.BannerID = int64(v)
+			case fieldSlotID:
+				event.SlotID = int64(v)
+			case fieldSocialID:
+				event.SocialID = int64(v)
+			}
+			body = body[n:]
+		default:
+			n := protowire.ConsumeFieldValue(num, typ, body)
+			if n < 0 {
+				return app.StatisticEvent{}, errMalformedProtobuf
+			}
+			body = body[n:]
+		}
+	}
+
+	if err := checkVersion(event); err != nil {
+		return app.StatisticEvent{}, err
+	}
+
+	return event, nil
+}
+
+func decodeTimestamp(b []byte) (time.Time, error) {
+	var sec, nsec int64
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return time.Time{}, errMalformedProtobuf
+		}
+		b = b[n:]
+
+		if typ != protowire.VarintType {
+			n := protowire.ConsumeFieldValue(num, typ, b)
+			if n < 0 {
+				return time.Time{}, errMalformedProtobuf
+			}
+			b = b[n:]
+			continue
+		}
+
+		v, n := protowire.ConsumeVarint(b)
+		if n < 0 {
+			return time.Time{}, errMalformedProtobuf
+		}
+		switch num {
+		case fieldTimestampSeconds:
+			sec = int64(v)
+		case fieldTimestampNanos:
+			nsec = int64(v)
+		}
+		b = b[n:]
+	}
+
+	return time.Unix(sec, nsec).UTC(), nil
+}
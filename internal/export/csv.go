@@ -0,0 +1,60 @@
+package export
+
+import (
+	"encoding/csv"
+	"io"
+
+	"github.com/nsmak/bannersRotation/internal/app"
+)
+
+// CSV - отчет в CSV с заголовком. Строки буферизуются и сбрасываются в w по мере заполнения буфера.
+type CSV struct {
+	w       *csv.Writer
+	columns columns
+	started bool
+}
+
+func NewCSV(w io.Writer, q app.ReportQuery) *CSV {
+	return &CSV{w: csv.NewWriter(w), columns: newColumns(q)}
+}
+
+func (c *CSV) WriteRow(row app.ReportRow) error {
+	if err := c.start(); err != nil {
+		return err
+	}
+
+	cells := c.columns.cells(row)
+	record := make([]string, len(cells))
+	for i, cell := range cells {
+		record[i] = cell.value
+	}
+	if err := c.w.Write(record); err != nil {
+		return newError("can't write csv row", err)
+	}
+	return nil
+}
+
+// Close - дописывает заголовок, если строк не было, и сбрасывает буфер. w не закрывается.
+func (c *CSV) Close() error {
+	if err := c.start(); err != nil {
+		return err
+	}
+
+	c.w.Flush()
+	if err := c.w.Error(); err != nil {
+		return newError("can't flush csv", err)
+	}
+	return nil
+}
+
+func (c *CSV) start() error {
+	if c.started {
+		return nil
+	}
+	c.started = true
+
+	if err := c.w.Write(c.columns.header()); err != nil {
+		return newError("can't write csv header", err)
+	}
+	return nil
+}
@@ -0,0 +1,130 @@
+package export
+
+import (
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/nsmak/bannersRotation/internal/app"
+)
+
+const (
+	FormatCSV  = "csv"
+	FormatXLSX = "xlsx"
+
+	ContentTypeCSV  = "text/csv; charset=utf-8"
+	ContentTypeXLSX = "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+)
+
+type exportError struct {
+	app.BaseError
+}
+
+func newError(msg string, err error) *exportError {
+	return &exportError{BaseError: app.BaseError{Message: msg, Err: err}}
+}
+
+var ErrUnknownFormat = &exportError{BaseError: app.BaseError{Message: "unknown export format", Code: app.CodeValidation}}
+
+// NewWriter возвращает запись отчета q в формате format. Пустой формат означает CSV.
+// Колонки - поля из q.GroupBy в порядке bucket, banner_id, slot_id, social_id, затем shows, clicks, ctr
+// и границы доверительного интервала CTR ctr_low и ctr_high. Ничего не пишется в w до первой строки или Close.
+func NewWriter(format string, w io.Writer, q app.ReportQuery) (app.ReportWriter, error) {
+	switch format {
+	case "", FormatCSV:
+		return NewCSV(w, q), nil
+	case FormatXLSX:
+		return NewXLSX(w, q), nil
+	default:
+		return nil, newError(format, ErrUnknownFormat)
+	}
+}
+
+// ContentType - MIME-тип файла формата.
+func ContentType(format string) string {
+	if format == FormatXLSX {
+		return ContentTypeXLSX
+	}
+	return ContentTypeCSV
+}
+
+// Extension - расширение файла формата.
+func Extension(format string) string {
+	if format == FormatXLSX {
+		return FormatXLSX
+	}
+	return FormatCSV
+}
+
+type cell struct {
+	value   string
+	numeric bool
+}
+
+type columns struct {
+	bucket, banner, slot, social bool
+	confidence                   float64
+}
+
+func newColumns(q app.ReportQuery) columns {
+	c := columns{confidence: q.Confidence}
+	if c.confidence == 0 {
+		c.confidence = app.DefaultReportConfidence
+	}
+	for _, dim := range q.GroupBy {
+		switch dim {
+		case app.ReportByBucket:
+			c.bucket = true
+		case app.ReportByBanner:
+			c.banner = true
+		case app.ReportBySlot:
+			c.slot = true
+		case app.ReportBySocial:
+			c.social = true
+		}
+	}
+	return c
+}
+
+func (c columns) header() []string {
+	var names []string
+	if c.bucket {
+		names = append(names, "bucket")
+	}
+	if c.banner {
+		names = append(names, "banner_id")
+	}
+	if c.slot {
+		names = append(names, "slot_id")
+	}
+	if c.social {
+		names = append(names, "social_id")
+	}
+	return append(names, "shows", "clicks", "ctr", "ctr_low", "ctr_high")
+}
+
+func (c columns) cells(row app.ReportRow) []cell {
+	var cells []cell
+	if c.bucket {
+		cells = append(cells, cell{value: row.Bucket.UTC().Format(time.RFC3339)})
+	}
+	if c.banner {
+		cells = append(cells, intCell(row.BannerID))
+	}
+	if c.slot {
+		cells = append(cells, intCell(row.SlotID))
+	}
+	if c.social {
+		cells = append(cells, intCell(row.SocialID))
+	}
+	low, high := row.CTRInterval(c.confidence)
+	return append(cells, intCell(row.Shows), intCell(row.Clicks), floatCell(row.CTR()), floatCell(low), floatCell(high))
+}
+
+func intCell(v int64) cell {
+	return cell{value: strconv.FormatInt(v, 10), numeric: true}
+}
+
+func floatCell(v float64) cell {
+	return cell{value: strconv.FormatFloat(v, 'f', 6, 64), numeric: true}
+}
@@ -0,0 +1,111 @@
+package export_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/nsmak/bannersRotation/internal/app"
+	"github.com/nsmak/bannersRotation/internal/export"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	query = app.ReportQuery{GroupBy: []app.ReportDimension{app.ReportBySlot, app.ReportByBucket}}
+	rows  = []app.ReportRow{
+		{Bucket: time.Date(2021, 2, 1, 0, 0, 0, 0, time.UTC), SlotID: 1, Shows: 8, Clicks: 2},
+		{Bucket: time.Date(2021, 2, 2, 0, 0, 0, 0, time.UTC), SlotID: 2, Shows: 0, Clicks: 0},
+	}
+)
+
+func writeAll(t *testing.T, w app.ReportWriter) {
+	for _, row := range rows {
+		require.NoError(t, w.WriteRow(row))
+	}
+	require.NoError(t, w.Close())
+}
+
+func TestCSV(t *testing.T) {
+	buf := &bytes.Buffer{}
+	w, err := export.NewWriter(export.FormatCSV, buf, query)
+	require.NoError(t, err)
+
+	writeAll(t, w)
+
+	require.Equal(t, "bucket,slot_id,shows,clicks,ctr,ctr_low,ctr_high\n"+
+		"2021-02-01T00:00:00Z,1,8,2,0.250000,0.071479,0.590725\n"+
+		"2021-02-02T00:00:00Z,2,0,0,0.000000,0.000000,1.000000\n", buf.String())
+}
+
+func TestCSVWithoutRows(t *testing.T) {
+	buf := &bytes.Buffer{}
+	w := export.NewCSV(buf, app.ReportQuery{})
+
+	require.Zero(t, buf.Len())
+	require.NoError(t, w.Close())
+	require.Equal(t, "shows,clicks,ctr,ctr_low,ctr_high\n", buf.String())
+}
+
+type xlsxSheet struct {
+	Rows []struct {
+		Cells []struct {
+			Type   string `xml:"t,attr"`
+			Value  string `xml:"v"`
+			Inline string `xml:"is>t"`
+		} `xml:"c"`
+	} `xml:"sheetData>row"`
+}
+
+func TestXLSX(t *testing.T) {
+	buf := &bytes.Buffer{}
+	w, err := export.NewWriter(export.FormatXLSX, buf, query)
+	require.NoError(t, err)
+
+	writeAll(t, w)
+
+	archive, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	require.NoError(t, err)
+
+	files := map[string][]byte{}
+	for _, f := range archive.File {
+		r, err := f.Open()
+		require.NoError(t, err)
+		files[f.Name], err = ioutil.ReadAll(r)
+		require.NoError(t, err)
+		require.NoError(t, r.Close())
+	}
+	require.Contains(t, files, "[Content_Types].xml")
+	require.Contains(t, files, "xl/workbook.xml")
+
+	var sheet xlsxSheet
+	require.NoError(t, xml.Unmarshal(files["xl/worksheets/sheet1.xml"], &sheet))
+	require.Len(t, sheet.Rows, 3)
+
+	var values [][]string
+	for _, row := range sheet.Rows {
+		var v []string
+		for _, c := range row.Cells {
+			if c.Type == "inlineStr" {
+				v = append(v, c.Inline)
+			} else {
+				v = append(v, c.Value)
+			}
+		}
+		values = append(values, v)
+	}
+	require.Equal(t, [][]string{
+		{"bucket", "slot_id", "shows", "clicks", "ctr", "ctr_low", "ctr_high"},
+		{"2021-02-01T00:00:00Z", "1", "8", "2", "0.250000", "0.071479", "0.590725"},
+		{"2021-02-02T00:00:00Z", "2", "0", "0", "0.000000", "0.000000", "1.000000"},
+	}, values)
+}
+
+func TestUnknownFormat(t *testing.T) {
+	_, err := export.NewWriter("pdf", &bytes.Buffer{}, query)
+
+	require.True(t, errors.Is(err, export.ErrUnknownFormat))
+}
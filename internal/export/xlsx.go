@@ -0,0 +1,146 @@
+package export
+
+import (
+	"archive/zip"
+	"bufio"
+	"encoding/xml"
+	"io"
+
+	"github.com/nsmak/bannersRotation/internal/app"
+)
+
+// Минимальная книга SpreadsheetML из одного листа. Лист пишется последним, поэтому строки
+// уходят в zip по мере поступления и файл целиком в памяти не собирается.
+var xlsxParts = []struct {
+	name    string
+	content string
+}{
+	{
+		name: "[Content_Types].xml",
+		content: xml.Header + `<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+			`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+			`<Default Extension="xml" ContentType="application/xml"/>` +
+			`<Override PartName="/xl/workbook.xml" ` +
+			`ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>` +
+			`<Override PartName="/xl/worksheets/sheet1.xml" ` +
+			`ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>` +
+			`</Types>`,
+	},
+	{
+		name: "_rels/.rels",
+		content: xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+			`<Relationship Id="rId1" ` +
+			`Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" ` +
+			`Target="xl/workbook.xml"/>` +
+			`</Relationships>`,
+	},
+	{
+		name: "xl/workbook.xml",
+		content: xml.Header + `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" ` +
+			`xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">` +
+			`<sheets><sheet name="Report" sheetId="1" r:id="rId1"/></sheets>` +
+			`</workbook>`,
+	},
+	{
+		name: "xl/_rels/workbook.xml.rels",
+		content: xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+			`<Relationship Id="rId1" ` +
+			`Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" ` +
+			`Target="worksheets/sheet1.xml"/>` +
+			`</Relationships>`,
+	},
+}
+
+const (
+	xlsxSheetName   = "xl/worksheets/sheet1.xml"
+	xlsxSheetHeader = xml.Header + `<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`
+	xlsxSheetFooter = `</sheetData></worksheet>`
+)
+
+// XLSX - отчет в Excel. Заголовок - первая строка листа, время интервала записано текстом в RFC3339.
+type XLSX struct {
+	zip     *zip.Writer
+	sheet   *bufio.Writer
+	columns columns
+	started bool
+}
+
+func NewXLSX(w io.Writer, q app.ReportQuery) *XLSX {
+	return &XLSX{zip: zip.NewWriter(w), columns: newColumns(q)}
+}
+
+func (x *XLSX) WriteRow(row app.ReportRow) error {
+	if err := x.start(); err != nil {
+		return err
+	}
+	return x.writeRow(x.columns.cells(row))
+}
+
+// Close - завершает лист и zip-архив. w не закрывается.
+func (x *XLSX) Close() error {
+	if err := x.start(); err != nil {
+		return err
+	}
+
+	if _, err := x.sheet.WriteString(xlsxSheetFooter); err != nil {
+		return newError("can't write xlsx sheet", err)
+	}
+	if err := x.sheet.Flush(); err != nil {
+		return newError("can't write xlsx sheet", err)
+	}
+	if err := x.zip.Close(); err != nil {
+		return newError("can't close xlsx", err)
+	}
+	return nil
+}
+
+func (x *XLSX) start() error {
+	if x.started {
+		return nil
+	}
+	x.started = true
+
+	for _, part := range xlsxParts {
+		f, err := x.zip.Create(part.name)
+		if err != nil {
+			return newError("can't create xlsx part "+part.name, err)
+		}
+		if _, err := io.WriteString(f, part.content); err != nil {
+			return newError("can't write xlsx part "+part.name, err)
+		}
+	}
+
+	f, err := x.zip.Create(xlsxSheetName)
+	if err != nil {
+		return newError("can't create xlsx sheet", err)
+	}
+	x.sheet = bufio.NewWriter(f)
+	if _, err := x.sheet.WriteString(xlsxSheetHeader); err != nil {
+		return newError("can't write xlsx sheet", err)
+	}
+
+	header := x.columns.header()
+	cells := make([]cell, len(header))
+	for i, name := range header {
+		cells[i] = cell{value: name}
+	}
+	return x.writeRow(cells)
+}
+
+func (x *XLSX) writeRow(cells []cell) error {
+	_, _ = x.sheet.WriteString("<row>")
+	for _, c := range cells {
+		if c.numeric {
+			_, _ = x.sheet.WriteString(`<c><v>` + c.value + `</v></c>`)
+			continue
+		}
+		_, _ = x.sheet.WriteString(`<c t="inlineStr"><is><t>`)
+		_ = xml.EscapeText(x.sheet, []byte(c.value))
+		_, _ = x.sheet.WriteString(`</t></is></c>`)
+	}
+	// bufio.Writer запоминает первую ошибку записи и возвращает ее на каждой следующей.
+	if _, err := x.sheet.WriteString("</row>"); err != nil {
+		return newError("can't write xlsx row", err)
+	}
+	return nil
+}
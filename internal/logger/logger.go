@@ -1,9 +1,11 @@
 package logger
 
 import (
+	"context"
 	"fmt"
 	"time"
 
+	"github.com/nsmak/bannersRotation/internal/app"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 )
@@ -26,6 +28,13 @@ func New(level int8, logFilePath string) (*Logger, error) {
 	return &Logger{logger: logger}, nil
 }
 
+func (l *Logger) WithContext(ctx context.Context) app.Logger {
+	if id := app.RequestID(ctx); id != "" {
+		return &Logger{logger: l.logger.With(zap.String("request_id", id))}
+	}
+	return l
+}
+
 func (l *Logger) Info(msg string, fields ...zap.Field) {
 	l.logger.Info(msg, fields...)
 }
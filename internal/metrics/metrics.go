@@ -0,0 +1,165 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/nsmak/bannersRotation/internal/app"
+	"github.com/nsmak/bannersRotation/internal/server/rest"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "banners"
+
+// Metrics - метрики сервиса в формате Prometheus. Реализует app.RotatorMetrics, app.StatisticMetrics
+// и rest.Metrics; у каждого сервиса свой реестр, поэтому в /metrics попадают только его метрики.
+type Metrics struct {
+	registry *prometheus.Registry
+	labels   prometheus.Labels
+
+	requests        *prometheus.CounterVec
+	requestDuration *prometheus.HistogramVec
+	panics          *prometheus.CounterVec
+	queryDuration   *prometheus.HistogramVec
+	selections      *prometheus.CounterVec
+	writeErrors     *prometheus.CounterVec
+	published       prometheus.Counter
+	publishFailures prometheus.Counter
+	exportLag       prometheus.Gauge
+}
+
+// New - service попадает в метку service всех метрик.
+func New(service string) *Metrics {
+	labels := prometheus.Labels{"service": service}
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		labels:   labels,
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace:   namespace,
+			Name:        "http_requests_total",
+			Help:        "HTTP requests by route and status code.",
+			ConstLabels: labels,
+		}, []string{"route", "code"}),
+		requestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace:   namespace,
+			Name:        "http_request_duration_seconds",
+			Help:        "HTTP request latency by route.",
+			ConstLabels: labels,
+			Buckets:     prometheus.DefBuckets,
+		}, []string{"route"}),
+		panics: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace:   namespace,
+			Name:        "http_panics_total",
+			Help:        "Handler panics recovered by route.",
+			ConstLabels: labels,
+		}, []string{"route"}),
+		queryDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace:   namespace,
+			Name:        "storage_query_duration_seconds",
+			Help:        "Storage call latency by method and result.",
+			ConstLabels: labels,
+			Buckets:     []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5},
+		}, []string{"method", "result"}),
+		selections: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace:   namespace,
+			Name:        "banner_selections_total",
+			Help:        "Banners selected by the bandit by slot and banner.",
+			ConstLabels: labels,
+		}, []string{"slot_id", "banner_id"}),
+		writeErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace:   namespace,
+			Name:        "event_write_errors_total",
+			Help:        "Views and clicks that couldn't be written.",
+			ConstLabels: labels,
+		}, []string{"type"}),
+		published: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace:   namespace,
+			Name:        "statistic_events_published_total",
+			Help:        "Statistic events published to the sink.",
+			ConstLabels: labels,
+		}),
+		publishFailures: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace:   namespace,
+			Name:        "statistic_publish_failures_total",
+			Help:        "Statistic events that couldn't be encoded or published.",
+			ConstLabels: labels,
+		}),
+		exportLag: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace:   namespace,
+			Name:        "statistic_export_lag_seconds",
+			Help:        "Age of the oldest statistic event not yet published, 0 when the outbox is empty.",
+			ConstLabels: labels,
+		}),
+	}
+
+	m.registry.MustRegister(
+		prometheus.NewGoCollector(),
+		prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}),
+		m.requests,
+		m.requestDuration,
+		m.panics,
+		m.queryDuration,
+		m.selections,
+		m.writeErrors,
+		m.published,
+		m.publishFailures,
+		m.exportLag,
+	)
+	return m
+}
+
+// Handler - обработчик /metrics.
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+func (m *Metrics) ObserveRequest(route string, status int, duration time.Duration) {
+	m.requests.WithLabelValues(route, strconv.Itoa(status)).Inc()
+	m.requestDuration.WithLabelValues(route).Observe(duration.Seconds())
+}
+
+func (m *Metrics) RecoveredPanic(route string) {
+	m.panics.WithLabelValues(route).Inc()
+}
+
+func (m *Metrics) ObserveQuery(method string, duration time.Duration, err error) {
+	result := "ok"
+	if err != nil {
+		result = "error"
+	}
+	m.queryDuration.WithLabelValues(method, result).Observe(duration.Seconds())
+}
+
+func (m *Metrics) BannerSelected(slotID, bannerID int64) {
+	m.selections.WithLabelValues(strconv.FormatInt(slotID, 10), strconv.FormatInt(bannerID, 10)).Inc()
+}
+
+func (m *Metrics) EventWriteFailed(statType app.StatType) {
+	m.writeErrors.WithLabelValues(string(statType)).Inc()
+}
+
+func (m *Metrics) EventPublished() {
+	m.published.Inc()
+}
+
+func (m *Metrics) PublishFailed() {
+	m.publishFailures.Inc()
+}
+
+func (m *Metrics) ExportLag(lag time.Duration) {
+	m.exportLag.Set(lag.Seconds())
+}
+
+// Routes - маршрут /metrics для rest.Server.
+func (m *Metrics) Routes() []rest.Route {
+	return []rest.Route{
+		{
+			Name:   "Metrics",
+			Method: http.MethodGet,
+			Path:   "/metrics",
+			Func:   m.Handler().ServeHTTP,
+		},
+	}
+}
@@ -0,0 +1,90 @@
+package metrics_test
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/nsmak/bannersRotation/internal/app"
+	"github.com/nsmak/bannersRotation/internal/metrics"
+	"github.com/nsmak/bannersRotation/internal/storage/memory"
+	sqlstorage "github.com/nsmak/bannersRotation/internal/storage/sql"
+	"github.com/stretchr/testify/require"
+)
+
+func scrape(t *testing.T, m *metrics.Metrics) string {
+	rec := httptest.NewRecorder()
+	m.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	body, err := ioutil.ReadAll(rec.Body)
+	require.NoError(t, err)
+	return string(body)
+}
+
+func TestMetrics(t *testing.T) {
+	m := metrics.New("rotator")
+
+	m.ObserveRequest("GetBanner", http.StatusOK, 20*time.Millisecond)
+	m.ObserveRequest("GetBanner", http.StatusOK, 30*time.Millisecond)
+	m.ObserveRequest("GetBanner", http.StatusBadRequest, time.Millisecond)
+	m.RecoveredPanic("GetBanner")
+	m.BannerSelected(1, 2)
+	m.EventWriteFailed(app.StatTypeClick)
+	m.EventPublished()
+	m.PublishFailed()
+	m.ExportLag(90 * time.Second)
+
+	body := scrape(t, m)
+	require.Contains(t, body, `banners_http_requests_total{code="200",route="GetBanner",service="rotator"} 2`)
+	require.Contains(t, body, `banners_http_requests_total{code="400",route="GetBanner",service="rotator"} 1`)
+	require.Contains(t, body, `banners_http_request_duration_seconds_count{route="GetBanner",service="rotator"} 3`)
+	require.Contains(t, body, `banners_http_panics_total{route="GetBanner",service="rotator"} 1`)
+	require.Contains(t, body, `banners_banner_selections_total{banner_id="2",service="rotator",slot_id="1"} 1`)
+	require.Contains(t, body, `banners_event_write_errors_total{service="rotator",type="click"} 1`)
+	require.Contains(t, body, `banners_statistic_events_published_total{service="rotator"} 1`)
+	require.Contains(t, body, `banners_statistic_publish_failures_total{service="rotator"} 1`)
+	require.Contains(t, body, `banners_statistic_export_lag_seconds{service="rotator"} 90`)
+}
+
+func TestStorage(t *testing.T) {
+	m := metrics.New("rotator")
+	store := memory.New()
+	store.LoadDefaults()
+	s := metrics.NewStorage(store, m)
+
+	require.NoError(t, s.AddBannerToSlot(context.Background(), 1, 1))
+	require.NoError(t, s.AddViewForBanner(context.Background(), 1, 1, 1))
+	require.Error(t, s.AddViewForBanner(context.Background(), 100, 1, 1))
+
+	body := scrape(t, m)
+	require.Contains(t, body, `banners_storage_query_duration_seconds_count{method="AddViewForBanner",result="ok",service="rotator"} 1`)
+	require.Contains(t, body, `banners_storage_query_duration_seconds_count{method="AddViewForBanner",result="error",service="rotator"} 1`)
+	require.Contains(t, body, `banners_storage_query_duration_seconds_count{method="AddBannerToSlot",result="ok",service="rotator"} 1`)
+}
+
+type fakePools []sqlstorage.PoolStats
+
+func (f fakePools) PoolStats() []sqlstorage.PoolStats {
+	return f
+}
+
+func TestRegisterPools(t *testing.T) {
+	m := metrics.New("statistic")
+	m.RegisterPools(fakePools{
+		{Address: "primary", OpenConns: 5, InUse: 3, Idle: 2, WaitCount: 7, WaitDuration: 1500 * time.Millisecond},
+		{Address: "replica:5432", OpenConns: 1, Idle: 1, MaxIdleClosed: 4, MaxLifetimeClosed: 2},
+	})
+
+	body := scrape(t, m)
+	require.Contains(t, body, `banners_db_pool_open_connections{address="primary",service="statistic"} 5`)
+	require.Contains(t, body, `banners_db_pool_in_use_connections{address="primary",service="statistic"} 3`)
+	require.Contains(t, body, `banners_db_pool_idle_connections{address="replica:5432",service="statistic"} 1`)
+	require.Contains(t, body, `banners_db_pool_wait_count_total{address="primary",service="statistic"} 7`)
+	require.Contains(t, body, `banners_db_pool_wait_duration_seconds_total{address="primary",service="statistic"} 1.5`)
+	require.Contains(t, body, `banners_db_pool_max_idle_closed_total{address="replica:5432",service="statistic"} 4`)
+	require.Contains(t, body, `banners_db_pool_max_lifetime_closed_total{address="replica:5432",service="statistic"} 2`)
+}
@@ -0,0 +1,71 @@
+package metrics
+
+import (
+	sqlstorage "github.com/nsmak/bannersRotation/internal/storage/sql"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// PoolSource - хранилище с пулами соединений, например sqlstorage.BannerDataStore.
+type PoolSource interface {
+	PoolStats() []sqlstorage.PoolStats
+}
+
+// poolCollector - состояние пулов читается при каждом запросе /metrics, метка address - primary или адрес реплики.
+type poolCollector struct {
+	source PoolSource
+
+	open              *prometheus.Desc
+	inUse             *prometheus.Desc
+	idle              *prometheus.Desc
+	waitCount         *prometheus.Desc
+	waitDuration      *prometheus.Desc
+	maxIdleClosed     *prometheus.Desc
+	maxLifetimeClosed *prometheus.Desc
+}
+
+// RegisterPools - добавляет в /metrics состояние пулов соединений source.
+func (m *Metrics) RegisterPools(source PoolSource) {
+	desc := func(name, help string) *prometheus.Desc {
+		return prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "db_pool", name), help, []string{"address"}, m.labels,
+		)
+	}
+	m.registry.MustRegister(&poolCollector{
+		source:            source,
+		open:              desc("open_connections", "Open connections, in use and idle."),
+		inUse:             desc("in_use_connections", "Connections currently in use."),
+		idle:              desc("idle_connections", "Idle connections."),
+		waitCount:         desc("wait_count_total", "Connections waited for because the pool was exhausted."),
+		waitDuration:      desc("wait_duration_seconds_total", "Time spent waiting for a connection."),
+		maxIdleClosed:     desc("max_idle_closed_total", "Connections closed because of max_idle_conns."),
+		maxLifetimeClosed: desc("max_lifetime_closed_total", "Connections closed because of conn_max_lifetime_sec."),
+	})
+}
+
+func (c *poolCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.open
+	ch <- c.inUse
+	ch <- c.idle
+	ch <- c.waitCount
+	ch <- c.waitDuration
+	ch <- c.maxIdleClosed
+	ch <- c.maxLifetimeClosed
+}
+
+func (c *poolCollector) Collect(ch chan<- prometheus.Metric) {
+	for _, st := range c.source.PoolStats() {
+		ch <- prometheus.MustNewConstMetric(c.open, prometheus.GaugeValue, float64(st.OpenConns), st.Address)
+		ch <- prometheus.MustNewConstMetric(c.inUse, prometheus.GaugeValue, float64(st.InUse), st.Address)
+		ch <- prometheus.MustNewConstMetric(c.idle, prometheus.GaugeValue, float64(st.Idle), st.Address)
+		ch <- prometheus.MustNewConstMetric(c.waitCount, prometheus.CounterValue, float64(st.WaitCount), st.Address)
+		ch <- prometheus.MustNewConstMetric(
+			c.waitDuration, prometheus.CounterValue, st.WaitDuration.Seconds(), st.Address,
+		)
+		ch <- prometheus.MustNewConstMetric(
+			c.maxIdleClosed, prometheus.CounterValue, float64(st.MaxIdleClosed), st.Address,
+		)
+		ch <- prometheus.MustNewConstMetric(
+			c.maxLifetimeClosed, prometheus.CounterValue, float64(st.MaxLifetimeClosed), st.Address,
+		)
+	}
+}
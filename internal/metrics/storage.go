@@ -0,0 +1,70 @@
+package metrics
+
+import (
+	"context"
+	"time"
+
+	"github.com/nsmak/bannersRotation/internal/app"
+)
+
+// Storage - измеряет время вызовов хранилища по методам.
+type Storage struct {
+	store   app.Storage
+	metrics *Metrics
+}
+
+func NewStorage(store app.Storage, metrics *Metrics) *Storage {
+	return &Storage{store: store, metrics: metrics}
+}
+
+func (s *Storage) AddBannerToSlot(ctx context.Context, bannerID, slotID int64) error {
+	start := time.Now()
+	err := s.store.AddBannerToSlot(ctx, bannerID, slotID)
+	s.metrics.ObserveQuery("AddBannerToSlot", time.Since(start), err)
+	return err
+}
+
+func (s *Storage) RemoveBannerFromSlot(ctx context.Context, bannerID, slotID int64) error {
+	start := time.Now()
+	err := s.store.RemoveBannerFromSlot(ctx, bannerID, slotID)
+	s.metrics.ObserveQuery("RemoveBannerFromSlot", time.Since(start), err)
+	return err
+}
+
+func (s *Storage) BannersStatistics(ctx context.Context, slotID, socialID int64) ([]app.BannerSummary, error) {
+	start := time.Now()
+	stats, err := s.store.BannersStatistics(ctx, slotID, socialID)
+	s.metrics.ObserveQuery("BannersStatistics", time.Since(start), err)
+	return stats, err
+}
+
+func (s *Storage) AddViewForBanner(ctx context.Context, bannerID, slotID, socialID int64) error {
+	start := time.Now()
+	err := s.store.AddViewForBanner(ctx, bannerID, slotID, socialID)
+	s.metrics.ObserveQuery("AddViewForBanner", time.Since(start), err)
+	return err
+}
+
+func (s *Storage) AddClickForBanner(ctx context.Context, bannerID, slotID, socialID int64) error {
+	start := time.Now()
+	err := s.store.AddClickForBanner(ctx, bannerID, slotID, socialID)
+	s.metrics.ObserveQuery("AddClickForBanner", time.Since(start), err)
+	return err
+}
+
+// EventBatchWriter - измеряет время записи пачек событий.
+type EventBatchWriter struct {
+	writer  app.EventBatchWriter
+	metrics *Metrics
+}
+
+func NewEventBatchWriter(writer app.EventBatchWriter, metrics *Metrics) *EventBatchWriter {
+	return &EventBatchWriter{writer: writer, metrics: metrics}
+}
+
+func (w *EventBatchWriter) AddEvents(ctx context.Context, events []app.BannerEvent) error {
+	start := time.Now()
+	err := w.writer.AddEvents(ctx, events)
+	w.metrics.ObserveQuery("AddEvents", time.Since(start), err)
+	return err
+}
@@ -1,15 +1,24 @@
 package rabbit
 
 import (
+	"context"
 	"fmt"
+	"sync"
+	"time"
 
 	"github.com/nsmak/bannersRotation/cmd/config"
+	"github.com/nsmak/bannersRotation/internal/app"
+	"github.com/nsmak/bannersRotation/internal/tracing"
 	"github.com/streadway/amqp"
+	"go.opentelemetry.io/otel"
+	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type Producer struct {
 	cfg     config.Rabbit
 	conn    *amqp.Connection
+	mu      sync.Mutex
 	channel *amqp.Channel
 }
 
@@ -22,45 +31,101 @@ func NewProducer(cfg config.Rabbit) (*Producer, error) {
 	return &Producer{conn: conn, cfg: cfg}, nil
 }
 
-func (p *Producer) CloseConn() error {
-	return p.conn.Close()
-}
+var tracer = otel.Tracer("github.com/nsmak/bannersRotation/internal/mq/rabbit")
+
+// Publish - контекст трассировки ctx передается потребителям в заголовке traceparent сообщения.
+func (p *Producer) Publish(ctx context.Context, msg app.Message) (err error) {
+	ctx, span := tracer.Start(
+		ctx,
+		p.cfg.ExchangeName+" send",
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(
+			semconv.MessagingSystemKey.String("rabbitmq"),
+			semconv.MessagingDestinationKey.String(p.cfg.ExchangeName),
+			semconv.MessagingRabbitmqRoutingKeyKey.String(p.cfg.RoutingKey),
+			semconv.MessagingMessageIDKey.String(msg.ID),
+		),
+	)
+	defer func() { tracing.End(span, err) }()
+
+	carrier := tracing.Carrier{}
+	tracing.Inject(ctx, carrier)
+	headers := amqp.Table{}
+	for k, v := range carrier {
+		headers[k] = v
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
 
-func (p *Producer) Publish(body []byte) error {
 	if p.channel == nil {
-		return ErrChannelIsNil
+		channel, err := declareChannel(p.cfg, p.conn)
+		if err != nil {
+			return newError("can't create channel", err)
+		}
+		p.channel = channel
 	}
 
-	err := p.channel.Publish(
+	err = p.channel.Publish(
 		p.cfg.ExchangeName,
 		p.cfg.RoutingKey,
 		false,
 		false,
 		amqp.Publishing{
-			Headers:         amqp.Table{},
-			ContentType:     "application/json",
-			ContentEncoding: "utf8",
-			Body:            body,
-			DeliveryMode:    amqp.Persistent,
-			Priority:        0,
+			Headers:      headers,
+			ContentType:  msg.ContentType,
+			MessageId:    msg.ID,
+			Timestamp:    time.Now(),
+			Body:         msg.Body,
+			DeliveryMode: amqp.Persistent,
+			Priority:     0,
 		},
 	)
 	if err != nil {
+		// После ошибки канал закрывается брокером, следующая публикация откроет новый.
+		_ = p.channel.Close()
+		p.channel = nil
 		return newError("can't publish", err)
 	}
 
 	return nil
 }
 
-func (p *Producer) OpenChannel() error {
-	var err error
-	p.channel, err = declareChannel(p.cfg, p.conn)
-	if err != nil {
-		return newError("can't create channel", err)
+// Ping - открывает и закрывает канал, чтобы проверить и соединение, и ответ брокера.
+// Producer не переподключается, поэтому после разрыва сервис нужно перезапустить.
+func (p *Producer) Ping(ctx context.Context) error {
+	if p.conn.IsClosed() {
+		return newError("connection is closed", nil)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		channel, err := p.conn.Channel()
+		if err != nil {
+			done <- err
+			return
+		}
+		done <- channel.Close()
+	}()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			return newError("can't open channel", err)
+		}
+		return nil
+	case <-ctx.Done():
+		return newError("can't open channel", ctx.Err())
 	}
-	return nil
 }
 
-func (p *Producer) CloseChannel() error {
-	return p.channel.Close()
+func (p *Producer) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.channel != nil {
+		_ = p.channel.Close()
+		p.channel = nil
+	}
+	return p.conn.Close()
 }
@@ -1,6 +1,8 @@
 package rabbit
 
 import (
+	"errors"
+
 	"github.com/nsmak/bannersRotation/cmd/config"
 	"github.com/nsmak/bannersRotation/internal/app"
 	"github.com/streadway/amqp"
@@ -12,7 +14,7 @@ type mqError struct {
 
 func (e *mqError) Error() string {
 	if e.Err != nil {
-		e.Message = "[rmq] " + e.Message + " --> " + e.Err.Error()
+		return "[rmq] " + e.Message + " --> " + e.Err.Error()
 	}
 	return e.Message
 }
@@ -21,8 +23,6 @@ func newError(msg string, err error) *mqError {
 	return &mqError{BaseError: app.BaseError{Message: msg, Err: err}}
 }
 
-var ErrChannelIsNil = newError("channel is nil", nil)
-
 func declareChannel(cfg config.Rabbit, conn *amqp.Connection) (*amqp.Channel, error) {
 	channel, err := conn.Channel()
 	if err != nil {
@@ -41,5 +41,77 @@ func declareChannel(cfg config.Rabbit, conn *amqp.Connection) (*amqp.Channel, er
 		return nil, newError("can't declare exchange", err)
 	}
 
+	if cfg.DeadLetterExchange != "" {
+		if err := declareDeadLetterQueue(cfg, conn, channel); err != nil {
+			return nil, err
+		}
+	}
+
 	return channel, nil
 }
+
+// declareDeadLetterQueue объявляет очередь статистики с DLX: сообщения, которые потребитель
+// отклонил или которые истекли, уходят в dead_letter_queue, а не теряются.
+// Аргументы существующей очереди не меняются: повторное объявление с другими аргументами брокер отклоняет
+// с PRECONDITION_FAILED и закрывает канал, поэтому такой очереди DLX задается политикой брокера.
+func declareDeadLetterQueue(cfg config.Rabbit, conn *amqp.Connection, channel *amqp.Channel) error {
+	err := channel.ExchangeDeclare(cfg.DeadLetterExchange, amqp.ExchangeFanout, true, false, false, false, nil)
+	if err != nil {
+		return newError("can't declare dead letter exchange", err)
+	}
+
+	_, err = channel.QueueDeclare(cfg.DeadLetterQueue, true, false, false, false, nil)
+	if err != nil {
+		return newError("can't declare dead letter queue", err)
+	}
+
+	err = channel.QueueBind(cfg.DeadLetterQueue, "", cfg.DeadLetterExchange, false, nil)
+	if err != nil {
+		return newError("can't bind dead letter queue", err)
+	}
+
+	exists, err := queueExists(conn, cfg.QueueName)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		_, err = channel.QueueDeclare(
+			cfg.QueueName,
+			true,
+			false,
+			false,
+			false,
+			amqp.Table{"x-dead-letter-exchange": cfg.DeadLetterExchange},
+		)
+		if err != nil {
+			return newError("can't declare queue", err)
+		}
+	}
+
+	err = channel.QueueBind(cfg.QueueName, cfg.RoutingKey, cfg.ExchangeName, false, nil)
+	if err != nil {
+		return newError("can't bind queue", err)
+	}
+
+	return nil
+}
+
+// queueExists - пассивное объявление идет через отдельный канал: если очереди нет, брокер закрывает канал.
+func queueExists(conn *amqp.Connection, name string) (bool, error) {
+	channel, err := conn.Channel()
+	if err != nil {
+		return false, newError("can't get channel", err)
+	}
+
+	_, err = channel.QueueDeclarePassive(name, true, false, false, false, nil)
+	if err == nil {
+		_ = channel.Close()
+		return true, nil
+	}
+
+	var amqpErr *amqp.Error
+	if errors.As(err, &amqpErr) && amqpErr.Code == amqp.NotFound {
+		return false, nil
+	}
+	return false, newError("can't check queue", err)
+}
@@ -4,11 +4,13 @@ import (
 	"encoding/json"
 	"errors"
 	"net/http"
+	"strings"
+	"time"
 
 	"github.com/gorilla/schema"
 	"github.com/nsmak/bannersRotation/internal/app"
+	"github.com/nsmak/bannersRotation/internal/export"
 	"github.com/nsmak/bannersRotation/internal/server/rest"
-	"github.com/nsmak/bannersRotation/internal/storage"
 )
 
 type BannerSlotForm struct {
@@ -21,18 +23,55 @@ type BannerForSlotForm struct {
 	SocDemID int64 `schema:"soc_dem_id"`
 }
 
+// Как часто поток статистики шлет комментарий, чтобы прокси не закрывали простаивающее соединение.
+const streamHeartbeat = 15 * time.Second
+
+type StatsStreamForm struct {
+	SlotID int64 `schema:"slot_id"`
+}
+
 type BannerClickFrom struct {
 	BannerID int64 `json:"banner_id"`
 	SlotID   int64 `json:"slot_id"`
 	SocDemID int64 `json:"soc_dem_id"`
 }
 
+// ReportFilterForm - общие параметры отчета и выгрузки. group_by - измерения через запятую: banner, slot, social, bucket.
+type ReportFilterForm struct {
+	From       string  `schema:"from"`
+	To         string  `schema:"to"`
+	GroupBy    string  `schema:"group_by"`
+	Bucket     string  `schema:"bucket"`
+	BannerID   int64   `schema:"banner_id"`
+	SlotID     int64   `schema:"slot_id"`
+	SocialID   int64   `schema:"social_id"`
+	Confidence float64 `schema:"confidence"`
+}
+
+// ReportForm - параметры GET /reports.
+type ReportForm struct {
+	ReportFilterForm
+	Sort    string `schema:"sort"`
+	Limit   int    `schema:"limit"`
+	Offset  int    `schema:"offset"`
+	Compare bool   `schema:"compare"`
+}
+
+// ExportForm - параметры GET /reports/export, format - csv или xlsx. Сортировки и пагинации у выгрузки нет,
+// такие параметры - неизвестные, и декодер отвечает на них ошибкой.
+type ExportForm struct {
+	ReportFilterForm
+	Format string `schema:"format"`
+}
+
 type API struct {
 	rotator *app.RotatorDomain
+	reports *app.ReportDomain
 }
 
-func New(rotator *app.RotatorDomain) *API {
-	return &API{rotator: rotator}
+// New - reports может быть nil, если хранилище не поддерживает отчеты, тогда /reports не регистрируется.
+func New(rotator *app.RotatorDomain, reports *app.ReportDomain) *API {
+	return &API{rotator: rotator, reports: reports}
 }
 
 func (a *API) addBannerToSlot(w http.ResponseWriter, r *http.Request) {
@@ -43,11 +82,7 @@ func (a *API) addBannerToSlot(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if err := a.rotator.AddBannerToSlot(r.Context(), form.BannerID, form.SlotID); err != nil {
-		statusCode := http.StatusBadRequest
-		if errors.Is(err, storage.ErrObjectNotFound) {
-			statusCode = http.StatusNotFound
-		}
-		rest.SendErrorJSON(w, r, statusCode, err, "")
+		rest.SendError(w, r, err, "")
 		return
 	}
 
@@ -62,11 +97,7 @@ func (a *API) removeBannerFromSlot(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if err := a.rotator.RemoveBannerFromSlot(r.Context(), form.BannerID, form.SlotID); err != nil {
-		statusCode := http.StatusBadRequest
-		if errors.Is(err, storage.ErrObjectNotFound) {
-			statusCode = http.StatusNotFound
-		}
-		rest.SendErrorJSON(w, r, statusCode, err, "")
+		rest.SendError(w, r, err, "")
 		return
 	}
 
@@ -82,11 +113,7 @@ func (a *API) bannerForSlot(w http.ResponseWriter, r *http.Request) {
 
 	bannerID, err := a.rotator.BannerIDForSlot(r.Context(), query.SlotID, query.SocDemID)
 	if err != nil {
-		statusCode := http.StatusBadRequest
-		if errors.Is(err, storage.ErrObjectNotFound) {
-			statusCode = http.StatusNotFound
-		}
-		rest.SendErrorJSON(w, r, statusCode, err, "can't get banner id")
+		rest.SendError(w, r, err, "can't get banner id")
 		return
 	}
 
@@ -102,19 +129,269 @@ func (a *API) addCLickForBanner(w http.ResponseWriter, r *http.Request) {
 
 	err := a.rotator.AddClickForBanner(r.Context(), form.BannerID, form.SlotID, form.SocDemID)
 	if err != nil {
-		statusCode := http.StatusBadRequest
-		if errors.Is(err, storage.ErrObjectNotFound) {
-			statusCode = http.StatusNotFound
-		}
-		rest.SendErrorJSON(w, r, statusCode, err, "")
+		rest.SendError(w, r, err, "")
 		return
 	}
 
 	rest.SendDataJSON(w, r, http.StatusOK, nil)
 }
 
+// statsStream - Server-Sent Events со счетчиками слотов: событие slot после каждого показа и клика.
+func (a *API) statsStream(w http.ResponseWriter, r *http.Request) {
+	var query StatsStreamForm
+	if err := schema.NewDecoder().Decode(&query, r.URL.Query()); err != nil {
+		rest.SendErrorJSON(w, r, http.StatusBadRequest, err, "can't get query params")
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		rest.SendErrorJSON(w, r, http.StatusInternalServerError, nil, "streaming is not supported")
+		return
+	}
+
+	updates, cancel := a.rotator.Subscribe(query.SlotID)
+	defer cancel()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write([]byte(": connected\n\n"))
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-heartbeat.C:
+			if _, err := w.Write([]byte(": ping\n\n")); err != nil {
+				return
+			}
+			flusher.Flush()
+		case update := <-updates:
+			if err := rest.SendEvent(w, "slot", slotUpdateJSON(update)); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func slotUpdateJSON(u app.SlotUpdate) rest.JSON {
+	banners := make([]rest.JSON, 0, len(u.Banners))
+	for _, b := range u.Banners {
+		banners = append(banners, rest.JSON{"banner_id": b.BannerID, "shows": b.ShowCount, "clicks": b.ClickCount})
+	}
+	data := rest.JSON{
+		"slot_id":   u.SlotID,
+		"social_id": u.SocialID,
+		"banners":   banners,
+		"leader":    nil,
+		"at":        u.At,
+	}
+	if u.Leader != 0 {
+		data["leader"] = u.Leader
+	}
+	return data
+}
+
+func (a *API) report(w http.ResponseWriter, r *http.Request) {
+	var form ReportForm
+	if err := schema.NewDecoder().Decode(&form, r.URL.Query()); err != nil {
+		rest.SendErrorJSON(w, r, http.StatusBadRequest, err, "can't get query params")
+		return
+	}
+
+	query, err := form.query()
+	if err != nil {
+		rest.SendErrorJSON(w, r, http.StatusBadRequest, err, "can't get query params")
+		return
+	}
+
+	report, err := a.reports.Report(r.Context(), query)
+	if err != nil {
+		rest.SendError(w, r, err, "can't build report")
+		return
+	}
+
+	rows := make([]rest.JSON, 0, len(report.Rows))
+	for _, row := range report.Rows {
+		rows = append(rows, reportRowJSON(row, query.GroupBy, report.Confidence))
+	}
+	data := rest.JSON{"total": report.Total, "rows": rows, "confidence": report.Confidence, "complete_until": nil}
+	if !report.CompleteUntil.IsZero() {
+		data["complete_until"] = report.CompleteUntil
+	}
+	if query.Compare {
+		comparisons := make([]rest.JSON, 0, len(report.Comparisons))
+		for _, c := range report.Comparisons {
+			comparisons = append(comparisons, comparisonJSON(c, query.GroupBy))
+		}
+		data["comparisons"] = comparisons
+	}
+
+	rest.SendDataJSON(w, r, http.StatusOK, data)
+}
+
+func (a *API) exportReport(w http.ResponseWriter, r *http.Request) {
+	var form ExportForm
+	if err := schema.NewDecoder().Decode(&form, r.URL.Query()); err != nil {
+		rest.SendErrorJSON(w, r, http.StatusBadRequest, err, "can't get query params")
+		return
+	}
+
+	query, err := form.query()
+	if err != nil {
+		rest.SendErrorJSON(w, r, http.StatusBadRequest, err, "can't get query params")
+		return
+	}
+
+	file := &attachmentWriter{
+		ResponseWriter: w,
+		contentType:    export.ContentType(form.Format),
+		fileName: "report-" + query.From.UTC().Format("20060102") + "-" + query.To.UTC().Format("20060102") +
+			"." + export.Extension(form.Format),
+	}
+	writer, err := export.NewWriter(form.Format, file, query)
+	if err != nil {
+		rest.SendError(w, r, err, "")
+		return
+	}
+
+	err = a.reports.Export(r.Context(), query, writer)
+	if err == nil {
+		err = writer.Close()
+	}
+	if err == nil {
+		return
+	}
+	if !file.started {
+		rest.SendError(w, r, err, "can't export report")
+		return
+	}
+	// Ошибку после начала ответа клиенту уже не передать: соединение обрывается, чтобы оборванный файл
+	// не выглядел полным ответом 200. Сама ошибка - в логе домена.
+	panic(http.ErrAbortHandler)
+}
+
+// attachmentWriter - выставляет заголовки файла при первой записи, чтобы до нее можно было ответить ошибкой.
+type attachmentWriter struct {
+	http.ResponseWriter
+	contentType string
+	fileName    string
+	started     bool
+}
+
+func (w *attachmentWriter) Write(p []byte) (int, error) {
+	if !w.started {
+		w.started = true
+		w.Header().Set("Content-Type", w.contentType)
+		w.Header().Set("Content-Disposition", `attachment; filename="`+w.fileName+`"`)
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+func (f ReportForm) query() (app.ReportQuery, error) {
+	query, err := f.ReportFilterForm.query()
+	if err != nil {
+		return app.ReportQuery{}, err
+	}
+	query.Sort = f.Sort
+	query.Limit = f.Limit
+	query.Offset = f.Offset
+	query.Compare = f.Compare
+	return query, nil
+}
+
+func (f ReportFilterForm) query() (app.ReportQuery, error) {
+	from, err := parseReportTime(f.From)
+	if err != nil {
+		return app.ReportQuery{}, err
+	}
+	to, err := parseReportTime(f.To)
+	if err != nil {
+		return app.ReportQuery{}, err
+	}
+
+	query := app.ReportQuery{
+		From:       from,
+		To:         to,
+		Bucket:     app.Granularity(f.Bucket),
+		BannerID:   f.BannerID,
+		SlotID:     f.SlotID,
+		SocialID:   f.SocialID,
+		Confidence: f.Confidence,
+	}
+	if f.GroupBy != "" {
+		for _, dim := range strings.Split(f.GroupBy, ",") {
+			query.GroupBy = append(query.GroupBy, app.ReportDimension(strings.TrimSpace(dim)))
+		}
+	}
+
+	return query, nil
+}
+
+// parseReportTime - принимает дату (2006-01-02, полночь UTC) или время в RFC3339.
+func parseReportTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, errors.New("from and to are required")
+	}
+	if t, err := time.Parse("2006-01-02", value); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+func reportRowJSON(row app.ReportRow, groupBy []app.ReportDimension, confidence float64) rest.JSON {
+	low, high := row.CTRInterval(confidence)
+	data := rest.JSON{"shows": row.Shows, "clicks": row.Clicks, "ctr": row.CTR(), "ctr_low": low, "ctr_high": high}
+	for _, dim := range groupBy {
+		switch dim {
+		case app.ReportByBanner:
+			data["banner_id"] = row.BannerID
+		case app.ReportBySlot:
+			data["slot_id"] = row.SlotID
+		case app.ReportBySocial:
+			data["social_id"] = row.SocialID
+		case app.ReportByBucket:
+			data["bucket"] = row.Bucket
+		}
+	}
+	return data
+}
+
+func comparisonJSON(c app.BannerComparison, groupBy []app.ReportDimension) rest.JSON {
+	data := rest.JSON{
+		"banner_a":    c.BannerA,
+		"banner_b":    c.BannerB,
+		"z":           c.Z,
+		"p_value":     c.PValue,
+		"significant": c.Significant,
+		"winner":      nil,
+	}
+	if c.Winner != 0 {
+		data["winner"] = c.Winner
+	}
+	for _, dim := range groupBy {
+		switch dim {
+		case app.ReportBySlot:
+			data["slot_id"] = c.SlotID
+		case app.ReportBySocial:
+			data["social_id"] = c.SocialID
+		case app.ReportByBucket:
+			data["bucket"] = c.Bucket
+		}
+	}
+	return data
+}
+
 func (a *API) Routes() []rest.Route {
-	return []rest.Route{
+	routes := []rest.Route{
 		{
 			Name:   "AddBannerToSlot",
 			Method: http.MethodPost,
@@ -139,5 +416,28 @@ func (a *API) Routes() []rest.Route {
 			Path:   "/banner/click/add",
 			Func:   a.addCLickForBanner,
 		},
+		{
+			Name:      "StatsStream",
+			Method:    http.MethodGet,
+			Path:      "/stats/stream",
+			Func:      a.statsStream,
+			Streaming: true,
+		},
 	}
+	if a.reports != nil {
+		routes = append(routes, rest.Route{
+			Name:   "Reports",
+			Method: http.MethodGet,
+			Path:   "/reports",
+			Func:   a.report,
+		}, rest.Route{
+			Name:      "ExportReport",
+			Method:    http.MethodGet,
+			Path:      "/reports/export",
+			Func:      a.exportReport,
+			Streaming: true,
+		})
+	}
+
+	return routes
 }
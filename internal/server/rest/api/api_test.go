@@ -17,6 +17,7 @@ import (
 	"github.com/nsmak/bannersRotation/internal/app"
 	serverapi "github.com/nsmak/bannersRotation/internal/server/rest/api"
 	"github.com/nsmak/bannersRotation/internal/storage"
+	"github.com/nsmak/bannersRotation/internal/storage/cache"
 	"github.com/stretchr/testify/suite"
 	"go.uber.org/zap"
 )
@@ -37,8 +38,8 @@ func (s *ApiSuite) SetupTest() {
 	s.mockCtl = gomock.NewController(s.T())
 	s.mockStore = NewMockStorage(s.mockCtl)
 	s.ctx = context.Background()
-	s.rotator = app.NewRotator(s.mockStore, &mockLogger{})
-	s.api = serverapi.New(s.rotator)
+	s.rotator = app.NewRotator(s.mockStore, &mockLogger{}, nil)
+	s.api = serverapi.New(s.rotator, nil)
 
 	router := mux.NewRouter()
 	for _, route := range s.api.Routes() {
@@ -65,7 +66,7 @@ func (s *ApiSuite) TestAddBannerToSlotSuccess() {
 
 	s.Require().NoError(err)
 
-	s.mockStore.EXPECT().AddBannerToSlot(s.ctx, form.BannerID, form.SlotID).Return(nil)
+	s.mockStore.EXPECT().AddBannerToSlot(gomock.Any(), form.BannerID, form.SlotID).Return(nil)
 	resp, err := http.Post(s.server.URL+"/slot/banner/add", "application/json", bytes.NewReader(data))
 
 	s.Require().NoError(err)
@@ -93,7 +94,7 @@ func (s *ApiSuite) TestAddBannerToSlotBannerNotFound() {
 
 	s.Require().NoError(err)
 
-	s.mockStore.EXPECT().AddBannerToSlot(s.ctx, form.BannerID, form.SlotID).Return(storage.ErrObjectNotFound)
+	s.mockStore.EXPECT().AddBannerToSlot(gomock.Any(), form.BannerID, form.SlotID).Return(storage.ErrObjectNotFound)
 	resp, err := http.Post(s.server.URL+"/slot/banner/add", "application/json", bytes.NewReader(data))
 
 	s.Require().NoError(err)
@@ -106,7 +107,7 @@ func (s *ApiSuite) TestAddBannerToSlotSlotNotFound() {
 
 	s.Require().NoError(err)
 
-	s.mockStore.EXPECT().AddBannerToSlot(s.ctx, form.BannerID, form.SlotID).Return(storage.ErrObjectNotFound)
+	s.mockStore.EXPECT().AddBannerToSlot(gomock.Any(), form.BannerID, form.SlotID).Return(storage.ErrObjectNotFound)
 	resp, err := http.Post(s.server.URL+"/slot/banner/add", "application/json", bytes.NewReader(data))
 
 	s.Require().NoError(err)
@@ -119,11 +120,11 @@ func (s *ApiSuite) TestAddBannerToSlotUnknownError() {
 
 	s.Require().NoError(err)
 
-	s.mockStore.EXPECT().AddBannerToSlot(s.ctx, form.BannerID, form.SlotID).Return(errUnknown)
+	s.mockStore.EXPECT().AddBannerToSlot(gomock.Any(), form.BannerID, form.SlotID).Return(errUnknown)
 	resp, err := http.Post(s.server.URL+"/slot/banner/add", "application/json", bytes.NewReader(data))
 
 	s.Require().NoError(err)
-	s.Require().Equal(http.StatusBadRequest, resp.StatusCode)
+	s.Require().Equal(http.StatusInternalServerError, resp.StatusCode)
 }
 
 func (s *ApiSuite) TestRemoveBannerFromSlotSuccess() {
@@ -132,7 +133,7 @@ func (s *ApiSuite) TestRemoveBannerFromSlotSuccess() {
 
 	s.Require().NoError(err)
 
-	s.mockStore.EXPECT().RemoveBannerFromSlot(s.ctx, form.BannerID, form.SlotID).Return(nil)
+	s.mockStore.EXPECT().RemoveBannerFromSlot(gomock.Any(), form.BannerID, form.SlotID).Return(nil)
 	resp, err := http.Post(s.server.URL+"/slot/banner/remove", "application/json", bytes.NewReader(data))
 
 	s.Require().NoError(err)
@@ -160,7 +161,7 @@ func (s *ApiSuite) TestRemoveBannerFromSlotSlotNotFound() {
 
 	s.Require().NoError(err)
 
-	s.mockStore.EXPECT().RemoveBannerFromSlot(s.ctx, form.BannerID, form.SlotID).Return(storage.ErrObjectNotFound)
+	s.mockStore.EXPECT().RemoveBannerFromSlot(gomock.Any(), form.BannerID, form.SlotID).Return(storage.ErrObjectNotFound)
 	resp, err := http.Post(s.server.URL+"/slot/banner/remove", "application/json", bytes.NewReader(data))
 
 	s.Require().NoError(err)
@@ -173,7 +174,7 @@ func (s *ApiSuite) TestRemoveBannerFromSlotBannerInSlotNotFound() {
 
 	s.Require().NoError(err)
 
-	s.mockStore.EXPECT().RemoveBannerFromSlot(s.ctx, form.BannerID, form.SlotID).Return(storage.ErrObjectNotFound)
+	s.mockStore.EXPECT().RemoveBannerFromSlot(gomock.Any(), form.BannerID, form.SlotID).Return(storage.ErrObjectNotFound)
 	resp, err := http.Post(s.server.URL+"/slot/banner/remove", "application/json", bytes.NewReader(data))
 
 	s.Require().NoError(err)
@@ -186,11 +187,11 @@ func (s *ApiSuite) TestRemoveBannerFromSlotUnknownError() {
 
 	s.Require().NoError(err)
 
-	s.mockStore.EXPECT().RemoveBannerFromSlot(s.ctx, form.BannerID, form.SlotID).Return(errUnknown)
+	s.mockStore.EXPECT().RemoveBannerFromSlot(gomock.Any(), form.BannerID, form.SlotID).Return(errUnknown)
 	resp, err := http.Post(s.server.URL+"/slot/banner/remove", "application/json", bytes.NewReader(data))
 
 	s.Require().NoError(err)
-	s.Require().Equal(http.StatusBadRequest, resp.StatusCode)
+	s.Require().Equal(http.StatusInternalServerError, resp.StatusCode)
 }
 
 func (s *ApiSuite) TestBannerForSlotSuccess() {
@@ -199,8 +200,8 @@ func (s *ApiSuite) TestBannerForSlotSuccess() {
 		SocDemID: 1,
 	}
 
-	s.mockStore.EXPECT().BannersStatistics(s.ctx, query.SlotID, query.SocDemID).Return(mockStatistics(), nil)
-	s.mockStore.EXPECT().AddViewForBanner(s.ctx, mockStatistics()[2].BannerID, query.SlotID, query.SocDemID).Return(nil)
+	s.mockStore.EXPECT().BannersStatistics(gomock.Any(), query.SlotID, query.SocDemID).Return(mockStatistics(), nil)
+	s.mockStore.EXPECT().AddViewForBanner(gomock.Any(), mockStatistics()[2].BannerID, query.SlotID, query.SocDemID).Return(nil)
 	resp, err := http.Get(s.server.URL + fmt.Sprintf("/banner?slot_id=%d&soc_dem_id=%d", query.SlotID, query.SocDemID))
 
 	s.Require().NoError(err)
@@ -220,7 +221,7 @@ func (s *ApiSuite) TestBannerForSlotSlotNotFound() {
 		SocDemID: 1,
 	}
 
-	s.mockStore.EXPECT().BannersStatistics(s.ctx, query.SlotID, query.SocDemID).Return(nil, storage.ErrObjectNotFound)
+	s.mockStore.EXPECT().BannersStatistics(gomock.Any(), query.SlotID, query.SocDemID).Return(nil, storage.ErrObjectNotFound)
 	resp, err := http.Get(s.server.URL + fmt.Sprintf("/banner?slot_id=%d&soc_dem_id=%d", query.SlotID, query.SocDemID))
 
 	s.Require().NoError(err)
@@ -233,7 +234,7 @@ func (s *ApiSuite) TestBannerForSlotSocialGroupNotFound() {
 		SocDemID: 1,
 	}
 
-	s.mockStore.EXPECT().BannersStatistics(s.ctx, query.SlotID, query.SocDemID).Return(nil, storage.ErrObjectNotFound)
+	s.mockStore.EXPECT().BannersStatistics(gomock.Any(), query.SlotID, query.SocDemID).Return(nil, storage.ErrObjectNotFound)
 	resp, err := http.Get(s.server.URL + fmt.Sprintf("/banner?slot_id=%d&soc_dem_id=%d", query.SlotID, query.SocDemID))
 
 	s.Require().NoError(err)
@@ -246,12 +247,12 @@ func (s *ApiSuite) TestBannerForSlotAddViewError() {
 		SocDemID: 1,
 	}
 
-	s.mockStore.EXPECT().BannersStatistics(s.ctx, query.SlotID, query.SocDemID).Return(mockStatistics(), nil)
-	s.mockStore.EXPECT().AddViewForBanner(s.ctx, mockStatistics()[2].BannerID, query.SlotID, query.SocDemID).Return(errors.New("storeErr"))
+	s.mockStore.EXPECT().BannersStatistics(gomock.Any(), query.SlotID, query.SocDemID).Return(mockStatistics(), nil)
+	s.mockStore.EXPECT().AddViewForBanner(gomock.Any(), mockStatistics()[2].BannerID, query.SlotID, query.SocDemID).Return(errors.New("storeErr"))
 	resp, err := http.Get(s.server.URL + fmt.Sprintf("/banner?slot_id=%d&soc_dem_id=%d", query.SlotID, query.SocDemID))
 
 	s.Require().NoError(err)
-	s.Require().Equal(http.StatusBadRequest, resp.StatusCode)
+	s.Require().Equal(http.StatusInternalServerError, resp.StatusCode)
 }
 
 func (s *ApiSuite) TestBannerForSlotUnknownError() {
@@ -260,11 +261,11 @@ func (s *ApiSuite) TestBannerForSlotUnknownError() {
 		SocDemID: 1,
 	}
 
-	s.mockStore.EXPECT().BannersStatistics(s.ctx, query.SlotID, query.SocDemID).Return(nil, errUnknown)
+	s.mockStore.EXPECT().BannersStatistics(gomock.Any(), query.SlotID, query.SocDemID).Return(nil, errUnknown)
 	resp, err := http.Get(s.server.URL + fmt.Sprintf("/banner?slot_id=%d&soc_dem_id=%d", query.SlotID, query.SocDemID))
 
 	s.Require().NoError(err)
-	s.Require().Equal(http.StatusBadRequest, resp.StatusCode)
+	s.Require().Equal(http.StatusInternalServerError, resp.StatusCode)
 }
 
 func (s *ApiSuite) TestAddCLickForBannerSuccess() {
@@ -273,7 +274,7 @@ func (s *ApiSuite) TestAddCLickForBannerSuccess() {
 
 	s.Require().NoError(err)
 
-	s.mockStore.EXPECT().AddClickForBanner(s.ctx, form.BannerID, form.SlotID, form.SocDemID).Return(nil)
+	s.mockStore.EXPECT().AddClickForBanner(gomock.Any(), form.BannerID, form.SlotID, form.SocDemID).Return(nil)
 	resp, err := http.Post(s.server.URL+"/banner/click/add", "application/json", bytes.NewReader(data))
 
 	s.Require().NoError(err)
@@ -301,7 +302,7 @@ func (s *ApiSuite) TestAddCLickForBannerSlotNotFound() {
 
 	s.Require().NoError(err)
 
-	s.mockStore.EXPECT().AddClickForBanner(s.ctx, form.BannerID, form.SlotID, form.SocDemID).Return(storage.ErrObjectNotFound)
+	s.mockStore.EXPECT().AddClickForBanner(gomock.Any(), form.BannerID, form.SlotID, form.SocDemID).Return(storage.ErrObjectNotFound)
 	resp, err := http.Post(s.server.URL+"/banner/click/add", "application/json", bytes.NewReader(data))
 
 	s.Require().NoError(err)
@@ -314,7 +315,7 @@ func (s *ApiSuite) TestAddCLickForBannerBannerInSlotNotFound() {
 
 	s.Require().NoError(err)
 
-	s.mockStore.EXPECT().AddClickForBanner(s.ctx, form.BannerID, form.SlotID, form.SocDemID).Return(storage.ErrObjectNotFound)
+	s.mockStore.EXPECT().AddClickForBanner(gomock.Any(), form.BannerID, form.SlotID, form.SocDemID).Return(storage.ErrObjectNotFound)
 	resp, err := http.Post(s.server.URL+"/banner/click/add", "application/json", bytes.NewReader(data))
 
 	s.Require().NoError(err)
@@ -327,7 +328,7 @@ func (s *ApiSuite) TestAddCLickForBannerSocialGroupNotFound() {
 
 	s.Require().NoError(err)
 
-	s.mockStore.EXPECT().AddClickForBanner(s.ctx, form.BannerID, form.SlotID, form.SocDemID).Return(storage.ErrObjectNotFound)
+	s.mockStore.EXPECT().AddClickForBanner(gomock.Any(), form.BannerID, form.SlotID, form.SocDemID).Return(storage.ErrObjectNotFound)
 	resp, err := http.Post(s.server.URL+"/banner/click/add", "application/json", bytes.NewReader(data))
 
 	s.Require().NoError(err)
@@ -340,11 +341,75 @@ func (s *ApiSuite) TestAddCLickForBannerUnknownError() {
 
 	s.Require().NoError(err)
 
-	s.mockStore.EXPECT().AddClickForBanner(s.ctx, form.BannerID, form.SlotID, form.SocDemID).Return(errUnknown)
+	s.mockStore.EXPECT().AddClickForBanner(gomock.Any(), form.BannerID, form.SlotID, form.SocDemID).Return(errUnknown)
 	resp, err := http.Post(s.server.URL+"/banner/click/add", "application/json", bytes.NewReader(data))
 
 	s.Require().NoError(err)
+	s.Require().Equal(http.StatusInternalServerError, resp.StatusCode)
+}
+
+func (s *ApiSuite) TestErrorCodes() {
+	tests := []struct {
+		err     error
+		status  int
+		code    string
+		message string
+	}{
+		{err: storage.ErrObjectNotFound, status: http.StatusNotFound, code: "not_found", message: "not found"},
+		{
+			err:     storage.NewError("can't add banner into slot", storage.ErrAlreadyExists),
+			status:  http.StatusConflict,
+			code:    "conflict",
+			message: "conflict",
+		},
+		{
+			err:     storage.NewError(`violates foreign key constraint "banner_slot_slot_id_fkey"`, storage.ErrObjectNotFound),
+			status:  http.StatusNotFound,
+			code:    "not_found",
+			message: "not found",
+		},
+		{err: cache.ErrBufferFull, status: http.StatusServiceUnavailable, code: "unavailable", message: "temporarily unavailable"},
+		{err: context.DeadlineExceeded, status: http.StatusServiceUnavailable, code: "unavailable", message: "temporarily unavailable"},
+		{err: errUnknown, status: http.StatusInternalServerError, code: "internal", message: "internal server error"},
+	}
+
+	form := serverapi.BannerSlotForm{BannerID: 1, SlotID: 1}
+	data, err := json.Marshal(&form)
+	s.Require().NoError(err)
+
+	for _, tt := range tests {
+		s.mockStore.EXPECT().AddBannerToSlot(gomock.Any(), form.BannerID, form.SlotID).Return(tt.err)
+		resp, err := http.Post(s.server.URL+"/slot/banner/add", "application/json", bytes.NewReader(data))
+		s.Require().NoError(err)
+
+		var body struct {
+			Error struct {
+				Code    string `json:"code"`
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		s.Require().NoError(json.NewDecoder(resp.Body).Decode(&body))
+		resp.Body.Close()
+
+		s.Require().Equal(tt.status, resp.StatusCode, tt.err.Error())
+		s.Require().Equal(tt.code, body.Error.Code, tt.err.Error())
+		s.Require().Equal(tt.message, body.Error.Message, tt.err.Error())
+	}
+}
+
+func (s *ApiSuite) TestParseErrorCode() {
+	resp, err := http.Post(s.server.URL+"/slot/banner/add", "application/json", bytes.NewReader([]byte("invalid")))
+	s.Require().NoError(err)
+	defer resp.Body.Close()
+
+	var body struct {
+		Error struct {
+			Code string `json:"code"`
+		} `json:"error"`
+	}
+	s.Require().NoError(json.NewDecoder(resp.Body).Decode(&body))
 	s.Require().Equal(http.StatusBadRequest, resp.StatusCode)
+	s.Require().Equal("validation", body.Error.Code)
 }
 
 func TestApiSuite(t *testing.T) {
@@ -380,6 +445,10 @@ func mockStatistics() []app.BannerSummary {
 type mockLogger struct {
 }
 
+func (m *mockLogger) WithContext(ctx context.Context) app.Logger {
+	return m
+}
+
 func (m *mockLogger) Info(msg string, fields ...zap.Field) {
 }
 
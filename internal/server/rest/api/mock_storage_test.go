@@ -76,36 +76,6 @@ func (mr *MockStorageMockRecorder) AddViewForBanner(arg0, arg1, arg2, arg3 inter
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddViewForBanner", reflect.TypeOf((*MockStorage)(nil).AddViewForBanner), arg0, arg1, arg2, arg3)
 }
 
-// BannersClickStatisticsFilterByDate mocks base method
-func (m *MockStorage) BannersClickStatisticsFilterByDate(arg0 context.Context, arg1, arg2 int64) ([]app.BannerStatistic, error) {
-	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "BannersClickStatisticsFilterByDate", arg0, arg1, arg2)
-	ret0, _ := ret[0].([]app.BannerStatistic)
-	ret1, _ := ret[1].(error)
-	return ret0, ret1
-}
-
-// BannersClickStatisticsFilterByDate indicates an expected call of BannersClickStatisticsFilterByDate
-func (mr *MockStorageMockRecorder) BannersClickStatisticsFilterByDate(arg0, arg1, arg2 interface{}) *gomock.Call {
-	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "BannersClickStatisticsFilterByDate", reflect.TypeOf((*MockStorage)(nil).BannersClickStatisticsFilterByDate), arg0, arg1, arg2)
-}
-
-// BannersShowStatisticsFilterByDate mocks base method
-func (m *MockStorage) BannersShowStatisticsFilterByDate(arg0 context.Context, arg1, arg2 int64) ([]app.BannerStatistic, error) {
-	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "BannersShowStatisticsFilterByDate", arg0, arg1, arg2)
-	ret0, _ := ret[0].([]app.BannerStatistic)
-	ret1, _ := ret[1].(error)
-	return ret0, ret1
-}
-
-// BannersShowStatisticsFilterByDate indicates an expected call of BannersShowStatisticsFilterByDate
-func (mr *MockStorageMockRecorder) BannersShowStatisticsFilterByDate(arg0, arg1, arg2 interface{}) *gomock.Call {
-	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "BannersShowStatisticsFilterByDate", reflect.TypeOf((*MockStorage)(nil).BannersShowStatisticsFilterByDate), arg0, arg1, arg2)
-}
-
 // BannersStatistics mocks base method
 func (m *MockStorage) BannersStatistics(arg0 context.Context, arg1, arg2 int64) ([]app.BannerSummary, error) {
 	m.ctrl.T.Helper()
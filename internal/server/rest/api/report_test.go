@@ -0,0 +1,240 @@
+package api_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/nsmak/bannersRotation/internal/app"
+	serverapi "github.com/nsmak/bannersRotation/internal/server/rest/api"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeReportStore struct {
+	granularity app.Granularity
+	query       app.ReportQuery
+}
+
+// ReportRows - две строки баннеров слота 1 в порядке убывания CTR.
+func (f *fakeReportStore) ReportRows(_ context.Context, g app.Granularity, q app.ReportQuery) ([]app.ReportRow, int, error) {
+	f.granularity, f.query = g, q
+	rows := []app.ReportRow{
+		{BannerID: 2, SlotID: 1, Shows: 10, Clicks: 5},
+		{BannerID: 1, SlotID: 1, Shows: 10, Clicks: 1},
+	}
+	if q.Limit > 0 && q.Limit < len(rows) {
+		return rows[:q.Limit], len(rows), nil
+	}
+	return rows, len(rows), nil
+}
+
+func (f *fakeReportStore) EachBannerRollup(
+	_ context.Context,
+	_ app.Granularity,
+	from, _ time.Time,
+	fn func(app.BannerRollup) error,
+) error {
+	rollups := []app.BannerRollup{
+		{Bucket: from, BannerID: 1, SlotID: 1, SocialID: 1, Shows: 10, Clicks: 1},
+		{Bucket: from, BannerID: 2, SlotID: 1, SocialID: 1, Shows: 10, Clicks: 5},
+	}
+	for _, r := range rollups {
+		if err := fn(r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (f *fakeReportStore) RollupWatermark(context.Context, app.Granularity) (time.Time, bool, error) {
+	return time.Date(2021, 2, 3, 0, 0, 0, 0, time.UTC), true, nil
+}
+
+func newReportServer(t *testing.T, store app.ReportStore) *httptest.Server {
+	api := serverapi.New(app.NewRotator(nil, &mockLogger{}, nil), app.NewReports(store, &mockLogger{}))
+	router := mux.NewRouter()
+	for _, route := range api.Routes() {
+		router.Methods(route.Method).Path(route.Path).Name(route.Name).HandlerFunc(route.Func)
+	}
+	server := httptest.NewServer(router)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestReportsSuccess(t *testing.T) {
+	store := &fakeReportStore{}
+	server := newReportServer(t, store)
+
+	resp, err := http.Get(server.URL + "/reports?from=2021-02-01&to=2021-02-03&group_by=banner&sort=-ctr&limit=1")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, app.GranularityDay, store.granularity)
+	require.Equal(t, time.Date(2021, 2, 1, 0, 0, 0, 0, time.UTC), store.query.From)
+	require.Equal(t, "-ctr", store.query.Sort)
+	require.Equal(t, 1, store.query.Limit)
+
+	var body struct {
+		Data struct {
+			Total         int                      `json:"total"`
+			CompleteUntil time.Time                `json:"complete_until"`
+			Rows          []map[string]interface{} `json:"rows"`
+		} `json:"data"`
+	}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+	require.Equal(t, 2, body.Data.Total)
+	require.Equal(t, time.Date(2021, 2, 3, 0, 0, 0, 0, time.UTC), body.Data.CompleteUntil)
+	require.Len(t, body.Data.Rows, 1)
+	row := body.Data.Rows[0]
+	require.Equal(t, 2.0, row["banner_id"])
+	require.Equal(t, 10.0, row["shows"])
+	require.Equal(t, 5.0, row["clicks"])
+	require.Equal(t, 0.5, row["ctr"])
+	require.InDelta(t, 0.2366, row["ctr_low"], 1e-4)
+	require.InDelta(t, 0.7634, row["ctr_high"], 1e-4)
+	require.NotContains(t, row, "slot_id")
+}
+
+func TestReportsComparisons(t *testing.T) {
+	server := newReportServer(t, &fakeReportStore{})
+
+	resp, err := http.Get(server.URL + "/reports?from=2021-02-01&to=2021-02-03&group_by=banner,slot&compare=true")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var body struct {
+		Data struct {
+			Comparisons []map[string]interface{} `json:"comparisons"`
+		} `json:"data"`
+	}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+	require.Len(t, body.Data.Comparisons, 1)
+	c := body.Data.Comparisons[0]
+	require.Equal(t, 1.0, c["banner_a"])
+	require.Equal(t, 2.0, c["banner_b"])
+	require.Equal(t, 1.0, c["slot_id"])
+	require.Equal(t, false, c["significant"])
+	require.Nil(t, c["winner"])
+}
+
+func TestReportsInvalidQuery(t *testing.T) {
+	server := newReportServer(t, &fakeReportStore{})
+	queries := []string{
+		"",
+		"from=2021-02-01",
+		"from=yesterday&to=2021-02-03",
+		"from=2021-02-01&to=2021-02-03&group_by=campaign",
+		"from=2021-02-01&to=2021-02-03&bucket=month",
+		"from=2021-02-01&to=2021-02-03&sort=views",
+		"from=2021-02-01&to=2021-02-03&limit=many",
+		"from=2021-02-01&to=2021-02-03&confidence=1.5",
+		"from=2021-02-01&to=2021-02-03&group_by=slot&compare=true",
+	}
+
+	for i, query := range queries {
+		resp, err := http.Get(server.URL + "/reports?" + query)
+		require.NoError(t, err)
+		resp.Body.Close()
+
+		require.Equal(t, http.StatusBadRequest, resp.StatusCode, "at", i)
+	}
+}
+
+func TestExportReportCSV(t *testing.T) {
+	server := newReportServer(t, &fakeReportStore{})
+
+	resp, err := http.Get(server.URL + "/reports/export?from=2021-02-01&to=2021-02-03&group_by=banner&format=csv")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, "text/csv; charset=utf-8", resp.Header.Get("Content-Type"))
+	require.Equal(t, `attachment; filename="report-20210201-20210203.csv"`, resp.Header.Get("Content-Disposition"))
+
+	body, err := ioutil.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.Equal(t, "banner_id,shows,clicks,ctr,ctr_low,ctr_high\n"+
+		"1,10,1,0.100000,0.017876,0.404150\n"+
+		"2,10,5,0.500000,0.236593,0.763407\n", string(body))
+}
+
+func TestExportReportInvalidQuery(t *testing.T) {
+	server := newReportServer(t, &fakeReportStore{})
+	queries := []string{
+		"from=2021-02-01&to=2021-02-03&format=pdf",
+		"from=2021-02-03&to=2021-02-01&format=xlsx",
+		"to=2021-02-01",
+	}
+
+	for i, query := range queries {
+		resp, err := http.Get(server.URL + "/reports/export?" + query)
+		require.NoError(t, err)
+		resp.Body.Close()
+
+		require.Equal(t, http.StatusBadRequest, resp.StatusCode, "at", i)
+		require.Empty(t, resp.Header.Get("Content-Disposition"), "at", i)
+	}
+}
+
+func TestExportReportRejectsReportOnlyParams(t *testing.T) {
+	server := newReportServer(t, &fakeReportStore{})
+
+	for _, param := range []string{"sort=-ctr", "limit=10", "offset=5", "compare=true"} {
+		resp, err := http.Get(server.URL + "/reports/export?from=2021-02-01&to=2021-02-03&" + param)
+		require.NoError(t, err)
+		resp.Body.Close()
+
+		require.Equal(t, http.StatusBadRequest, resp.StatusCode, param)
+	}
+}
+
+// failingExportStore - отдает сутки строк, первую строку следующих суток и ошибку.
+type failingExportStore struct {
+	fakeReportStore
+}
+
+func (f *failingExportStore) EachBannerRollup(
+	_ context.Context,
+	_ app.Granularity,
+	from, _ time.Time,
+	fn func(app.BannerRollup) error,
+) error {
+	for id := int64(1); id <= 1000; id++ {
+		if err := fn(app.BannerRollup{Bucket: from, BannerID: id, SlotID: 1, SocialID: 1, Shows: 10}); err != nil {
+			return err
+		}
+	}
+	if err := fn(app.BannerRollup{Bucket: from.AddDate(0, 0, 1), BannerID: 1, SlotID: 1, SocialID: 1}); err != nil {
+		return err
+	}
+	return errors.New("connection reset")
+}
+
+func TestExportReportAbortsAfterStart(t *testing.T) {
+	server := newReportServer(t, &failingExportStore{})
+
+	resp, err := http.Get(server.URL + "/reports/export?from=2021-02-01&to=2021-02-03&group_by=bucket,banner")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	_, err = ioutil.ReadAll(resp.Body)
+	require.Error(t, err)
+}
+
+func TestReportsNotRegisteredWithoutStore(t *testing.T) {
+	api := serverapi.New(app.NewRotator(nil, &mockLogger{}, nil), nil)
+
+	for _, route := range api.Routes() {
+		require.NotContains(t, route.Path, "/reports")
+	}
+}
@@ -0,0 +1,79 @@
+package api_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/gorilla/mux"
+	"github.com/nsmak/bannersRotation/internal/app"
+	serverapi "github.com/nsmak/bannersRotation/internal/server/rest/api"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStatsStream(t *testing.T) {
+	mockCtl := gomock.NewController(t)
+	defer mockCtl.Finish()
+	store := NewMockStorage(mockCtl)
+	rotator := app.NewRotator(store, &mockLogger{}, nil)
+
+	router := mux.NewRouter()
+	for _, route := range serverapi.New(rotator, nil).Routes() {
+		router.Methods(route.Method).Path(route.Path).Name(route.Name).HandlerFunc(route.Func)
+	}
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+"/stats/stream?slot_id=1", nil)
+	require.NoError(t, err)
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	body := bufio.NewReader(resp.Body)
+	line, err := body.ReadString('\n')
+	require.NoError(t, err)
+	require.Equal(t, ": connected\n", line)
+
+	store.EXPECT().BannersStatistics(gomock.Any(), int64(1), int64(1)).Return(mockStatistics(), nil)
+	store.EXPECT().AddViewForBanner(gomock.Any(), int64(3), int64(1), int64(1)).Return(nil)
+	_, err = rotator.BannerIDForSlot(context.Background(), 1, 1)
+	require.NoError(t, err)
+
+	var lines []string
+	for len(lines) < 3 {
+		line, err := body.ReadString('\n')
+		require.NoError(t, err)
+		if line == "\n" && len(lines) == 0 {
+			continue
+		}
+		lines = append(lines, line)
+	}
+	require.Equal(t, "event: slot\n", lines[0])
+	require.True(t, strings.HasPrefix(lines[1], "data: "))
+	require.Equal(t, "\n", lines[2])
+
+	var update struct {
+		SlotID  int64 `json:"slot_id"`
+		Leader  int64 `json:"leader"`
+		Banners []struct {
+			BannerID int64 `json:"banner_id"`
+			Shows    int64 `json:"shows"`
+		} `json:"banners"`
+	}
+	require.NoError(t, json.Unmarshal([]byte(strings.TrimPrefix(lines[1], "data: ")), &update))
+	require.Equal(t, int64(1), update.SlotID)
+	require.Equal(t, int64(2), update.Leader)
+	require.Len(t, update.Banners, 3)
+	require.Equal(t, int64(6), update.Banners[2].Shows)
+}
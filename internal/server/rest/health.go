@@ -0,0 +1,89 @@
+package rest
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/nsmak/bannersRotation/internal/app"
+)
+
+// Время на все проверки готовности одного запроса /readyz.
+const readinessTimeout = 2 * time.Second
+
+// Pinger - зависимость, без которой сервис не готов принимать запросы.
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
+
+// PingerFunc - позволяет использовать функцию как Pinger.
+type PingerFunc func(ctx context.Context) error
+
+func (f PingerFunc) Ping(ctx context.Context) error {
+	return f(ctx)
+}
+
+type readinessCheck struct {
+	name   string
+	pinger Pinger
+}
+
+// AddReadinessCheck - /readyz отвечает 503, пока проверка возвращает ошибку. Вызывается до Start.
+func (s *Server) AddReadinessCheck(name string, p Pinger) {
+	s.checks = append(s.checks, readinessCheck{name: name, pinger: p})
+}
+
+func (s *Server) healthRoutes() []Route {
+	return []Route{
+		{
+			Name:   "Healthz",
+			Method: http.MethodGet,
+			Path:   "/healthz",
+			Func:   s.healthz,
+		},
+		{
+			Name:   "Readyz",
+			Method: http.MethodGet,
+			Path:   "/readyz",
+			Func:   s.readyz,
+		},
+	}
+}
+
+// healthz - процесс жив и обслуживает HTTP, зависимости не проверяются.
+func (s *Server) healthz(w http.ResponseWriter, r *http.Request) {
+	SendDataJSON(w, r, http.StatusOK, JSON{"status": "ok"})
+}
+
+// readyz - результаты всех проверок по именам. Во время остановки сервер не готов независимо от проверок,
+// чтобы балансировщик успел снять с него трафик.
+func (s *Server) readyz(w http.ResponseWriter, r *http.Request) {
+	select {
+	case <-s.draining:
+		SendErrorJSON(w, r, http.StatusServiceUnavailable, nil, "server is shutting down")
+		return
+	default:
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), readinessTimeout)
+	defer cancel()
+
+	ready := true
+	checks := JSON{}
+	for _, c := range s.checks {
+		if err := c.pinger.Ping(ctx); err != nil {
+			ready = false
+			checks[c.name] = err.Error()
+			s.log.Warn("readiness check failed", s.log.String("check", c.name), s.log.String("msg", err.Error()))
+			continue
+		}
+		checks[c.name] = "ok"
+	}
+
+	if !ready {
+		status(r, http.StatusServiceUnavailable)
+		sendJSON(w, r, Response{Data: checks, Error: JSON{"code": app.CodeUnavailable, "message": "not ready"}})
+		return
+	}
+	SendDataJSON(w, r, http.StatusOK, checks)
+}
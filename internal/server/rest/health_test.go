@@ -0,0 +1,104 @@
+package rest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/nsmak/bannersRotation/internal/app"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func get(t *testing.T, s *Server, path string) (int, Response) {
+	rec := httptest.NewRecorder()
+	s.router().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+
+	var resp Response
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&resp))
+	return rec.Code, resp
+}
+
+func TestHealthz(t *testing.T) {
+	s := NewServer("", &mockLogger{}, nil)
+
+	code, resp := get(t, s, "/healthz")
+
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, map[string]interface{}{"status": "ok"}, resp.Data)
+}
+
+func TestReadyz(t *testing.T) {
+	var dbErr error
+	s := NewServer("", &mockLogger{}, nil)
+	s.AddReadinessCheck("database", PingerFunc(func(context.Context) error { return dbErr }))
+	s.AddReadinessCheck("broker", PingerFunc(func(context.Context) error { return nil }))
+
+	code, resp := get(t, s, "/readyz")
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, map[string]interface{}{"database": "ok", "broker": "ok"}, resp.Data)
+
+	dbErr = errors.New("connection refused")
+	code, resp = get(t, s, "/readyz")
+	require.Equal(t, http.StatusServiceUnavailable, code)
+	require.Equal(t, map[string]interface{}{"database": "connection refused", "broker": "ok"}, resp.Data)
+	require.Equal(t, "not ready", resp.Error["message"])
+}
+
+func TestReadyzFailsWhileDraining(t *testing.T) {
+	s := NewServer("", &mockLogger{}, nil)
+	s.server = &http.Server{}
+	s.DrainDelay = time.Minute
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan error)
+	go func() { stopped <- s.Stop(ctx) }()
+
+	require.Eventually(t, func() bool {
+		code, _ := get(t, s, "/readyz")
+		return code == http.StatusServiceUnavailable
+	}, time.Second, 10*time.Millisecond)
+
+	// Соединения закрываются только после DrainDelay или отмены контекста.
+	select {
+	case <-s.stopping:
+		t.Fatal("server stopped before drain delay")
+	default:
+	}
+	cancel()
+	require.NoError(t, <-stopped)
+	code, _ := get(t, s, "/healthz")
+	require.Equal(t, http.StatusOK, code)
+}
+
+type mockLogger struct {
+}
+
+func (m *mockLogger) WithContext(ctx context.Context) app.Logger {
+	return m
+}
+
+func (m *mockLogger) Info(msg string, fields ...zap.Field) {
+}
+
+func (m *mockLogger) Warn(msg string, fields ...zap.Field) {
+}
+
+func (m *mockLogger) Error(msg string, fields ...zap.Field) {
+}
+
+func (m *mockLogger) String(key string, val string) zap.Field {
+	return zap.Field{}
+}
+
+func (m *mockLogger) Int64(key string, val int64) zap.Field {
+	return zap.Field{}
+}
+
+func (m *mockLogger) Duration(key string, val time.Duration) zap.Field {
+	return zap.Field{}
+}
@@ -1,42 +1,214 @@
 package rest
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	"os"
-	"runtime"
+	"runtime/debug"
 	"time"
+
+	"github.com/google/uuid"
+	"github.com/justinas/alice"
+	"github.com/nsmak/bannersRotation/internal/app"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
 )
 
-func (s *Server) panicMiddleware(next http.Handler) http.Handler {
+var tracer = otel.Tracer("github.com/nsmak/bannersRotation/internal/server/rest")
+
+// panicMiddleware - паника обработчика маршрута route не роняет сервер: она записывается в лог со стеком,
+// клиент получает 500, если ответ еще не начат. С CrashOnPanic процесс, как раньше, завершается.
+func (s *Server) panicMiddleware(route string) alice.Constructor {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			sw := &statusWriter{ResponseWriter: w}
+			defer func() {
+				p := recover()
+				if p == nil {
+					return
+				}
+				// ErrAbortHandler - штатный способ оборвать ответ, net/http его не логирует.
+				if p == http.ErrAbortHandler { // nolint: errorlint, goerr113
+					panic(p)
+				}
+
+				log := s.log.WithContext(r.Context())
+				log.Error(
+					"panic in handler",
+					log.String("route", route),
+					log.String("panic", fmt.Sprint(p)),
+					log.String("stack", string(debug.Stack())),
+				)
+				if s.CrashOnPanic {
+					os.Exit(1)
+				}
+				if s.metrics != nil {
+					s.metrics.RecoveredPanic(route)
+				}
+				if sw.status == 0 {
+					SendErrorJSON(sw, r, http.StatusInternalServerError, nil, "internal server error")
+				}
+			}()
+			next.ServeHTTP(sw, r)
+		})
+	}
+}
+
+// RequestIDHeader - заголовок с идентификатором запроса. Входящий идентификатор сохраняется, если он корректен,
+// иначе создается новый; ответ всегда содержит идентификатор, под которым запрос записан в логи.
+const RequestIDHeader = "X-Request-ID"
+
+const maxRequestIDLength = 128
+
+func requestIDMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(RequestIDHeader)
+		if !validRequestID(id) {
+			id = uuid.New().String()
+		}
+		w.Header().Set(RequestIDHeader, id)
+		next.ServeHTTP(w, r.WithContext(app.WithRequestID(r.Context(), id)))
+	})
+}
+
+// validRequestID - непустая строка из печатных ASCII-символов без пробелов, чтобы чужой идентификатор
+// не ломал строки логов.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *Server) loggingMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		sw := &statusWriter{ResponseWriter: w}
+		r, reqErr := withRequestError(r)
 		defer func() {
-			err := recover()
-			if err != nil {
-				buf := make([]byte, 1<<20)
-				n := runtime.Stack(buf, true)
-				s.log.Error(fmt.Sprintf("panic: %v\n\n%s", err, buf[:n]))
-				os.Exit(1)
+			log := s.log.WithContext(r.Context())
+			fields := []zap.Field{
+				log.String("addr", r.RemoteAddr),
+				log.String("method", r.Method),
+				log.String("path", r.URL.Path),
+				log.String("proto", r.Proto),
+				log.Int64("status", int64(sw.code())),
+				log.Int64("size", sw.size),
+				log.Duration("duration", time.Since(start)),
+				log.String("user agent", r.UserAgent()),
 			}
+			if msg := reqErr.message(); msg != "" {
+				fields = append(fields, log.String("error", msg))
+			}
+			log.Info("[REST]", fields...)
 		}()
-		next.ServeHTTP(w, r)
+		next.ServeHTTP(sw, r)
 	})
 }
 
-func (s *Server) loggingMiddleware(next http.Handler) http.Handler {
+func timeoutMiddleware(next http.Handler) http.Handler {
+	return http.TimeoutHandler(next, requestTimeout, `{"data":null,"error":{"code":"unavailable","message":"request timeout"}}`)
+}
+
+// streamingMiddleware - отменяет контекст потокового запроса, когда сервер начинает останавливаться.
+func (s *Server) streamingMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		defer func() {
-			start := time.Now()
-			s.log.Info(
-				"[REST]",
-				s.log.String("addr", r.RemoteAddr),
-				s.log.String("method", r.Method),
-				s.log.String("path", r.URL.Path),
-				s.log.String("proto", r.Proto),
-				s.log.Duration("duration", time.Since(start)),
-				s.log.String("user agent", r.UserAgent()),
-			)
+		ctx, cancel := context.WithCancel(r.Context())
+		defer cancel()
+
+		go func() {
+			select {
+			case <-s.stopping:
+				cancel()
+			case <-ctx.Done():
+			}
 		}()
-		next.ServeHTTP(w, r)
+
+		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
+
+// statusWriter - запоминает код и размер ответа. Flush нужен потоковым маршрутам.
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+	size   int64
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *statusWriter) Write(p []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(p)
+	w.size += int64(n)
+	return n, err
+}
+
+// code - код ответа, 200, если обработчик ничего не записал.
+func (w *statusWriter) code() int {
+	if w.status == 0 {
+		return http.StatusOK
+	}
+	return w.status
+}
+
+func (w *statusWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (s *Server) metricsMiddleware(route string) alice.Constructor {
+	return func(next http.Handler) http.Handler {
+		if s.metrics == nil {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			sw := &statusWriter{ResponseWriter: w}
+			next.ServeHTTP(sw, r)
+			s.metrics.ObserveRequest(route, sw.code(), time.Since(start))
+		})
+	}
+}
+
+// tracingMiddleware - серверный спан маршрута route, продолжает трассировку из заголовка traceparent запроса.
+func tracingMiddleware(route string) alice.Constructor {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+			ctx, span := tracer.Start(
+				ctx,
+				route,
+				trace.WithSpanKind(trace.SpanKindServer),
+				trace.WithAttributes(semconv.HTTPServerAttributesFromHTTPRequest("", route, r)...),
+			)
+			defer span.End()
+
+			sw := &statusWriter{ResponseWriter: w}
+			next.ServeHTTP(sw, r.WithContext(ctx))
+			span.SetAttributes(semconv.HTTPAttributesFromHTTPStatusCode(sw.code())...)
+			// Ответы 4xx - ошибка клиента, а не сервера, спан ими не помечается.
+			if sw.code() >= http.StatusInternalServerError {
+				span.SetStatus(codes.Error, http.StatusText(sw.code()))
+			}
+		})
+	}
+}
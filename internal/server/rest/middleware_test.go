@@ -0,0 +1,201 @@
+package rest
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nsmak/bannersRotation/internal/app"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+func TestTracingMiddlewareContinuesTrace(t *testing.T) {
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	defer otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator())
+
+	var got trace.SpanContext
+	handler := tracingMiddleware("GetBanner")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = trace.SpanContextFromContext(r.Context())
+	}))
+
+	r := httptest.NewRequest(http.MethodGet, "/banner", nil)
+	r.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	handler.ServeHTTP(httptest.NewRecorder(), r)
+
+	require.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", got.TraceID().String())
+}
+
+func TestRequestIDMiddleware(t *testing.T) {
+	var got string
+	handler := requestIDMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = app.RequestID(r.Context())
+	}))
+
+	tests := []struct {
+		name     string
+		incoming string
+		keep     bool
+	}{
+		{name: "incoming", incoming: "req-42", keep: true},
+		{name: "missing", incoming: ""},
+		{name: "with spaces", incoming: "req 42"},
+		{name: "too long", incoming: strings.Repeat("a", 129)},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/banner", nil)
+			r.Header.Set(RequestIDHeader, tc.incoming)
+			rec := httptest.NewRecorder()
+
+			handler.ServeHTTP(rec, r)
+
+			require.NotEmpty(t, got)
+			require.Equal(t, got, rec.Header().Get(RequestIDHeader))
+			if tc.keep {
+				require.Equal(t, tc.incoming, got)
+			} else {
+				require.NotEqual(t, tc.incoming, got)
+			}
+		})
+	}
+}
+
+func TestLoggingMiddleware(t *testing.T) {
+	log := &recordingLogger{entries: &[]map[string]interface{}{}}
+	s := NewServer("", log, nil)
+	handler := requestIDMiddleware(s.loggingMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(10 * time.Millisecond)
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte("hello"))
+	})))
+
+	r := httptest.NewRequest(http.MethodPost, "/banner", nil)
+	r.Header.Set(RequestIDHeader, "req-42")
+	handler.ServeHTTP(httptest.NewRecorder(), r)
+
+	require.Len(t, *log.entries, 1)
+	fields := (*log.entries)[0]
+	require.Equal(t, "req-42", fields["request_id"])
+	require.Equal(t, int64(http.StatusCreated), fields["status"])
+	require.Equal(t, int64(5), fields["size"])
+	require.GreaterOrEqual(t, fields["duration"].(time.Duration), 10*time.Millisecond)
+}
+
+func TestLoggingMiddlewareLogsErrorChain(t *testing.T) {
+	log := &recordingLogger{entries: &[]map[string]interface{}{}}
+	s := NewServer("", log, nil)
+	err := &app.BaseError{Message: `violates foreign key constraint "banner_slot_slot_id_fkey"`, Code: app.CodeNotFound}
+	handler := s.loggingMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		SendError(w, r, newError("can't add banner into slot", err), "")
+	}))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/slot/banner/add", nil))
+
+	var resp struct {
+		Error JSON `json:"error"`
+	}
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&resp))
+	require.Equal(t, "not found", resp.Error["message"])
+
+	require.Len(t, *log.entries, 1)
+	require.Equal(t, "can't add banner into slot --> "+err.Message, (*log.entries)[0]["error"])
+}
+
+// recordingLogger - запоминает поля каждой записи, логгеры из WithContext пишут в тот же список.
+type recordingLogger struct {
+	requestID string
+	entries   *[]map[string]interface{}
+}
+
+func (l *recordingLogger) WithContext(ctx context.Context) app.Logger {
+	return &recordingLogger{requestID: app.RequestID(ctx), entries: l.entries}
+}
+
+func (l *recordingLogger) Info(msg string, fields ...zap.Field) {
+	enc := zapcore.NewMapObjectEncoder()
+	for _, f := range fields {
+		f.AddTo(enc)
+	}
+	if l.requestID != "" {
+		enc.Fields["request_id"] = l.requestID
+	}
+	*l.entries = append(*l.entries, enc.Fields)
+}
+
+func (l *recordingLogger) Warn(msg string, fields ...zap.Field) {
+	l.Info(msg, fields...)
+}
+
+func (l *recordingLogger) Error(msg string, fields ...zap.Field) {
+	l.Info(msg, fields...)
+}
+
+func (l *recordingLogger) String(key string, val string) zap.Field {
+	return zap.String(key, val)
+}
+
+func (l *recordingLogger) Int64(key string, val int64) zap.Field {
+	return zap.Int64(key, val)
+}
+
+func (l *recordingLogger) Duration(key string, val time.Duration) zap.Field {
+	return zap.Duration(key, val)
+}
+
+type panicAPI struct{}
+
+func (panicAPI) Routes() []Route {
+	return []Route{{
+		Name:   "Panic",
+		Method: http.MethodGet,
+		Path:   "/panic",
+		Func:   func(w http.ResponseWriter, r *http.Request) { panic("boom") },
+	}}
+}
+
+type fakeMetrics struct {
+	statuses []int
+	panics   []string
+}
+
+func (m *fakeMetrics) ObserveRequest(route string, status int, duration time.Duration) {
+	m.statuses = append(m.statuses, status)
+}
+
+func (m *fakeMetrics) RecoveredPanic(route string) {
+	m.panics = append(m.panics, route)
+}
+
+func TestPanicMiddlewareRecovers(t *testing.T) {
+	log := &recordingLogger{entries: &[]map[string]interface{}{}}
+	metrics := &fakeMetrics{}
+	s := NewServer("", log, metrics, panicAPI{})
+
+	r := httptest.NewRequest(http.MethodGet, "/panic", nil)
+	r.Header.Set(RequestIDHeader, "req-42")
+	rec := httptest.NewRecorder()
+	s.router().ServeHTTP(rec, r)
+
+	require.Equal(t, http.StatusInternalServerError, rec.Code)
+	var resp Response
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&resp))
+	require.Equal(t, "internal server error", resp.Error["message"])
+
+	require.Equal(t, []string{"Panic"}, metrics.panics)
+	require.Equal(t, []int{http.StatusInternalServerError}, metrics.statuses)
+
+	entry := (*log.entries)[0]
+	require.Equal(t, "req-42", entry["request_id"])
+	require.Equal(t, "boom", entry["panic"])
+	require.Contains(t, entry["stack"], "panicAPI")
+}
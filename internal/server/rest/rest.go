@@ -5,6 +5,7 @@ import (
 	"context"
 	"encoding/json"
 	"net/http"
+	"sync"
 
 	"github.com/nsmak/bannersRotation/internal/app"
 )
@@ -20,7 +21,10 @@ func newError(msg string, err error) *restError {
 	}}
 }
 
-var statusCtxKey = NewContextKey("Status")
+var (
+	statusCtxKey = NewContextKey("Status")
+	errorCtxKey  = NewContextKey("Error")
+)
 
 type JSON map[string]interface{}
 
@@ -44,33 +48,146 @@ type API interface {
 	Routes() []Route
 }
 
+// Route - Streaming-маршруты отвечают дольше таймаута запроса (SSE, выгрузка файлов): для них таймаут не действует,
+// а контекст запроса отменяется при остановке сервера.
 type Route struct {
-	Name   string
-	Method string
-	Path   string
-	Func   http.HandlerFunc
+	Name      string
+	Method    string
+	Path      string
+	Func      http.HandlerFunc
+	Streaming bool
 }
 
 func status(r *http.Request, status int) {
 	*r = *r.WithContext(context.WithValue(r.Context(), statusCtxKey, status))
 }
 
+// HTTP статусы видов ошибок. Ошибка без вида - сбой хранилища или сервиса, на него отвечаем 500, а не 400,
+// чтобы клиент не считал свой запрос неверным.
+var errorStatuses = map[app.ErrorCode]int{
+	app.CodeNotFound:    http.StatusNotFound,
+	app.CodeValidation:  http.StatusBadRequest,
+	app.CodeConflict:    http.StatusConflict,
+	app.CodeUnavailable: http.StatusServiceUnavailable,
+	app.CodeInternal:    http.StatusInternalServerError,
+}
+
+// Сообщения видов ошибок. Сообщение не зависит от цепочки ошибки: в ней запросы, имена ограничений
+// и адреса хранилища, цепочка пишется только в лог запроса.
+var errorMessages = map[app.ErrorCode]string{
+	app.CodeNotFound:    "not found",
+	app.CodeValidation:  "invalid request",
+	app.CodeConflict:    "conflict",
+	app.CodeUnavailable: "temporarily unavailable",
+	app.CodeInternal:    "internal server error",
+}
+
+// SendError - отвечает ошибкой со статусом, кодом и сообщением по виду err, details добавляется к сообщению.
+func SendError(w http.ResponseWriter, r *http.Request, err error, details string) {
+	code := app.CodeOf(err)
+	message := errorMessages[code]
+	if details != "" {
+		message = details + ": " + message
+	}
+	recordError(r, err)
+	sendError(w, r, errorStatuses[code], code, message)
+}
+
+// SendErrorJSON - отвечает ошибкой с явным статусом, код ошибки определяется по статусу.
+// Ошибки домена отправляются через SendError.
 func SendErrorJSON(w http.ResponseWriter, r *http.Request, httpStatusCode int, err error, details string) {
-	e := newError(details, err)
+	recordError(r, err)
+	sendError(w, r, httpStatusCode, statusCode(httpStatusCode), errorMessage(err, details))
+}
+
+func sendError(w http.ResponseWriter, r *http.Request, httpStatusCode int, code app.ErrorCode, message string) {
 	resp := Response{
 		Data:  nil,
-		Error: JSON{"message": e.Error()},
+		Error: JSON{"code": code, "message": message},
 	}
 	status(r, httpStatusCode)
 	sendJSON(w, r, resp)
 }
 
+// requestError - ошибка, которой ответил обработчик, для строки лога запроса. Обработчик после таймаута
+// продолжает работать в своей горутине, поэтому доступ под мьютексом.
+type requestError struct {
+	mu  sync.Mutex
+	err error
+}
+
+func withRequestError(r *http.Request) (*http.Request, *requestError) {
+	re := &requestError{}
+	return r.WithContext(context.WithValue(r.Context(), errorCtxKey, re)), re
+}
+
+func recordError(r *http.Request, err error) {
+	re, ok := r.Context().Value(errorCtxKey).(*requestError)
+	if !ok || err == nil {
+		return
+	}
+	re.mu.Lock()
+	re.err = err
+	re.mu.Unlock()
+}
+
+func (e *requestError) message() string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.err == nil {
+		return ""
+	}
+	return e.err.Error()
+}
+
+func errorMessage(err error, details string) string {
+	if details == "" && err != nil {
+		return err.Error()
+	}
+	return newError(details, err).Error()
+}
+
+// statusCode - код ошибки для статуса ответа: статус без своего вида - ошибка клиента или сервера.
+func statusCode(httpStatusCode int) app.ErrorCode {
+	for code, s := range errorStatuses {
+		if s == httpStatusCode {
+			return code
+		}
+	}
+	if httpStatusCode >= http.StatusInternalServerError {
+		return app.CodeInternal
+	}
+	return app.CodeValidation
+}
+
 func SendDataJSON(w http.ResponseWriter, r *http.Request, httpStatusCode int, data interface{}) {
 	resp := Response{Data: data, Error: nil}
 	status(r, httpStatusCode)
 	sendJSON(w, r, resp)
 }
 
+// SendEvent - отправляет событие Server-Sent Events с data в JSON и сразу сбрасывает его клиенту.
+func SendEvent(w http.ResponseWriter, event string, data interface{}) error {
+	body, err := json.Marshal(data)
+	if err != nil {
+		return newError("can't encode event", err)
+	}
+
+	buf := &bytes.Buffer{}
+	buf.WriteString("event: " + event + "\n")
+	buf.WriteString("data: ")
+	buf.Write(body)
+	buf.WriteString("\n\n")
+	if _, err := w.Write(buf.Bytes()); err != nil {
+		return newError("can't send event", err)
+	}
+
+	if f, ok := w.(http.Flusher); ok {
+		f.Flush()
+	}
+	return nil
+}
+
 func sendJSON(w http.ResponseWriter, r *http.Request, v interface{}) {
 	buf := &bytes.Buffer{}
 	enc := json.NewEncoder(buf)
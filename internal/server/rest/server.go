@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"net/http"
+	"sync"
 	"time"
 
 	"github.com/gorilla/mux"
@@ -19,27 +20,49 @@ func newServerError(msg string, err error) *serverError {
 	return &serverError{BaseError: app.BaseError{Message: msg, Err: err}}
 }
 
+// Таймаут обычных маршрутов. У http.Server WriteTimeout не задан, иначе он обрывал бы потоковые ответы.
+const requestTimeout = 10 * time.Second
+
+// Metrics - метрики HTTP-запросов по имени маршрута.
+type Metrics interface {
+	ObserveRequest(route string, status int, duration time.Duration)
+	RecoveredPanic(route string)
+}
+
 type Server struct {
 	Address string
-	public  API
-	server  *http.Server
-	log     app.Logger
+	// DrainDelay - сколько Stop ждет после перевода /readyz в 503, прежде чем перестать принимать соединения.
+	DrainDelay time.Duration
+	// CrashOnPanic - завершать процесс при панике обработчика, а не отвечать 500. Для отладки.
+	CrashOnPanic bool
+
+	apis     []API
+	checks   []readinessCheck
+	server   *http.Server
+	log      app.Logger
+	metrics  Metrics
+	draining chan struct{}
+	stopping chan struct{}
+	stopOnce sync.Once
 }
 
-func NewServer(public API, address string, logger app.Logger) *Server {
+// NewServer - metrics может быть nil. Маршруты всех apis обслуживаются на одном адресе.
+func NewServer(address string, logger app.Logger, metrics Metrics, apis ...API) *Server {
 	return &Server{
-		Address: address,
-		public:  public,
-		log:     logger,
+		Address:  address,
+		apis:     apis,
+		log:      logger,
+		metrics:  metrics,
+		draining: make(chan struct{}),
+		stopping: make(chan struct{}),
 	}
 }
 
 func (s *Server) Start(ctx context.Context) error {
 	s.server = &http.Server{
-		Addr:         s.Address,
-		Handler:      s.router(),
-		ReadTimeout:  5 * time.Second,
-		WriteTimeout: 10 * time.Second,
+		Addr:        s.Address,
+		Handler:     s.router(),
+		ReadTimeout: 5 * time.Second,
 	}
 
 	err := s.server.ListenAndServe()
@@ -56,6 +79,18 @@ func (s *Server) Stop(ctx context.Context) error {
 		return newServerError("server is nil", nil)
 	}
 
+	s.stopOnce.Do(func() {
+		close(s.draining)
+		if s.DrainDelay > 0 {
+			select {
+			case <-time.After(s.DrainDelay):
+			case <-ctx.Done():
+			}
+		}
+		// Shutdown ждет завершения активных запросов, а потоковые сами не завершаются.
+		close(s.stopping)
+	})
+
 	if err := s.server.Shutdown(ctx); err != nil {
 		return newServerError("stop server error", err)
 	}
@@ -63,14 +98,32 @@ func (s *Server) Stop(ctx context.Context) error {
 }
 
 func (s *Server) router() *mux.Router {
+	routes := s.healthRoutes()
+	for _, api := range s.apis {
+		routes = append(routes, api.Routes()...)
+	}
+
 	router := mux.NewRouter()
-	for _, r := range s.public.Routes() {
-		handler := alice.New(s.panicMiddleware, s.loggingMiddleware).ThenFunc(r.Func)
+	for _, r := range routes {
+		chain := alice.New(
+			requestIDMiddleware,
+			s.loggingMiddleware,
+			s.metricsMiddleware(r.Name),
+			tracingMiddleware(r.Name),
+		)
+		if r.Streaming {
+			chain = chain.Append(s.streamingMiddleware)
+		} else {
+			chain = chain.Append(timeoutMiddleware)
+		}
+		// TimeoutHandler выполняет обработчик в отдельной горутине, паника перехватывается в ней,
+		// чтобы в лог попал стек обработчика.
+		chain = chain.Append(s.panicMiddleware(r.Name))
 		router.
 			Methods(r.Method).
 			Path(r.Path).
 			Name(r.Name).
-			Handler(handler)
+			Handler(chain.ThenFunc(r.Func))
 	}
 	return router
 }
@@ -0,0 +1,128 @@
+package ndjson
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/nsmak/bannersRotation/cmd/config"
+	"github.com/nsmak/bannersRotation/internal/app"
+	"github.com/nsmak/bannersRotation/internal/event"
+)
+
+const (
+	defaultPrefix = "statistic"
+	fileExt       = ".ndjson"
+	fileTimeFmt   = "20060102T150405.000000000"
+)
+
+// FileSink пишет события в файлы <prefix>-<time>.ndjson и начинает новый файл,
+// когда текущий превышает max_size_bytes или старше rotate_interval_sec.
+type FileSink struct {
+	dir            string
+	prefix         string
+	maxSize        int64
+	rotateInterval time.Duration
+
+	mu       sync.Mutex
+	file     *os.File
+	size     int64
+	openedAt time.Time
+	now      func() time.Time
+}
+
+func NewFileSink(cfg config.FileSink) (*FileSink, error) {
+	if err := os.MkdirAll(cfg.Dir, 0o755); err != nil {
+		return nil, newError("can't create sink dir", err)
+	}
+
+	prefix := cfg.Prefix
+	if prefix == "" {
+		prefix = defaultPrefix
+	}
+
+	return &FileSink{
+		dir:            cfg.Dir,
+		prefix:         prefix,
+		maxSize:        cfg.MaxSizeBytes,
+		rotateInterval: time.Duration(cfg.RotateIntervalSec) * time.Second,
+		now:            time.Now,
+	}, nil
+}
+
+func (s *FileSink) Publish(_ context.Context, msg app.Message) error {
+	if msg.ContentType != event.ContentTypeJSON {
+		return ErrNotJSON
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data := line(msg.Body)
+	if s.needRotate(int64(len(data))) {
+		if err := s.rotate(); err != nil {
+			return err
+		}
+	}
+
+	n, err := s.file.Write(data)
+	s.size += int64(n)
+	if err != nil {
+		return newError("can't write event", err)
+	}
+	return nil
+}
+
+func (s *FileSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.file == nil {
+		return nil
+	}
+	err := s.file.Close()
+	s.file = nil
+	return err
+}
+
+func (s *FileSink) needRotate(next int64) bool {
+	switch {
+	case s.file == nil:
+		return true
+	case s.maxSize > 0 && s.size > 0 && s.size+next > s.maxSize:
+		return true
+	case s.rotateInterval > 0 && s.now().Sub(s.openedAt) >= s.rotateInterval:
+		return true
+	default:
+		return false
+	}
+}
+
+func (s *FileSink) rotate() error {
+	if s.file != nil {
+		if err := s.file.Close(); err != nil {
+			return newError("can't close events file", err)
+		}
+		s.file = nil
+	}
+
+	now := s.now()
+	name := filepath.Join(s.dir, s.prefix+"-"+now.UTC().Format(fileTimeFmt)+fileExt)
+	file, err := os.OpenFile(name, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return newError("can't open events file", err)
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return newError("can't stat events file", err)
+	}
+
+	s.file = file
+	s.size = info.Size()
+	s.openedAt = now
+	return nil
+}
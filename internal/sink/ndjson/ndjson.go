@@ -0,0 +1,54 @@
+package ndjson
+
+import (
+	"context"
+	"io"
+	"sync"
+
+	"github.com/nsmak/bannersRotation/internal/app"
+	"github.com/nsmak/bannersRotation/internal/event"
+)
+
+type sinkError struct {
+	app.BaseError
+}
+
+func newError(msg string, err error) *sinkError {
+	return &sinkError{BaseError: app.BaseError{Message: msg, Err: err}}
+}
+
+var ErrNotJSON = newError("newline-delimited sink accepts only json events", nil)
+
+// WriterSink пишет события построчно в произвольный writer, например в stdout.
+type WriterSink struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func NewWriterSink(w io.Writer) *WriterSink {
+	return &WriterSink{w: w}
+}
+
+func (s *WriterSink) Publish(_ context.Context, msg app.Message) error {
+	if msg.ContentType != event.ContentTypeJSON {
+		return ErrNotJSON
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, err := s.w.Write(line(msg.Body)); err != nil {
+		return newError("can't write event", err)
+	}
+	return nil
+}
+
+func (s *WriterSink) Close() error {
+	return nil
+}
+
+func line(body []byte) []byte {
+	b := make([]byte, 0, len(body)+1)
+	b = append(b, body...)
+	return append(b, '\n')
+}
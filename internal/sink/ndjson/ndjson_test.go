@@ -0,0 +1,82 @@
+package ndjson
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/nsmak/bannersRotation/cmd/config"
+	"github.com/nsmak/bannersRotation/internal/app"
+	"github.com/nsmak/bannersRotation/internal/event"
+	"github.com/stretchr/testify/require"
+)
+
+func jsonMessage(body string) app.Message {
+	return app.Message{ID: "id", ContentType: event.ContentTypeJSON, Body: []byte(body)}
+}
+
+func TestWriterSink(t *testing.T) {
+	buf := &bytes.Buffer{}
+	sink := NewWriterSink(buf)
+
+	require.NoError(t, sink.Publish(context.Background(), jsonMessage(`{"a":1}`)))
+	require.NoError(t, sink.Publish(context.Background(), jsonMessage(`{"a":2}`)))
+
+	require.Equal(t, "{\"a\":1}\n{\"a\":2}\n", buf.String())
+}
+
+func TestRejectsProtobuf(t *testing.T) {
+	sink := NewWriterSink(&bytes.Buffer{})
+	msg := app.Message{ContentType: event.ContentTypeProtobuf, Body: []byte{1}}
+
+	err := sink.Publish(context.Background(), msg)
+	require.True(t, errors.Is(err, ErrNotJSON))
+}
+
+func TestFileSinkRotatesBySize(t *testing.T) {
+	dir := t.TempDir()
+	sink, err := NewFileSink(config.FileSink{Dir: dir, MaxSizeBytes: 16})
+	require.NoError(t, err)
+
+	now := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	sink.now = func() time.Time {
+		now = now.Add(time.Millisecond)
+		return now
+	}
+
+	for i := 0; i < 3; i++ {
+		require.NoError(t, sink.Publish(context.Background(), jsonMessage(`{"n":100}`)))
+	}
+	require.NoError(t, sink.Close())
+
+	files, err := filepath.Glob(filepath.Join(dir, "statistic-*.ndjson"))
+	require.NoError(t, err)
+	require.Len(t, files, 3)
+
+	data, err := ioutil.ReadFile(files[0])
+	require.NoError(t, err)
+	require.Equal(t, "{\"n\":100}\n", string(data))
+}
+
+func TestFileSinkRotatesByInterval(t *testing.T) {
+	dir := t.TempDir()
+	sink, err := NewFileSink(config.FileSink{Dir: dir, Prefix: "ev", RotateIntervalSec: 60})
+	require.NoError(t, err)
+
+	now := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	sink.now = func() time.Time { return now }
+
+	require.NoError(t, sink.Publish(context.Background(), jsonMessage(`{}`)))
+	require.NoError(t, sink.Publish(context.Background(), jsonMessage(`{}`)))
+	now = now.Add(time.Minute)
+	require.NoError(t, sink.Publish(context.Background(), jsonMessage(`{}`)))
+	require.NoError(t, sink.Close())
+
+	files, err := filepath.Glob(filepath.Join(dir, "ev-*.ndjson"))
+	require.NoError(t, err)
+	require.Len(t, files, 2)
+}
@@ -0,0 +1,113 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/nsmak/bannersRotation/cmd/config"
+	"github.com/nsmak/bannersRotation/internal/app"
+)
+
+const (
+	defaultTimeout = 5 * time.Second
+	defaultBackoff = 500 * time.Millisecond
+)
+
+type webhookError struct {
+	app.BaseError
+}
+
+func newError(msg string, err error) *webhookError {
+	return &webhookError{BaseError: app.BaseError{Message: msg, Err: err}}
+}
+
+// Sink отправляет каждое событие POST-запросом. Сетевые ошибки, 429 и 5xx повторяются
+// с экспоненциальной задержкой, остальные ответы не 2xx считаются окончательной ошибкой.
+type Sink struct {
+	url        string
+	headers    map[string]string
+	maxRetries int
+	backoff    time.Duration
+	client     *http.Client
+}
+
+func New(cfg config.WebhookSink) *Sink {
+	timeout := time.Duration(cfg.TimeoutMs) * time.Millisecond
+	if timeout <= 0 {
+		timeout = defaultTimeout
+	}
+	backoff := time.Duration(cfg.RetryBackoffMs) * time.Millisecond
+	if backoff <= 0 {
+		backoff = defaultBackoff
+	}
+
+	return &Sink{
+		url:        cfg.URL,
+		headers:    cfg.Headers,
+		maxRetries: cfg.MaxRetries,
+		backoff:    backoff,
+		client:     &http.Client{Timeout: timeout},
+	}
+}
+
+func (s *Sink) Publish(ctx context.Context, msg app.Message) error {
+	var err error
+	backoff := s.backoff
+	for attempt := 0; ; attempt++ {
+		var retry bool
+		retry, err = s.send(ctx, msg)
+		if err == nil {
+			return nil
+		}
+		if !retry || attempt >= s.maxRetries {
+			break
+		}
+
+		select {
+		case <-ctx.Done():
+			return newError("webhook delivery canceled", ctx.Err())
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+
+	return err
+}
+
+func (s *Sink) Close() error {
+	s.client.CloseIdleConnections()
+	return nil
+}
+
+func (s *Sink) send(ctx context.Context, msg app.Message) (retry bool, err error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(msg.Body))
+	if err != nil {
+		return false, newError("can't create request", err)
+	}
+	for k, v := range s.headers {
+		req.Header.Set(k, v)
+	}
+	req.Header.Set("Content-Type", msg.ContentType)
+	req.Header.Set("X-Event-ID", msg.ID)
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return true, newError("can't send event", err)
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(ioutil.Discard, resp.Body)
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return false, nil
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		return true, newError(fmt.Sprintf("webhook responded %d", resp.StatusCode), nil)
+	default:
+		return false, newError(fmt.Sprintf("webhook rejected event with %d", resp.StatusCode), nil)
+	}
+}
@@ -0,0 +1,72 @@
+package webhook_test
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/nsmak/bannersRotation/cmd/config"
+	"github.com/nsmak/bannersRotation/internal/app"
+	"github.com/nsmak/bannersRotation/internal/sink/webhook"
+	"github.com/stretchr/testify/require"
+)
+
+var msg = app.Message{ID: "event-1", ContentType: "application/json", Body: []byte(`{"type":"show"}`)}
+
+func TestPublishRetriesServerErrors(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		require.Equal(t, msg.Body, body)
+		require.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		require.Equal(t, "event-1", r.Header.Get("X-Event-ID"))
+		require.Equal(t, "secret", r.Header.Get("Authorization"))
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	sink := webhook.New(config.WebhookSink{
+		URL:            server.URL,
+		Headers:        map[string]string{"Authorization": "secret"},
+		MaxRetries:     3,
+		RetryBackoffMs: 1,
+	})
+
+	require.NoError(t, sink.Publish(context.Background(), msg))
+	require.Equal(t, int32(3), atomic.LoadInt32(&calls))
+}
+
+func TestPublishGivesUpAfterMaxRetries(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	sink := webhook.New(config.WebhookSink{URL: server.URL, MaxRetries: 2, RetryBackoffMs: 1})
+
+	require.Error(t, sink.Publish(context.Background(), msg))
+	require.Equal(t, int32(3), atomic.LoadInt32(&calls))
+}
+
+func TestPublishDoesNotRetryClientErrors(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	sink := webhook.New(config.WebhookSink{URL: server.URL, MaxRetries: 5, RetryBackoffMs: 1})
+
+	require.Error(t, sink.Publish(context.Background(), msg))
+	require.Equal(t, int32(1), atomic.LoadInt32(&calls))
+}
@@ -0,0 +1,364 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/nsmak/bannersRotation/cmd/config"
+	"github.com/nsmak/bannersRotation/internal/app"
+	"github.com/nsmak/bannersRotation/internal/storage"
+	"github.com/nsmak/bannersRotation/internal/tracing"
+)
+
+const (
+	defaultFlushInterval = time.Second
+	defaultFlushSize     = 500
+	defaultMaxStaleness  = 5 * time.Second
+)
+
+// ErrBufferFull - хранилище не успевает записывать события, клиенту стоит повторить запрос позже.
+var ErrBufferFull = &storage.Error{BaseError: app.BaseError{Message: "write buffer is full", Code: app.CodeUnavailable}}
+
+type slotKey struct {
+	slotID, socialID int64
+}
+
+type counterKey struct {
+	bannerID, slotID, socialID int64
+}
+
+type counts struct {
+	shows, clicks int64
+}
+
+type slotStats struct {
+	loadedAt time.Time
+	stats    []app.BannerSummary
+}
+
+// Storage - счетчики баннеров в памяти процесса поверх основного хранилища.
+// BannersStatistics отдается из памяти и перечитывается из хранилища не реже раза в max_staleness,
+// показы и клики копятся в буфере и пишутся пачкой раз в flush_interval или при flush_size событиях.
+// Хранилище отстает от памяти не больше чем на flush_interval, память от записей других
+// инстансов - не больше чем на max_staleness.
+type Storage struct {
+	app.Storage
+	writer app.EventBatchWriter
+	log    app.Logger
+
+	flushInterval time.Duration
+	flushSize     int
+	maxPending    int
+	maxStaleness  time.Duration
+
+	// flush держит ioMu на запись, перечитывание счетчиков - на чтение, чтобы не увидеть
+	// в хранилище пачку, которая еще не вычтена из unflushed.
+	ioMu sync.RWMutex
+
+	mu        sync.Mutex
+	slots     map[slotKey]*slotStats
+	pending   []app.BannerEvent
+	unflushed map[counterKey]*counts
+	lastTime  time.Time
+	flushCh   chan struct{}
+	now       func() time.Time
+}
+
+func New(store app.Storage, writer app.EventBatchWriter, cfg config.CacheConf, logger app.Logger) *Storage {
+	s := &Storage{
+		Storage:       store,
+		writer:        writer,
+		log:           logger,
+		flushInterval: time.Duration(cfg.FlushIntervalMs) * time.Millisecond,
+		flushSize:     cfg.FlushSize,
+		maxPending:    cfg.MaxPending,
+		maxStaleness:  time.Duration(cfg.MaxStalenessMs) * time.Millisecond,
+		slots:         map[slotKey]*slotStats{},
+		unflushed:     map[counterKey]*counts{},
+		flushCh:       make(chan struct{}, 1),
+		now:           time.Now,
+	}
+	if s.flushInterval <= 0 {
+		s.flushInterval = defaultFlushInterval
+	}
+	if s.flushSize <= 0 {
+		s.flushSize = defaultFlushSize
+	}
+	if s.maxPending < s.flushSize {
+		s.maxPending = s.flushSize * 10
+	}
+	if s.maxStaleness <= 0 {
+		s.maxStaleness = defaultMaxStaleness
+	}
+
+	return s
+}
+
+// Run - сбрасывает буфер по таймеру и по заполнению, пока не отменен ctx.
+func (s *Storage) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.flushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-s.flushCh:
+		}
+
+		if err := s.Flush(ctx); err != nil {
+			s.log.Error("can't flush banner events", s.log.String("msg", err.Error()))
+		}
+	}
+}
+
+// Flush - записывает накопленные события. Вызывается и при остановке сервиса.
+func (s *Storage) Flush(ctx context.Context) error {
+	s.ioMu.Lock()
+	defer s.ioMu.Unlock()
+
+	s.mu.Lock()
+	batch := s.pending
+	s.pending = nil
+	s.mu.Unlock()
+
+	if len(batch) == 0 {
+		return nil
+	}
+
+	written, err := s.write(ctx, batch)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, e := range batch[:written] {
+		key := counterKey{bannerID: e.BannerID, slotID: e.SlotID, socialID: e.SocialID}
+		c := s.unflushed[key]
+		if c == nil {
+			continue
+		}
+		c.add(e.Type, -1)
+		if c.shows == 0 && c.clicks == 0 {
+			delete(s.unflushed, key)
+		}
+	}
+
+	if err != nil {
+		s.pending = append(batch[written:], s.pending...)
+		return storage.NewError("can't write banner events", err)
+	}
+
+	return nil
+}
+
+func (s *Storage) AddBannerToSlot(ctx context.Context, bannerID, slotID int64) error {
+	err := s.Storage.AddBannerToSlot(ctx, bannerID, slotID)
+	s.invalidateSlot(slotID)
+	return err
+}
+
+func (s *Storage) RemoveBannerFromSlot(ctx context.Context, bannerID, slotID int64) error {
+	err := s.Storage.RemoveBannerFromSlot(ctx, bannerID, slotID)
+	s.invalidateSlot(slotID)
+	return err
+}
+
+func (s *Storage) BannersStatistics(ctx context.Context, slotID, socialID int64) ([]app.BannerSummary, error) {
+	key := slotKey{slotID: slotID, socialID: socialID}
+
+	s.mu.Lock()
+	if entry, ok := s.slots[key]; ok && s.now().Sub(entry.loadedAt) < s.maxStaleness {
+		stats := append([]app.BannerSummary(nil), entry.stats...)
+		s.mu.Unlock()
+		return stats, nil
+	}
+	s.mu.Unlock()
+
+	return s.load(ctx, key)
+}
+
+func (s *Storage) AddViewForBanner(ctx context.Context, bannerID, slotID, socialID int64) error {
+	return s.record(ctx, app.StatTypeShow, bannerID, slotID, socialID)
+}
+
+func (s *Storage) AddClickForBanner(ctx context.Context, bannerID, slotID, socialID int64) error {
+	return s.record(ctx, app.StatTypeClick, bannerID, slotID, socialID)
+}
+
+func (s *Storage) record(ctx context.Context, statType app.StatType, bannerID, slotID, socialID int64) error {
+	// Проверяем баннер заранее: ошибка внешнего ключа при записи пачки уже не дойдет до клиента.
+	stats, err := s.BannersStatistics(ctx, slotID, socialID)
+	if err != nil {
+		return err
+	}
+	if !containsBanner(stats, bannerID) {
+		return storage.NewError("banner is not in rotation for slot and group", storage.ErrObjectNotFound)
+	}
+
+	s.mu.Lock()
+	if len(s.pending) >= s.maxPending {
+		s.mu.Unlock()
+		return ErrBufferFull
+	}
+
+	s.pending = append(s.pending, app.BannerEvent{
+		Type:        statType,
+		BannerID:    bannerID,
+		SlotID:      slotID,
+		SocialID:    socialID,
+		OccurredAt:  s.eventTime(),
+		TraceParent: tracing.TraceParent(ctx),
+		RequestID:   app.RequestID(ctx),
+	})
+
+	key := counterKey{bannerID: bannerID, slotID: slotID, socialID: socialID}
+	c := s.unflushed[key]
+	if c == nil {
+		c = &counts{}
+		s.unflushed[key] = c
+	}
+	c.add(statType, 1)
+
+	if entry, ok := s.slots[slotKey{slotID: slotID, socialID: socialID}]; ok {
+		for i := range entry.stats {
+			if entry.stats[i].BannerID != bannerID {
+				continue
+			}
+			if statType == app.StatTypeClick {
+				entry.stats[i].ClickCount++
+			} else {
+				entry.stats[i].ShowCount++
+			}
+		}
+	}
+
+	full := len(s.pending) >= s.flushSize
+	s.mu.Unlock()
+
+	if full {
+		select {
+		case s.flushCh <- struct{}{}:
+		default:
+		}
+	}
+
+	return nil
+}
+
+func (s *Storage) load(ctx context.Context, key slotKey) ([]app.BannerSummary, error) {
+	s.ioMu.RLock()
+	defer s.ioMu.RUnlock()
+
+	stats, err := s.Storage.BannersStatistics(ctx, key.slotID, key.socialID)
+	if err != nil && !errors.Is(err, storage.ErrObjectNotFound) {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for ck, c := range s.unflushed {
+		if ck.slotID != key.slotID || ck.socialID != key.socialID {
+			continue
+		}
+		found := false
+		for i := range stats {
+			if stats[i].BannerID == ck.bannerID {
+				stats[i].ShowCount += c.shows
+				stats[i].ClickCount += c.clicks
+				found = true
+			}
+		}
+		if !found && c.shows > 0 {
+			stats = append(stats, app.BannerSummary{
+				BannerID:   ck.bannerID,
+				SlotID:     ck.slotID,
+				SocialID:   ck.socialID,
+				ShowCount:  c.shows,
+				ClickCount: c.clicks,
+			})
+		}
+	}
+
+	s.slots[key] = &slotStats{loadedAt: s.now(), stats: stats}
+	if len(stats) == 0 {
+		return nil, storage.ErrObjectNotFound
+	}
+
+	return append([]app.BannerSummary(nil), stats...), nil
+}
+
+// write - записывает пачку и возвращает, сколько событий с ее начала обработано.
+// Если в пачке есть событие с несуществующим баннером, события пишутся по одному,
+// а битые отбрасываются, чтобы они не блокировали запись навсегда.
+func (s *Storage) write(ctx context.Context, batch []app.BannerEvent) (int, error) {
+	err := s.writer.AddEvents(ctx, batch)
+	if err == nil {
+		return len(batch), nil
+	}
+	if !errors.Is(err, storage.ErrObjectNotFound) {
+		return 0, err
+	}
+
+	for i, e := range batch {
+		err := s.writer.AddEvents(ctx, batch[i:i+1])
+		if errors.Is(err, storage.ErrObjectNotFound) {
+			// Пачка пишется в фоне, поэтому запрос события восстанавливается из него самого.
+			s.log.WithContext(app.WithRequestID(ctx, e.RequestID)).Error(
+				"drop banner event",
+				s.log.Int64("banner_id", e.BannerID),
+				s.log.Int64("slot_id", e.SlotID),
+				s.log.Int64("social_id", e.SocialID),
+				s.log.String("msg", err.Error()),
+			)
+			continue
+		}
+		if err != nil {
+			return i, err
+		}
+	}
+
+	return len(batch), nil
+}
+
+func (s *Storage) invalidateSlot(slotID int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for key := range s.slots {
+		if key.slotID == slotID {
+			delete(s.slots, key)
+		}
+	}
+}
+
+// eventTime - время события, строго возрастающее с точностью до микросекунды,
+// чтобы события одного баннера из одной пачки не совпали по первичному ключу.
+func (s *Storage) eventTime() time.Time {
+	t := s.now().Truncate(time.Microsecond)
+	if !t.After(s.lastTime) {
+		t = s.lastTime.Add(time.Microsecond)
+	}
+	s.lastTime = t
+	return t
+}
+
+func (c *counts) add(statType app.StatType, n int64) {
+	if statType == app.StatTypeClick {
+		c.clicks += n
+	} else {
+		c.shows += n
+	}
+}
+
+func containsBanner(stats []app.BannerSummary, bannerID int64) bool {
+	for _, s := range stats {
+		if s.BannerID == bannerID {
+			return true
+		}
+	}
+	return false
+}
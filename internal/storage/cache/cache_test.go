@@ -0,0 +1,243 @@
+package cache_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nsmak/bannersRotation/cmd/config"
+	"github.com/nsmak/bannersRotation/internal/app"
+	"github.com/nsmak/bannersRotation/internal/storage"
+	"github.com/nsmak/bannersRotation/internal/storage/cache"
+	"github.com/stretchr/testify/suite"
+	"go.uber.org/zap"
+)
+
+var errWrite = errors.New("write error")
+
+type CacheSuite struct {
+	suite.Suite
+	ctx   context.Context
+	store *fakeStore
+	cache *cache.Storage
+}
+
+func (s *CacheSuite) SetupTest() {
+	s.ctx = context.Background()
+	s.store = &fakeStore{
+		stats: []app.BannerSummary{
+			{BannerID: 1, SlotID: 1, SocialID: 1, ShowCount: 10, ClickCount: 1},
+			{BannerID: 2, SlotID: 1, SocialID: 1, ShowCount: 5, ClickCount: 2},
+		},
+	}
+	s.cache = cache.New(s.store, s.store, config.CacheConf{
+		FlushIntervalMs: 10000,
+		FlushSize:       3,
+		MaxPending:      4,
+		MaxStalenessMs:  60000,
+	}, &mockLogger{})
+}
+
+func (s *CacheSuite) TestStatisticsServedFromMemory() {
+	for i := 0; i < 3; i++ {
+		stats, err := s.cache.BannersStatistics(s.ctx, 1, 1)
+		s.Require().NoError(err)
+		s.Require().Len(stats, 2)
+	}
+
+	s.Require().Equal(1, s.store.statsCalls)
+}
+
+func (s *CacheSuite) TestIncrementsVisibleBeforeFlush() {
+	s.Require().NoError(s.cache.AddViewForBanner(s.ctx, 1, 1, 1))
+	s.Require().NoError(s.cache.AddClickForBanner(s.ctx, 1, 1, 1))
+
+	stats, err := s.cache.BannersStatistics(s.ctx, 1, 1)
+
+	s.Require().NoError(err)
+	s.Require().Equal(int64(11), stats[0].ShowCount)
+	s.Require().Equal(int64(2), stats[0].ClickCount)
+	s.Require().Empty(s.store.written)
+}
+
+func (s *CacheSuite) TestFlushWritesBatch() {
+	s.Require().NoError(s.cache.AddViewForBanner(s.ctx, 1, 1, 1))
+	s.Require().NoError(s.cache.AddViewForBanner(s.ctx, 1, 1, 1))
+	s.Require().NoError(s.cache.AddClickForBanner(s.ctx, 2, 1, 1))
+
+	s.Require().NoError(s.cache.Flush(s.ctx))
+
+	s.Require().Len(s.store.written, 3)
+	s.Require().Equal(1, s.store.batches)
+	s.Require().True(s.store.written[0].OccurredAt.Before(s.store.written[1].OccurredAt))
+}
+
+func (s *CacheSuite) TestReloadDoesNotDoubleCount() {
+	s.cache = cache.New(s.store, s.store, config.CacheConf{FlushSize: 10, MaxStalenessMs: 1}, &mockLogger{})
+	s.Require().NoError(s.cache.AddViewForBanner(s.ctx, 1, 1, 1))
+	s.Require().NoError(s.cache.AddViewForBanner(s.ctx, 1, 1, 1))
+	s.Require().NoError(s.cache.Flush(s.ctx))
+	s.Require().NoError(s.cache.AddViewForBanner(s.ctx, 1, 1, 1))
+	time.Sleep(2 * time.Millisecond)
+
+	stats, err := s.cache.BannersStatistics(s.ctx, 1, 1)
+
+	s.Require().NoError(err)
+	s.Require().Equal(int64(13), stats[0].ShowCount)
+}
+
+func (s *CacheSuite) TestFailedFlushKeepsEvents() {
+	s.Require().NoError(s.cache.AddViewForBanner(s.ctx, 1, 1, 1))
+	s.store.writeErr = errWrite
+
+	err := s.cache.Flush(s.ctx)
+	s.Require().Error(err)
+	s.Require().True(errors.Is(err, errWrite))
+
+	s.store.writeErr = nil
+	s.Require().NoError(s.cache.Flush(s.ctx))
+	s.Require().Len(s.store.written, 1)
+}
+
+func (s *CacheSuite) TestBufferFull() {
+	s.store.writeErr = errWrite
+	for i := 0; i < 4; i++ {
+		s.Require().NoError(s.cache.AddViewForBanner(s.ctx, 1, 1, 1))
+	}
+
+	err := s.cache.AddViewForBanner(s.ctx, 1, 1, 1)
+
+	s.Require().True(errors.Is(err, cache.ErrBufferFull))
+}
+
+func (s *CacheSuite) TestUnknownBanner() {
+	err := s.cache.AddClickForBanner(s.ctx, 42, 1, 1)
+
+	s.Require().True(errors.Is(err, storage.ErrObjectNotFound))
+}
+
+func (s *CacheSuite) TestUnknownSlot() {
+	s.store.stats = nil
+
+	_, err := s.cache.BannersStatistics(s.ctx, 1, 1)
+
+	s.Require().True(errors.Is(err, storage.ErrObjectNotFound))
+}
+
+func (s *CacheSuite) TestAddBannerInvalidatesSlot() {
+	_, err := s.cache.BannersStatistics(s.ctx, 1, 1)
+	s.Require().NoError(err)
+
+	s.Require().NoError(s.cache.AddBannerToSlot(s.ctx, 3, 1))
+	_, err = s.cache.BannersStatistics(s.ctx, 1, 1)
+	s.Require().NoError(err)
+
+	s.Require().Equal(2, s.store.statsCalls)
+}
+
+func (s *CacheSuite) TestRunFlushesOnSize() {
+	ctx, cancel := context.WithCancel(s.ctx)
+	done := make(chan struct{})
+	go func() {
+		s.cache.Run(ctx)
+		close(done)
+	}()
+
+	for i := 0; i < 3; i++ {
+		s.Require().NoError(s.cache.AddViewForBanner(s.ctx, 1, 1, 1))
+	}
+
+	s.Require().Eventually(func() bool { return s.store.writtenCount() == 3 }, time.Second, time.Millisecond)
+	cancel()
+	<-done
+}
+
+func TestCacheSuite(t *testing.T) {
+	suite.Run(t, new(CacheSuite))
+}
+
+type fakeStore struct {
+	app.Storage
+	mu         sync.Mutex
+	stats      []app.BannerSummary
+	statsCalls int
+	written    []app.BannerEvent
+	batches    int
+	writeErr   error
+}
+
+func (f *fakeStore) AddBannerToSlot(_ context.Context, _, _ int64) error {
+	return nil
+}
+
+func (f *fakeStore) BannersStatistics(_ context.Context, _, _ int64) ([]app.BannerSummary, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.statsCalls++
+	if len(f.stats) == 0 {
+		return nil, storage.ErrObjectNotFound
+	}
+	return append([]app.BannerSummary(nil), f.stats...), nil
+}
+
+func (f *fakeStore) AddEvents(_ context.Context, events []app.BannerEvent) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.writeErr != nil {
+		return f.writeErr
+	}
+	f.batches++
+	f.written = append(f.written, events...)
+	for _, e := range events {
+		for i := range f.stats {
+			if f.stats[i].BannerID != e.BannerID {
+				continue
+			}
+			if e.Type == app.StatTypeClick {
+				f.stats[i].ClickCount++
+			} else {
+				f.stats[i].ShowCount++
+			}
+		}
+	}
+	return nil
+}
+
+func (f *fakeStore) writtenCount() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return len(f.written)
+}
+
+type mockLogger struct {
+}
+
+func (m *mockLogger) WithContext(ctx context.Context) app.Logger {
+	return m
+}
+
+func (m *mockLogger) Info(msg string, fields ...zap.Field) {
+}
+
+func (m *mockLogger) Warn(msg string, fields ...zap.Field) {
+}
+
+func (m *mockLogger) Error(msg string, fields ...zap.Field) {
+}
+
+func (m *mockLogger) String(key string, val string) zap.Field {
+	return zap.Field{}
+}
+
+func (m *mockLogger) Int64(key string, val int64) zap.Field {
+	return zap.Field{}
+}
+
+func (m *mockLogger) Duration(key string, val time.Duration) zap.Field {
+	return zap.Field{}
+}
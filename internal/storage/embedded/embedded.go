@@ -0,0 +1,262 @@
+package embedded
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"time"
+
+	"github.com/nsmak/bannersRotation/internal/app"
+	"github.com/nsmak/bannersRotation/internal/storage"
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	bannersBucket     = []byte("banner")
+	slotsBucket       = []byte("slot")
+	groupsBucket      = []byte("social_dem")
+	bannerSlotsBucket = []byte("banner_slot")
+	countersBucket    = []byte("banner_counters")
+
+	// Раньше файл хранил сырые события и outbox, которые никто не читал: сервис статистики работает
+	// только с postgres. При открытии эти бакеты удаляются, чтобы файл не рос с каждым событием.
+	droppedBuckets = [][]byte{[]byte("banner_showing"), []byte("banner_click"), []byte("statistic_outbox")}
+)
+
+// Storage - реализация app.Storage поверх bbolt: все данные лежат в одном локальном файле.
+// Хранятся только счетчики ротации, размер файла не зависит от числа событий.
+// Ключи бакетов - big-endian числа, поэтому счетчики слота читаются одним проходом курсора.
+//
+//	banner, slot, social_dem  id -> описание
+//	banner_slot               banner_id|slot_id -> пусто
+//	banner_counters           slot_id|social_id|banner_id -> shows|clicks
+type Storage struct {
+	db *bolt.DB
+}
+
+// Open - открывает файл базы, создавая его и бакеты при первом запуске.
+func Open(path string) (*Storage, error) {
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, storage.NewError("can't open database file", err)
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{bannersBucket, slotsBucket, groupsBucket, bannerSlotsBucket, countersBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		for _, name := range droppedBuckets {
+			if err := tx.DeleteBucket(name); err != nil && !errors.Is(err, bolt.ErrBucketNotFound) {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		_ = db.Close()
+		return nil, storage.NewError("can't create buckets", err)
+	}
+
+	return &Storage{db: db}, nil
+}
+
+func (s *Storage) Close() error {
+	return s.db.Close()
+}
+
+// LoadDefaults - добавляет баннеры, слоты и группы миграции init, которых еще нет в базе.
+func (s *Storage) LoadDefaults() error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		for _, banner := range storage.DefaultBanners {
+			if err := putIfAbsent(tx.Bucket(bannersBucket), banner.ID, banner.Description); err != nil {
+				return err
+			}
+		}
+		for _, slot := range storage.DefaultSlots {
+			if err := putIfAbsent(tx.Bucket(slotsBucket), slot.ID, slot.Description); err != nil {
+				return err
+			}
+		}
+		for _, group := range storage.DefaultGroups {
+			if err := putIfAbsent(tx.Bucket(groupsBucket), group.ID, group.Description); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *Storage) AddBanner(banner app.Banner) error {
+	return s.put(bannersBucket, banner.ID, banner.Description)
+}
+
+func (s *Storage) AddSlot(slot app.Slot) error {
+	return s.put(slotsBucket, slot.ID, slot.Description)
+}
+
+func (s *Storage) AddSocialGroup(group app.SocialGroup) error {
+	return s.put(groupsBucket, group.ID, group.Description)
+}
+
+func (s *Storage) AddBannerToSlot(_ context.Context, bannerID, slotID int64) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		if tx.Bucket(bannersBucket).Get(key(bannerID)) == nil {
+			return storage.NewError("unknown banner", storage.ErrObjectNotFound)
+		}
+		if tx.Bucket(slotsBucket).Get(key(slotID)) == nil {
+			return storage.NewError("unknown slot", storage.ErrObjectNotFound)
+		}
+
+		bannerSlots := tx.Bucket(bannerSlotsBucket)
+		k := key(bannerID, slotID)
+		if bannerSlots.Get(k) != nil {
+			return storage.NewError("can't add banner into slot", storage.ErrAlreadyExists)
+		}
+		if err := bannerSlots.Put(k, []byte{}); err != nil {
+			return storage.NewError("can't add banner into slot", err)
+		}
+
+		// Как и в Postgres, новый баннер получает по одному показу в каждой группе,
+		// чтобы попасть в статистику слота.
+		return tx.Bucket(groupsBucket).ForEach(func(k, _ []byte) error {
+			return count(tx, app.StatTypeShow, bannerID, slotID, id(k))
+		})
+	})
+}
+
+func (s *Storage) RemoveBannerFromSlot(_ context.Context, bannerID, slotID int64) error {
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(bannerSlotsBucket).Delete(key(bannerID, slotID))
+	})
+	if err != nil {
+		return storage.NewError("can't remove banner from slot", err)
+	}
+	return nil
+}
+
+func (s *Storage) BannersStatistics(_ context.Context, slotID, socialID int64) ([]app.BannerSummary, error) {
+	var stats []app.BannerSummary
+	err := s.db.View(func(tx *bolt.Tx) error {
+		prefix := key(slotID, socialID)
+		c := tx.Bucket(countersBucket).Cursor()
+		for k, v := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
+			shows, clicks := id(v[:8]), id(v[8:])
+			if shows == 0 {
+				continue
+			}
+			stats = append(stats, app.BannerSummary{
+				BannerID:   id(k[16:]),
+				SlotID:     slotID,
+				SocialID:   socialID,
+				ShowCount:  shows,
+				ClickCount: clicks,
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, storage.NewError("can't get banners statistics", err)
+	}
+
+	if len(stats) == 0 {
+		return nil, storage.ErrObjectNotFound
+	}
+
+	return stats, nil
+}
+
+func (s *Storage) AddViewForBanner(_ context.Context, bannerID, slotID, socialID int64) error {
+	return s.record(app.StatTypeShow, bannerID, slotID, socialID)
+}
+
+func (s *Storage) AddClickForBanner(_ context.Context, bannerID, slotID, socialID int64) error {
+	return s.record(app.StatTypeClick, bannerID, slotID, socialID)
+}
+
+func (s *Storage) AddEvents(_ context.Context, events []app.BannerEvent) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		for _, e := range events {
+			if err := checkRefs(tx, e.BannerID, e.SlotID, e.SocialID); err != nil {
+				return err
+			}
+			if err := count(tx, e.Type, e.BannerID, e.SlotID, e.SocialID); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *Storage) record(statType app.StatType, bannerID, slotID, socialID int64) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		if err := checkRefs(tx, bannerID, slotID, socialID); err != nil {
+			return err
+		}
+
+		return count(tx, statType, bannerID, slotID, socialID)
+	})
+}
+
+func (s *Storage) put(bucket []byte, objectID int64, description string) error {
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucket).Put(key(objectID), []byte(description))
+	})
+	if err != nil {
+		return storage.NewError("can't save object", err)
+	}
+	return nil
+}
+
+func checkRefs(tx *bolt.Tx, bannerID, slotID, socialID int64) error {
+	if tx.Bucket(bannersBucket).Get(key(bannerID)) == nil {
+		return storage.NewError("unknown banner", storage.ErrObjectNotFound)
+	}
+	if tx.Bucket(slotsBucket).Get(key(slotID)) == nil {
+		return storage.NewError("unknown slot", storage.ErrObjectNotFound)
+	}
+	if tx.Bucket(groupsBucket).Get(key(socialID)) == nil {
+		return storage.NewError("unknown social group", storage.ErrObjectNotFound)
+	}
+	return nil
+}
+
+// count - увеличивает счетчик показов или кликов баннера.
+func count(tx *bolt.Tx, statType app.StatType, bannerID, slotID, socialID int64) error {
+	counters := tx.Bucket(countersBucket)
+	ck := key(slotID, socialID, bannerID)
+	value := make([]byte, 16)
+	copy(value, counters.Get(ck))
+	offset := 0
+	if statType == app.StatTypeClick {
+		offset = 8
+	}
+	binary.BigEndian.PutUint64(value[offset:], binary.BigEndian.Uint64(value[offset:])+1)
+	if err := counters.Put(ck, value); err != nil {
+		return storage.NewError("can't update banner counters", err)
+	}
+
+	return nil
+}
+
+func putIfAbsent(bucket *bolt.Bucket, objectID int64, description string) error {
+	if bucket.Get(key(objectID)) != nil {
+		return nil
+	}
+	return bucket.Put(key(objectID), []byte(description))
+}
+
+// key - склеивает числа в ключ, сохраняющий их порядок при побайтовом сравнении.
+func key(ids ...int64) []byte {
+	k := make([]byte, 8*len(ids))
+	for i, v := range ids {
+		binary.BigEndian.PutUint64(k[8*i:], uint64(v))
+	}
+	return k
+}
+
+func id(b []byte) int64 {
+	return int64(binary.BigEndian.Uint64(b))
+}
@@ -0,0 +1,81 @@
+package embedded_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/nsmak/bannersRotation/internal/app"
+	"github.com/nsmak/bannersRotation/internal/storage/embedded"
+	"github.com/nsmak/bannersRotation/internal/storage/storagetest"
+	"github.com/stretchr/testify/require"
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestConformance(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) (app.Storage, storagetest.Fixture) {
+		s, err := embedded.Open(filepath.Join(t.TempDir(), "rotator.db"))
+		require.NoError(t, err)
+		t.Cleanup(func() { _ = s.Close() })
+
+		for id := int64(1); id <= 3; id++ {
+			require.NoError(t, s.AddBanner(app.Banner{ID: id}))
+			require.NoError(t, s.AddSlot(app.Slot{ID: id}))
+			require.NoError(t, s.AddSocialGroup(app.SocialGroup{ID: id}))
+		}
+		return s, storagetest.Fixture{
+			Banners: []int64{1, 2, 3},
+			Slots:   []int64{1, 2, 3},
+			Groups:  []int64{1, 2, 3},
+			Unknown: 100,
+		}
+	})
+}
+
+func TestDataSurvivesReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rotator.db")
+	ctx := context.Background()
+
+	s, err := embedded.Open(path)
+	require.NoError(t, err)
+	require.NoError(t, s.LoadDefaults())
+	require.NoError(t, s.AddBannerToSlot(ctx, 1, 1))
+	require.NoError(t, s.AddClickForBanner(ctx, 1, 1, 2))
+	require.NoError(t, s.Close())
+
+	s, err = embedded.Open(path)
+	require.NoError(t, err)
+	defer s.Close()
+	require.NoError(t, s.LoadDefaults())
+
+	stats, err := s.BannersStatistics(ctx, 1, 2)
+	require.NoError(t, err)
+	require.Equal(t, []app.BannerSummary{{BannerID: 1, SlotID: 1, SocialID: 2, ShowCount: 1, ClickCount: 1}}, stats)
+}
+
+func TestOpenDropsEventBuckets(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rotator.db")
+
+	db, err := bolt.Open(path, 0o600, nil)
+	require.NoError(t, err)
+	require.NoError(t, db.Update(func(tx *bolt.Tx) error {
+		outbox, err := tx.CreateBucket([]byte("statistic_outbox"))
+		if err != nil {
+			return err
+		}
+		return outbox.Put([]byte{1}, []byte{1})
+	}))
+	require.NoError(t, db.Close())
+
+	s, err := embedded.Open(path)
+	require.NoError(t, err)
+	require.NoError(t, s.Close())
+
+	db, err = bolt.Open(path, 0o600, nil)
+	require.NoError(t, err)
+	defer db.Close()
+	require.NoError(t, db.View(func(tx *bolt.Tx) error {
+		require.Nil(t, tx.Bucket([]byte("statistic_outbox")))
+		return nil
+	}))
+}
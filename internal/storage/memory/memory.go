@@ -0,0 +1,199 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"github.com/nsmak/bannersRotation/internal/app"
+	"github.com/nsmak/bannersRotation/internal/storage"
+)
+
+type bannerSlotKey struct {
+	bannerID, slotID int64
+}
+
+type counterKey struct {
+	slotID, socialID, bannerID int64
+}
+
+type counts struct {
+	shows, clicks int64
+}
+
+// Storage - потокобезопасная реализация app.Storage в памяти процесса
+// с той же семантикой ошибок, что и у хранилища на Postgres.
+// Хранятся только счетчики ротации, поэтому память не растет с каждым событием.
+type Storage struct {
+	mu          sync.RWMutex
+	banners     map[int64]app.Banner
+	slots       map[int64]app.Slot
+	groups      map[int64]app.SocialGroup
+	bannerSlots map[bannerSlotKey]struct{}
+	counters    map[counterKey]*counts
+}
+
+func New() *Storage {
+	return &Storage{
+		banners:     map[int64]app.Banner{},
+		slots:       map[int64]app.Slot{},
+		groups:      map[int64]app.SocialGroup{},
+		bannerSlots: map[bannerSlotKey]struct{}{},
+		counters:    map[counterKey]*counts{},
+	}
+}
+
+// LoadDefaults - заполняет хранилище теми же баннерами, слотами и группами, что и миграция init.
+func (s *Storage) LoadDefaults() {
+	for _, banner := range storage.DefaultBanners {
+		s.AddBanner(banner)
+	}
+	for _, slot := range storage.DefaultSlots {
+		s.AddSlot(slot)
+	}
+	for _, group := range storage.DefaultGroups {
+		s.AddSocialGroup(group)
+	}
+}
+
+func (s *Storage) AddBanner(banner app.Banner) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.banners[banner.ID] = banner
+}
+
+func (s *Storage) AddSlot(slot app.Slot) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.slots[slot.ID] = slot
+}
+
+func (s *Storage) AddSocialGroup(group app.SocialGroup) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.groups[group.ID] = group
+}
+
+func (s *Storage) AddBannerToSlot(_ context.Context, bannerID, slotID int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.banners[bannerID]; !ok {
+		return storage.NewError("unknown banner", storage.ErrObjectNotFound)
+	}
+	if _, ok := s.slots[slotID]; !ok {
+		return storage.NewError("unknown slot", storage.ErrObjectNotFound)
+	}
+
+	key := bannerSlotKey{bannerID: bannerID, slotID: slotID}
+	if _, ok := s.bannerSlots[key]; ok {
+		return storage.NewError("can't add banner into slot", storage.ErrAlreadyExists)
+	}
+	s.bannerSlots[key] = struct{}{}
+
+	// Как и в Postgres, новый баннер получает по одному показу в каждой группе,
+	// чтобы попасть в статистику слота.
+	for groupID := range s.groups {
+		s.count(app.StatTypeShow, bannerID, slotID, groupID)
+	}
+
+	return nil
+}
+
+func (s *Storage) RemoveBannerFromSlot(_ context.Context, bannerID, slotID int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.bannerSlots, bannerSlotKey{bannerID: bannerID, slotID: slotID})
+	return nil
+}
+
+func (s *Storage) BannersStatistics(_ context.Context, slotID, socialID int64) ([]app.BannerSummary, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var stats []app.BannerSummary
+	for key, c := range s.counters {
+		if key.slotID != slotID || key.socialID != socialID || c.shows == 0 {
+			continue
+		}
+		stats = append(stats, app.BannerSummary{
+			BannerID:   key.bannerID,
+			SlotID:     key.slotID,
+			SocialID:   key.socialID,
+			ShowCount:  c.shows,
+			ClickCount: c.clicks,
+		})
+	}
+
+	if len(stats) == 0 {
+		return nil, storage.ErrObjectNotFound
+	}
+
+	sort.Slice(stats, func(i, j int) bool { return stats[i].BannerID < stats[j].BannerID })
+	return stats, nil
+}
+
+func (s *Storage) AddViewForBanner(_ context.Context, bannerID, slotID, socialID int64) error {
+	return s.record(app.StatTypeShow, bannerID, slotID, socialID)
+}
+
+func (s *Storage) AddClickForBanner(_ context.Context, bannerID, slotID, socialID int64) error {
+	return s.record(app.StatTypeClick, bannerID, slotID, socialID)
+}
+
+func (s *Storage) AddEvents(_ context.Context, events []app.BannerEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, e := range events {
+		if err := s.checkRefs(e.BannerID, e.SlotID, e.SocialID); err != nil {
+			return err
+		}
+	}
+
+	for _, e := range events {
+		s.count(e.Type, e.BannerID, e.SlotID, e.SocialID)
+	}
+
+	return nil
+}
+
+func (s *Storage) record(statType app.StatType, bannerID, slotID, socialID int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.checkRefs(bannerID, slotID, socialID); err != nil {
+		return err
+	}
+
+	s.count(statType, bannerID, slotID, socialID)
+	return nil
+}
+
+func (s *Storage) checkRefs(bannerID, slotID, socialID int64) error {
+	if _, ok := s.banners[bannerID]; !ok {
+		return storage.NewError("unknown banner", storage.ErrObjectNotFound)
+	}
+	if _, ok := s.slots[slotID]; !ok {
+		return storage.NewError("unknown slot", storage.ErrObjectNotFound)
+	}
+	if _, ok := s.groups[socialID]; !ok {
+		return storage.NewError("unknown social group", storage.ErrObjectNotFound)
+	}
+	return nil
+}
+
+func (s *Storage) count(statType app.StatType, bannerID, slotID, socialID int64) {
+	key := counterKey{slotID: slotID, socialID: socialID, bannerID: bannerID}
+	c := s.counters[key]
+	if c == nil {
+		c = &counts{}
+		s.counters[key] = c
+	}
+	if statType == app.StatTypeClick {
+		c.clicks++
+	} else {
+		c.shows++
+	}
+}
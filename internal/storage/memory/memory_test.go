@@ -0,0 +1,68 @@
+package memory_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/nsmak/bannersRotation/internal/app"
+	"github.com/nsmak/bannersRotation/internal/storage"
+	"github.com/nsmak/bannersRotation/internal/storage/memory"
+	"github.com/nsmak/bannersRotation/internal/storage/storagetest"
+	"github.com/stretchr/testify/require"
+)
+
+func newStorage(t *testing.T) *memory.Storage {
+	t.Helper()
+
+	s := memory.New()
+	s.LoadDefaults()
+	require.NoError(t, s.AddBannerToSlot(context.Background(), 1, 1))
+	require.NoError(t, s.AddBannerToSlot(context.Background(), 2, 1))
+	return s
+}
+
+func TestConformance(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) (app.Storage, storagetest.Fixture) {
+		s := memory.New()
+		for id := int64(1); id <= 3; id++ {
+			s.AddBanner(app.Banner{ID: id})
+			s.AddSlot(app.Slot{ID: id})
+			s.AddSocialGroup(app.SocialGroup{ID: id})
+		}
+		return s, storagetest.Fixture{
+			Banners: []int64{1, 2, 3},
+			Slots:   []int64{1, 2, 3},
+			Groups:  []int64{1, 2, 3},
+			Unknown: 100,
+		}
+	})
+}
+
+func TestAddBannerToSlotTwice(t *testing.T) {
+	s := newStorage(t)
+
+	err := s.AddBannerToSlot(context.Background(), 1, 1)
+
+	require.True(t, errors.Is(err, storage.ErrAlreadyExists))
+}
+
+func TestAddEventsIsAtomic(t *testing.T) {
+	s := newStorage(t)
+	ctx := context.Background()
+	now := time.Now()
+
+	err := s.AddEvents(ctx, []app.BannerEvent{
+		{Type: app.StatTypeShow, BannerID: 1, SlotID: 1, SocialID: 1, OccurredAt: now},
+		{Type: app.StatTypeClick, BannerID: 100, SlotID: 1, SocialID: 1, OccurredAt: now},
+	})
+	require.True(t, errors.Is(err, storage.ErrObjectNotFound))
+
+	stats, err := s.BannersStatistics(ctx, 1, 1)
+	require.NoError(t, err)
+	require.Equal(t, []app.BannerSummary{
+		{BannerID: 1, SlotID: 1, SocialID: 1, ShowCount: 1},
+		{BannerID: 2, SlotID: 1, SocialID: 1, ShowCount: 1},
+	}, stats)
+}
@@ -0,0 +1,176 @@
+package sql
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/jackc/pgconn"
+	"github.com/jmoiron/sqlx"
+	"github.com/nsmak/bannersRotation/internal/app"
+	"github.com/nsmak/bannersRotation/internal/storage"
+)
+
+// Postgres ограничивает число параметров запроса 65535.
+const maxBatchRows = 9000
+
+type counterKey struct {
+	bannerID, slotID, socialID int64
+}
+
+type counterDelta struct {
+	shows, clicks int64
+}
+
+// eventRow - событие и id его строки в banner_showing/banner_click.
+type eventRow struct {
+	app.BannerEvent
+	id int64
+}
+
+func (s *BannerDataStore) AddEvents(ctx context.Context, events []app.BannerEvent) (err error) {
+	ctx, call := s.startCall(ctx, "AddEvents")
+	defer func() { call.end(err) }()
+
+	if len(events) == 0 {
+		return nil
+	}
+
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return storage.NewError("can't start transactions", err)
+	}
+	defer tx.Rollback() // nolint: errcheck
+
+	rows := make([]eventRow, len(events))
+	byType := map[app.StatType][]*eventRow{}
+	deltas := map[counterKey]*counterDelta{}
+	for i, e := range events {
+		rows[i].BannerEvent = e
+		byType[e.Type] = append(byType[e.Type], &rows[i])
+
+		key := counterKey{bannerID: e.BannerID, slotID: e.SlotID, socialID: e.SocialID}
+		d, ok := deltas[key]
+		if !ok {
+			d = &counterDelta{}
+			deltas[key] = d
+		}
+		if e.Type == app.StatTypeClick {
+			d.clicks++
+		} else {
+			d.shows++
+		}
+	}
+
+	for statType, typed := range byType {
+		table, ok := eventTables[statType]
+		if !ok {
+			return storage.NewError("unknown event type "+string(statType), nil)
+		}
+		ids, err := reserveEventIDs(ctx, tx, table, len(typed))
+		if err != nil {
+			return storage.NewError("can't reserve event ids", err)
+		}
+		for i, row := range typed {
+			row.id = ids[i]
+		}
+		if err := insertEvents(ctx, tx, table, typed); err != nil {
+			return mapBatchError(err)
+		}
+	}
+
+	if err := insertOutbox(ctx, tx, rows); err != nil {
+		return mapBatchError(err)
+	}
+
+	for key, d := range deltas {
+		_, err := tx.ExecContext(
+			ctx,
+			`INSERT INTO banner_counters (banner_id, slot_id, social_id, shows, clicks) VALUES ($1, $2, $3, $4, $5)
+				ON CONFLICT (slot_id, social_id, banner_id) DO UPDATE
+				SET shows = banner_counters.shows + EXCLUDED.shows, clicks = banner_counters.clicks + EXCLUDED.clicks`,
+			key.bannerID, key.slotID, key.socialID, d.shows, d.clicks,
+		)
+		if err != nil {
+			return mapBatchError(err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return storage.NewError("can't commit transactions", err)
+	}
+
+	return nil
+}
+
+// reserveEventIDs берет n id из последовательности таблицы событий заранее,
+// чтобы записать тот же id и в таблицу событий, и в outbox.
+func reserveEventIDs(ctx context.Context, tx *sqlx.Tx, table string, n int) ([]int64, error) {
+	var ids []int64
+	err := tx.SelectContext(
+		ctx,
+		&ids,
+		"SELECT nextval(pg_get_serial_sequence($1, 'id')) FROM generate_series(1, $2)",
+		table, n,
+	)
+	return ids, err
+}
+
+func insertEvents(ctx context.Context, tx *sqlx.Tx, table string, events []*eventRow) error {
+	return insertChunks(len(events), 5, func(from, to int, values string, args []interface{}) error {
+		for _, e := range events[from:to] {
+			args = append(args, e.id, e.BannerID, e.SlotID, e.SocialID, e.OccurredAt)
+		}
+		_, err := tx.ExecContext(ctx, "INSERT INTO "+table+" (id, banner_id, slot_id, social_id, date) VALUES "+values, args...)
+		return err
+	})
+}
+
+func insertOutbox(ctx context.Context, tx *sqlx.Tx, events []eventRow) error {
+	return insertChunks(len(events), 7, func(from, to int, values string, args []interface{}) error {
+		for _, e := range events[from:to] {
+			args = append(args, string(e.Type), e.id, e.BannerID, e.SlotID, e.SocialID, e.OccurredAt, e.TraceParent)
+		}
+		_, err := tx.ExecContext(
+			ctx,
+			"INSERT INTO statistic_outbox (type, event_id, banner_id, slot_id, social_id, date, trace_parent) VALUES "+values,
+			args...,
+		)
+		return err
+	})
+}
+
+// insertChunks делит total событий на части [from, to) и передает fn строку VALUES с плейсхолдерами
+// для columns колонок на каждое событие.
+func insertChunks(total, columns int, fn func(from, to int, values string, args []interface{}) error) error {
+	for from := 0; from < total; from += maxBatchRows {
+		to := from + maxBatchRows
+		if to > total {
+			to = total
+		}
+
+		rows := make([]string, 0, to-from)
+		for i := 0; i < to-from; i++ {
+			placeholders := make([]string, 0, columns)
+			for c := 1; c <= columns; c++ {
+				placeholders = append(placeholders, fmt.Sprintf("$%d", i*columns+c))
+			}
+			rows = append(rows, "("+strings.Join(placeholders, ", ")+")")
+		}
+
+		if err := fn(from, to, strings.Join(rows, ", "), make([]interface{}, 0, (to-from)*columns)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func mapBatchError(err error) error {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == violatesForeignKeyConstraintCode {
+		return storage.NewError("can't add events", storage.ErrObjectNotFound)
+	}
+	return storage.NewError("can't add events", err)
+}
@@ -0,0 +1,51 @@
+package sql
+
+import (
+	"context"
+	"time"
+
+	"github.com/nsmak/bannersRotation/internal/tracing"
+	"go.opentelemetry.io/otel"
+	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = otel.Tracer("github.com/nsmak/bannersRotation/internal/storage/sql")
+
+// QueryObserver - получает длительность каждого вызова метода хранилища, например metrics.Metrics.
+type QueryObserver interface {
+	ObserveQuery(method string, duration time.Duration, err error)
+}
+
+type nopObserver struct{}
+
+func (nopObserver) ObserveQuery(string, time.Duration, error) {}
+
+// ObserveQueries - передает длительность вызовов методов хранилища в observer.
+func (s *BannerDataStore) ObserveQueries(observer QueryObserver) {
+	s.observer = observer
+}
+
+// call - обращение к базе: клиентский спан и замер длительности для QueryObserver.
+type call struct {
+	method   string
+	start    time.Time
+	span     trace.Span
+	observer QueryObserver
+}
+
+// startCall - начинает обращение к базе, method - метод хранилища. Завершается call.end.
+func (s *BannerDataStore) startCall(ctx context.Context, method string) (context.Context, *call) {
+	ctx, span := tracer.Start(
+		ctx,
+		"BannerDataStore."+method,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(semconv.DBSystemPostgreSQL),
+	)
+	return ctx, &call{method: method, start: time.Now(), span: span, observer: s.observer}
+}
+
+func (c *call) end(err error) {
+	c.observer.ObserveQuery(c.method, time.Since(c.start), err)
+	tracing.End(c.span, err)
+}
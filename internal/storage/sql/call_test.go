@@ -0,0 +1,35 @@
+package sql
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type recordingObserver struct {
+	method   string
+	duration time.Duration
+	err      error
+}
+
+func (o *recordingObserver) ObserveQuery(method string, duration time.Duration, err error) {
+	o.method, o.duration, o.err = method, duration, err
+}
+
+func TestCallReportsToObserver(t *testing.T) {
+	observer := &recordingObserver{}
+	store := &BannerDataStore{observer: nopObserver{}}
+	store.ObserveQueries(observer)
+
+	queryErr := errors.New("query failed")
+	_, c := store.startCall(context.Background(), "DeadLetters")
+	time.Sleep(time.Millisecond)
+	c.end(queryErr)
+
+	require.Equal(t, "DeadLetters", observer.method)
+	require.GreaterOrEqual(t, int64(observer.duration), int64(time.Millisecond))
+	require.Equal(t, queryErr, observer.err)
+}
@@ -0,0 +1,98 @@
+package sql
+
+import (
+	"context"
+	"time"
+
+	"github.com/nsmak/bannersRotation/internal/app"
+	"github.com/nsmak/bannersRotation/internal/storage"
+)
+
+type deadLetterRow struct {
+	ID            int64     `db:"id"`
+	EventID       string    `db:"event_id"`
+	SchemaVersion int32     `db:"schema_version"`
+	Type          string    `db:"type"`
+	OccurredAt    time.Time `db:"occurred_at"`
+	BannerID      int64     `db:"banner_id"`
+	SlotID        int64     `db:"slot_id"`
+	SocialID      int64     `db:"social_id"`
+	Reason        string    `db:"reason"`
+	FailedAt      time.Time `db:"failed_at"`
+}
+
+func (s *BannerDataStore) PutDeadLetter(ctx context.Context, letter app.DeadLetter) (err error) {
+	ctx, call := s.startCall(ctx, "PutDeadLetter")
+	defer func() { call.end(err) }()
+
+	_, err = s.db.ExecContext(
+		ctx,
+		`INSERT INTO statistic_dead_letter
+			(event_id, schema_version, type, occurred_at, banner_id, slot_id, social_id, reason, failed_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`,
+		letter.Event.ID, letter.Event.SchemaVersion, string(letter.Event.Type), letter.Event.OccurredAt,
+		letter.Event.BannerID, letter.Event.SlotID, letter.Event.SocialID, letter.Reason, letter.FailedAt,
+	)
+	if err != nil {
+		return storage.NewError("can't save dead letter", err)
+	}
+
+	return nil
+}
+
+func (s *BannerDataStore) DeadLetters(ctx context.Context, limit int) (_ []app.DeadLetter, err error) {
+	ctx, call := s.startCall(ctx, "DeadLetters")
+	defer func() { call.end(err) }()
+
+	// LIMIT NULL в Postgres не ограничивает выборку.
+	var max interface{}
+	if limit > 0 {
+		max = limit
+	}
+
+	var rows []deadLetterRow
+	err = s.db.SelectContext(
+		ctx,
+		&rows,
+		`SELECT id, event_id, schema_version, type, occurred_at, banner_id, slot_id, social_id, reason, failed_at
+			FROM statistic_dead_letter
+			ORDER BY id
+			LIMIT $1`,
+		max,
+	)
+	if err != nil {
+		return nil, storage.NewError("can't get dead letters", err)
+	}
+
+	letters := make([]app.DeadLetter, 0, len(rows))
+	for _, r := range rows {
+		letters = append(letters, app.DeadLetter{
+			ID: r.ID,
+			Event: app.StatisticEvent{
+				ID:            r.EventID,
+				SchemaVersion: r.SchemaVersion,
+				Type:          app.StatType(r.Type),
+				OccurredAt:    r.OccurredAt.UTC(),
+				BannerID:      r.BannerID,
+				SlotID:        r.SlotID,
+				SocialID:      r.SocialID,
+			},
+			Reason:   r.Reason,
+			FailedAt: r.FailedAt,
+		})
+	}
+
+	return letters, nil
+}
+
+func (s *BannerDataStore) DeleteDeadLetters(ctx context.Context, ids []int64) (err error) {
+	ctx, call := s.startCall(ctx, "DeleteDeadLetters")
+	defer func() { call.end(err) }()
+
+	_, err = s.db.ExecContext(ctx, "DELETE FROM statistic_dead_letter WHERE id = ANY($1)", ids)
+	if err != nil {
+		return storage.NewError("can't delete dead letters", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,98 @@
+package sql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgconn"
+	"github.com/nsmak/bannersRotation/internal/storage"
+	"github.com/nsmak/bannersRotation/migrations"
+	"github.com/pressly/goose/v3"
+)
+
+var ErrSchemaVersion = storage.NewError("incompatible database schema version", nil)
+
+// Migrate - выполняет команду goose (up, down, status) над встроенными миграциями.
+func (s *BannerDataStore) Migrate(command string) error {
+	if err := setupGoose(); err != nil {
+		return err
+	}
+
+	if err := goose.Run(command, s.db.DB, "."); err != nil {
+		return storage.NewError("can't run migrate "+command, err)
+	}
+	return nil
+}
+
+// CheckSchema - проверяет, что база мигрирована ровно до последней встроенной миграции.
+// Вызывается и из readiness-проверки, поэтому запрос версии учитывает ctx и ничего не создает в базе.
+func (s *BannerDataStore) CheckSchema(ctx context.Context) error {
+	if err := setupGoose(); err != nil {
+		return err
+	}
+
+	expected, err := latestVersion()
+	if err != nil {
+		return err
+	}
+
+	current, err := s.schemaVersion(ctx)
+	if err != nil {
+		return storage.NewError("can't get database schema version", err)
+	}
+
+	switch {
+	case current < expected:
+		msg := fmt.Sprintf("schema version %d is older than %d, run `migrate up`", current, expected)
+		return storage.NewError(msg, ErrSchemaVersion)
+	case current > expected:
+		msg := fmt.Sprintf("schema version %d is newer than %d known to this build", current, expected)
+		return storage.NewError(msg, ErrSchemaVersion)
+	}
+
+	return nil
+}
+
+// schemaVersion - версия по таблице goose так же, как goose.GetDBVersion: последняя по id версия,
+// у которой последняя запись - применение. goose.GetDBVersion не принимает контекст и создает таблицу.
+func (s *BannerDataStore) schemaVersion(ctx context.Context) (int64, error) {
+	query := fmt.Sprintf(`SELECT version_id FROM %[1]s v
+		WHERE is_applied AND id = (SELECT max(id) FROM %[1]s WHERE version_id = v.version_id)
+		ORDER BY id DESC LIMIT 1`, goose.TableName())
+
+	var version int64
+	err := s.db.GetContext(ctx, &version, query)
+	var pgErr *pgconn.PgError
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return 0, nil
+	case errors.As(err, &pgErr) && pgErr.Code == undefinedTableCode:
+		return 0, nil
+	case err != nil:
+		return 0, err
+	}
+	return version, nil
+}
+
+func latestVersion() (int64, error) {
+	all, err := goose.CollectMigrations(".", 0, goose.MaxVersion)
+	if err != nil {
+		return 0, storage.NewError("can't collect migrations", err)
+	}
+
+	last, err := all.Last()
+	if err != nil {
+		return 0, storage.NewError("can't collect migrations", err)
+	}
+	return last.Version, nil
+}
+
+func setupGoose() error {
+	goose.SetBaseFS(migrations.FS)
+	if err := goose.SetDialect("postgres"); err != nil {
+		return storage.NewError("can't set migrations dialect", err)
+	}
+	return nil
+}
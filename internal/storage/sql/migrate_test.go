@@ -0,0 +1,32 @@
+package sql
+
+import (
+	"io/fs"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/nsmak/bannersRotation/migrations"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLatestVersionIsNewestEmbeddedMigration(t *testing.T) {
+	require.NoError(t, setupGoose())
+
+	files, err := fs.Glob(migrations.FS, "*.sql")
+	require.NoError(t, err)
+	require.NotEmpty(t, files)
+
+	var newest int64
+	for _, name := range files {
+		version, err := strconv.ParseInt(strings.SplitN(name, "_", 2)[0], 10, 64)
+		require.NoError(t, err, name)
+		if version > newest {
+			newest = version
+		}
+	}
+
+	latest, err := latestVersion()
+	require.NoError(t, err)
+	require.Equal(t, newest, latest)
+}
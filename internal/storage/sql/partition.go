@@ -0,0 +1,72 @@
+package sql
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/nsmak/bannersRotation/internal/storage"
+)
+
+const partitionDayLayout = "20060102"
+
+// EnsureEventPartitions - создает дневные партиции таблиц событий на days дней начиная с from (по UTC).
+// События, успевшие попасть в default партицию, переносятся в новую партицию.
+func (s *BannerDataStore) EnsureEventPartitions(ctx context.Context, from time.Time, days int) (err error) {
+	ctx, call := s.startCall(ctx, "EnsureEventPartitions")
+	defer func() { call.end(err) }()
+
+	from = from.UTC().Truncate(24 * time.Hour)
+	for _, table := range eventTables {
+		for i := 0; i < days; i++ {
+			day := from.AddDate(0, 0, i).Format("2006-01-02")
+			_, err = s.db.ExecContext(ctx, "SELECT create_event_partition($1, $2::date)", table, day)
+			if err != nil {
+				return storage.NewError("can't create partition "+table+" "+day, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// DropEventPartitions - удаляет дневные партиции событий, целиком лежащие раньше before, и возвращает их имена.
+func (s *BannerDataStore) DropEventPartitions(ctx context.Context, before time.Time) (_ []string, err error) {
+	ctx, call := s.startCall(ctx, "DropEventPartitions")
+	defer func() { call.end(err) }()
+
+	var dropped []string
+	for _, table := range eventTables {
+		var partitions []string
+		err = s.db.SelectContext(
+			ctx,
+			&partitions,
+			`SELECT c.relname
+				FROM pg_inherits i
+				JOIN pg_class c ON c.oid = i.inhrelid
+				WHERE i.inhparent = $1::regclass`,
+			table,
+		)
+		if err != nil {
+			return dropped, storage.NewError("can't list partitions of "+table, err)
+		}
+
+		for _, name := range partitions {
+			day, err := time.Parse(partitionDayLayout, strings.TrimPrefix(name, table+"_p"))
+			if err != nil || day.AddDate(0, 0, 1).After(before) {
+				continue
+			}
+
+			_, err = s.db.ExecContext(ctx, "DROP TABLE "+pgx.Identifier{name}.Sanitize())
+			if err != nil {
+				return dropped, storage.NewError("can't drop partition "+name, err)
+			}
+			dropped = append(dropped, name)
+		}
+	}
+
+	sort.Strings(dropped)
+	return dropped, nil
+}
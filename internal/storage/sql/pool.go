@@ -0,0 +1,123 @@
+package sql
+
+import (
+	"context"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/nsmak/bannersRotation/cmd/config"
+	"github.com/nsmak/bannersRotation/internal/app"
+)
+
+const defaultSSLMode = "disable"
+
+// PoolStats - состояние пула соединений к одному серверу.
+type PoolStats struct {
+	Address           string
+	OpenConns         int
+	InUse             int
+	Idle              int
+	WaitCount         int64
+	WaitDuration      time.Duration
+	MaxIdleClosed     int64
+	MaxLifetimeClosed int64
+}
+
+func open(cfg config.DBConf, addr string) (*sqlx.DB, error) {
+	db, err := sqlx.Open("pgx", dsn(cfg, addr))
+	if err != nil {
+		return nil, err
+	}
+
+	db.SetMaxOpenConns(cfg.MaxOpenConns)
+	db.SetMaxIdleConns(cfg.MaxIdleConns)
+	db.SetConnMaxLifetime(time.Duration(cfg.ConnMaxLifetimeSec) * time.Second)
+	db.SetConnMaxIdleTime(time.Duration(cfg.ConnMaxIdleTimeSec) * time.Second)
+	return db, nil
+}
+
+func dsn(cfg config.DBConf, addr string) string {
+	query := url.Values{}
+	sslMode := cfg.SSLMode
+	if sslMode == "" {
+		sslMode = defaultSSLMode
+	}
+	query.Set("sslmode", sslMode)
+	if cfg.SSLRootCert != "" {
+		query.Set("sslrootcert", cfg.SSLRootCert)
+	}
+	if cfg.SSLCert != "" {
+		query.Set("sslcert", cfg.SSLCert)
+	}
+	if cfg.SSLKey != "" {
+		query.Set("sslkey", cfg.SSLKey)
+	}
+	if cfg.ApplicationName != "" {
+		query.Set("application_name", cfg.ApplicationName)
+	}
+	// Неизвестные pgx параметры передаются серверу как параметры сессии.
+	if cfg.StatementTimeoutMs > 0 {
+		query.Set("statement_timeout", strconv.FormatInt(cfg.StatementTimeoutMs, 10))
+	}
+
+	u := url.URL{
+		Scheme:   "postgres",
+		User:     url.UserPassword(cfg.Username, cfg.Password),
+		Host:     addr,
+		Path:     "/" + cfg.DBName,
+		RawQuery: query.Encode(),
+	}
+	return u.String()
+}
+
+// PoolStats - состояние пулов primary и реплик.
+func (s *BannerDataStore) PoolStats() []PoolStats {
+	stats := []PoolStats{poolStats("primary", s.db)}
+	for _, r := range s.readers.replicas {
+		stats = append(stats, poolStats(r.addr, r.db))
+	}
+	return stats
+}
+
+// ReportPoolStats - пишет состояние пулов в лог каждые interval, пока не отменен ctx.
+func (s *BannerDataStore) ReportPoolStats(ctx context.Context, logger app.Logger, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			for _, st := range s.PoolStats() {
+				logger.Info(
+					"db pool stats",
+					logger.String("address", st.Address),
+					logger.Int64("open", int64(st.OpenConns)),
+					logger.Int64("in_use", int64(st.InUse)),
+					logger.Int64("idle", int64(st.Idle)),
+					logger.Int64("wait_count", st.WaitCount),
+					logger.Duration("wait_duration", st.WaitDuration),
+					logger.Int64("max_idle_closed", st.MaxIdleClosed),
+					logger.Int64("max_lifetime_closed", st.MaxLifetimeClosed),
+				)
+			}
+		}
+	}
+}
+
+func poolStats(addr string, db *sqlx.DB) PoolStats {
+	st := db.Stats()
+	return PoolStats{
+		Address:           addr,
+		OpenConns:         st.OpenConnections,
+		InUse:             st.InUse,
+		Idle:              st.Idle,
+		WaitCount:         st.WaitCount,
+		WaitDuration:      st.WaitDuration,
+		MaxIdleClosed:     st.MaxIdleClosed,
+		MaxLifetimeClosed: st.MaxLifetimeClosed,
+	}
+}
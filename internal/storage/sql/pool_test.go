@@ -0,0 +1,54 @@
+package sql
+
+import (
+	"testing"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/nsmak/bannersRotation/cmd/config"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDSNDefaults(t *testing.T) {
+	cfg := config.DBConf{Username: "postgres", Password: "password", DBName: "postgres"}
+
+	require.Equal(t, "postgres://postgres:password@db:5432/postgres?sslmode=disable", dsn(cfg, "db:5432"))
+}
+
+func TestDSNOptions(t *testing.T) {
+	cfg := config.DBConf{
+		Username:           "rotator",
+		Password:           "p@ss/word",
+		DBName:             "banners",
+		StatementTimeoutMs: 1500,
+		ApplicationName:    "rotator",
+		SSLMode:            "verify-full",
+	}
+
+	parsed, err := pgx.ParseConfig(dsn(cfg, "replica:5433"))
+
+	require.NoError(t, err)
+	require.Equal(t, "replica", parsed.Host)
+	require.Equal(t, uint16(5433), parsed.Port)
+	require.Equal(t, "rotator", parsed.User)
+	require.Equal(t, "p@ss/word", parsed.Password)
+	require.Equal(t, "banners", parsed.Database)
+	require.Equal(t, "1500", parsed.RuntimeParams["statement_timeout"])
+	require.Equal(t, "rotator", parsed.RuntimeParams["application_name"])
+	require.NotNil(t, parsed.TLSConfig)
+	require.Equal(t, "replica", parsed.TLSConfig.ServerName)
+}
+
+func TestDSNCertificates(t *testing.T) {
+	cfg := config.DBConf{
+		SSLMode:     "verify-ca",
+		SSLRootCert: "/etc/ssl/ca.pem",
+		SSLCert:     "/etc/ssl/client.pem",
+		SSLKey:      "/etc/ssl/client.key",
+	}
+
+	require.Equal(
+		t,
+		"postgres://:@db/?sslcert=%2Fetc%2Fssl%2Fclient.pem&sslkey=%2Fetc%2Fssl%2Fclient.key&sslmode=verify-ca&sslrootcert=%2Fetc%2Fssl%2Fca.pem",
+		dsn(cfg, "db"),
+	)
+}
@@ -0,0 +1,115 @@
+package sql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jackc/pgconn"
+	"github.com/jmoiron/sqlx"
+	"github.com/nsmak/bannersRotation/internal/app"
+)
+
+// Сколько реплика, на которой упал запрос из-за соединения, не получает новых запросов.
+const replicaRetryInterval = 10 * time.Second
+
+type replica struct {
+	db        *sqlx.DB
+	addr      string
+	mu        sync.Mutex
+	downUntil time.Time
+}
+
+func (r *replica) available(now time.Time) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return !now.Before(r.downUntil)
+}
+
+func (r *replica) markDown(now time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.downUntil = now.Add(replicaRetryInterval)
+}
+
+// replicaSet - реплики для чтения, выбираемые по кругу. Недоступная реплика пропускается
+// на replicaRetryInterval, если доступных реплик нет, запрос уходит на primary.
+type replicaSet struct {
+	primary  *sqlx.DB
+	replicas []*replica
+	next     uint32
+}
+
+func newReplicaSet(ctx context.Context, primary *sqlx.DB, replicas []*replica) *replicaSet {
+	for _, r := range replicas {
+		// Реплика, недоступная при старте, не мешает запуску: чтения пойдут на primary.
+		if err := r.db.PingContext(ctx); err != nil {
+			r.markDown(time.Now())
+		}
+	}
+
+	return &replicaSet{primary: primary, replicas: replicas}
+}
+
+// read - выполняет читающий запрос на доступной реплике, при ошибке соединения пробует следующую, затем primary.
+// Ошибки, которые вернул сам Postgres, не приводят к повтору. С app.WithFreshReads запрос сразу идет на primary.
+func (rs *replicaSet) read(ctx context.Context, query func(db *sqlx.DB) error) error {
+	if n := len(rs.replicas); n > 0 && !app.FreshReads(ctx) {
+		start := int(atomic.AddUint32(&rs.next, 1))
+		for i := 0; i < n; i++ {
+			r := rs.replicas[(start+i)%n]
+			if !r.available(time.Now()) {
+				continue
+			}
+
+			err := query(r.db)
+			if err == nil || !isConnectionError(ctx, err) {
+				return err
+			}
+			r.markDown(time.Now())
+		}
+	}
+
+	return query(rs.primary)
+}
+
+func (rs *replicaSet) close() error {
+	var errs []error
+	for _, r := range rs.replicas {
+		if err := r.db.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("can't close replicas: %v", errs)
+	}
+	return nil
+}
+
+// noRetryError - ошибка чтения, которое нельзя повторить на другой реплике, например потому что часть строк
+// уже отдана вызывающему.
+type noRetryError struct {
+	err error
+}
+
+func (e *noRetryError) Error() string {
+	return e.err.Error()
+}
+
+func (e *noRetryError) Unwrap() error {
+	return e.err
+}
+
+func isConnectionError(ctx context.Context, err error) bool {
+	var noRetry *noRetryError
+	if ctx.Err() != nil || errors.Is(err, sql.ErrNoRows) || errors.As(err, &noRetry) {
+		return false
+	}
+
+	var pgErr *pgconn.PgError
+	return !errors.As(err, &pgErr)
+}
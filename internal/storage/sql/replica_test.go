@@ -0,0 +1,99 @@
+package sql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgconn"
+	"github.com/jmoiron/sqlx"
+	"github.com/nsmak/bannersRotation/internal/app"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestReplicaSet(n int) *replicaSet {
+	rs := &replicaSet{primary: sqlx.NewDb(&sql.DB{}, "pgx")}
+	for i := 0; i < n; i++ {
+		rs.replicas = append(rs.replicas, &replica{db: sqlx.NewDb(&sql.DB{}, "pgx")})
+	}
+	return rs
+}
+
+func TestReplicaSetRoundRobin(t *testing.T) {
+	rs := newTestReplicaSet(2)
+	used := map[*sqlx.DB]int{}
+
+	for i := 0; i < 4; i++ {
+		require.NoError(t, rs.read(context.Background(), func(db *sqlx.DB) error {
+			used[db]++
+			return nil
+		}))
+	}
+
+	require.Equal(t, 2, used[rs.replicas[0].db])
+	require.Equal(t, 2, used[rs.replicas[1].db])
+	require.Zero(t, used[rs.primary])
+}
+
+func TestReplicaSetFreshReadsGoToPrimary(t *testing.T) {
+	rs := newTestReplicaSet(2)
+	var used []*sqlx.DB
+
+	require.NoError(t, rs.read(app.WithFreshReads(context.Background()), func(db *sqlx.DB) error {
+		used = append(used, db)
+		return nil
+	}))
+
+	require.Equal(t, []*sqlx.DB{rs.primary}, used)
+}
+
+func TestReplicaSetFallsBackToPrimary(t *testing.T) {
+	rs := newTestReplicaSet(1)
+	var used []*sqlx.DB
+	query := func(db *sqlx.DB) error {
+		used = append(used, db)
+		if db != rs.primary {
+			return errors.New("dial tcp: connection refused")
+		}
+		return nil
+	}
+
+	require.NoError(t, rs.read(context.Background(), query))
+	require.NoError(t, rs.read(context.Background(), query))
+
+	require.Equal(t, []*sqlx.DB{rs.replicas[0].db, rs.primary, rs.primary}, used)
+	require.False(t, rs.replicas[0].available(time.Now()))
+	require.True(t, rs.replicas[0].available(time.Now().Add(replicaRetryInterval)))
+}
+
+func TestReplicaSetDoesNotRetryQueryErrors(t *testing.T) {
+	rs := newTestReplicaSet(2)
+	calls := 0
+	pgErr := &pgconn.PgError{Code: "42P01"}
+
+	err := rs.read(context.Background(), func(db *sqlx.DB) error {
+		calls++
+		return pgErr
+	})
+
+	require.True(t, errors.Is(err, pgErr))
+	require.Equal(t, 1, calls)
+	require.True(t, rs.replicas[0].available(time.Now()))
+	require.True(t, rs.replicas[1].available(time.Now()))
+}
+
+func TestReplicaSetDoesNotRetryPartialReads(t *testing.T) {
+	rs := newTestReplicaSet(2)
+	calls := 0
+	connErr := errors.New("unexpected EOF")
+
+	err := rs.read(context.Background(), func(db *sqlx.DB) error {
+		calls++
+		return &noRetryError{err: connErr}
+	})
+
+	require.True(t, errors.Is(err, connErr))
+	require.Equal(t, 1, calls)
+}
@@ -0,0 +1,151 @@
+package sql
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/nsmak/bannersRotation/internal/app"
+	"github.com/nsmak/bannersRotation/internal/storage"
+)
+
+// Интервалы отчета выровнены по UTC, недели в date_trunc начинаются с понедельника.
+var reportBuckets = map[app.Granularity]string{
+	app.GranularityHour: "hour",
+	app.GranularityDay:  "day",
+	app.GranularityWeek: "week",
+}
+
+// reportSortColumns - колонки результата отчета для сортировки по полям app.ReportSort*.
+var reportSortColumns = map[string]string{
+	app.ReportSortBucket: "bucket",
+	app.ReportSortBanner: "banner_id",
+	app.ReportSortSlot:   "slot_id",
+	app.ReportSortSocial: "social_id",
+	app.ReportSortShows:  "shows",
+	app.ReportSortClicks: "clicks",
+	app.ReportSortCTR:    "ctr",
+}
+
+type reportRow struct {
+	Bucket   sql.NullTime `db:"bucket"`
+	BannerID int64        `db:"banner_id"`
+	SlotID   int64        `db:"slot_id"`
+	SocialID int64        `db:"social_id"`
+	Shows    int64        `db:"shows"`
+	Clicks   int64        `db:"clicks"`
+	CTR      float64      `db:"ctr"`
+	Total    int          `db:"total"`
+}
+
+// ReportRows - строки отчета по агрегатам granularity. Группировка, сортировка и пагинация выполняются в базе,
+// поэтому в память попадает только страница. Поля без группировки нулевые, как в app.ReportRow.
+func (s *BannerDataStore) ReportRows(
+	ctx context.Context,
+	granularity app.Granularity,
+	q app.ReportQuery,
+) (_ []app.ReportRow, _ int, err error) {
+	ctx, call := s.startCall(ctx, "ReportRows")
+	defer func() { call.end(err) }()
+
+	table, ok := rollupTables[granularity]
+	if !ok {
+		return nil, 0, storage.NewError("unknown rollup granularity "+string(granularity), nil)
+	}
+	grouped, args, err := reportQuery(table, q)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	query := "SELECT *, count(*) OVER () total FROM (" + grouped + ") report ORDER BY "
+	if field, desc := q.SortField(); field != "" {
+		column, ok := reportSortColumns[field]
+		if !ok {
+			return nil, 0, storage.NewError("unknown report sort field "+field, nil)
+		}
+		direction := " ASC"
+		if desc {
+			direction = " DESC"
+		}
+		query += column + direction + ", "
+	}
+	query += "bucket, banner_id, slot_id, social_id"
+	pageArgs := args
+	if q.Limit > 0 {
+		pageArgs = append(pageArgs[:len(args):len(args)], q.Limit, q.Offset)
+		query += fmt.Sprintf(" LIMIT $%d OFFSET $%d", len(args)+1, len(args)+2)
+	}
+
+	var (
+		rows  []reportRow
+		total int
+	)
+	err = s.readers.read(ctx, func(db *sqlx.DB) error {
+		rows, total = nil, 0
+		if err := db.SelectContext(ctx, &rows, query, pageArgs...); err != nil {
+			return err
+		}
+		if len(rows) > 0 || q.Offset == 0 {
+			return nil
+		}
+		// Страница за последней строкой пуста, но total все равно нужен.
+		return db.GetContext(ctx, &total, "SELECT count(*) FROM ("+grouped+") report", args...)
+	})
+	if err != nil {
+		return nil, 0, storage.NewError("can't get report rows", err)
+	}
+
+	res := make([]app.ReportRow, 0, len(rows))
+	for _, r := range rows {
+		row := app.ReportRow{BannerID: r.BannerID, SlotID: r.SlotID, SocialID: r.SocialID, Shows: r.Shows, Clicks: r.Clicks}
+		if r.Bucket.Valid {
+			row.Bucket = r.Bucket.Time.UTC()
+		}
+		res = append(res, row)
+		total = r.Total
+	}
+	return res, total, nil
+}
+
+// reportQuery - запрос строк отчета из table без сортировки и пагинации.
+func reportQuery(table string, q app.ReportQuery) (string, []interface{}, error) {
+	columns := []string{"NULL::timestamptz bucket", "0 banner_id", "0 slot_id", "0 social_id"}
+	if q.GroupedBy(app.ReportByBucket) {
+		unit, ok := reportBuckets[q.Bucket]
+		if !ok {
+			return "", nil, storage.NewError("unknown report bucket "+string(q.Bucket), nil)
+		}
+		columns[0] = "date_trunc('" + unit + "', bucket AT TIME ZONE 'UTC') AT TIME ZONE 'UTC' bucket"
+	}
+	if q.GroupedBy(app.ReportByBanner) {
+		columns[1] = "banner_id"
+	}
+	if q.GroupedBy(app.ReportBySlot) {
+		columns[2] = "slot_id"
+	}
+	if q.GroupedBy(app.ReportBySocial) {
+		columns[3] = "social_id"
+	}
+
+	args := []interface{}{q.From, q.To}
+	where := []string{"bucket >= $1", "bucket < $2"}
+	filters := []struct {
+		column string
+		id     int64
+	}{{"banner_id", q.BannerID}, {"slot_id", q.SlotID}, {"social_id", q.SocialID}}
+	for _, f := range filters {
+		if f.id != 0 {
+			args = append(args, f.id)
+			where = append(where, fmt.Sprintf("%s = $%d", f.column, len(args)))
+		}
+	}
+
+	return `SELECT ` + strings.Join(columns, ", ") + `,
+			sum(shows)::bigint shows, sum(clicks)::bigint clicks,
+			coalesce(sum(clicks)::float8 / nullif(sum(shows), 0)::float8, 0) ctr
+		FROM ` + table + `
+		WHERE ` + strings.Join(where, " AND ") + `
+		GROUP BY 1, 2, 3, 4`, args, nil
+}
@@ -0,0 +1,202 @@
+package sql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/nsmak/bannersRotation/internal/app"
+	"github.com/nsmak/bannersRotation/internal/storage"
+)
+
+var rollupTables = map[app.Granularity]string{
+	app.GranularityHour: "banner_rollup_hourly",
+	app.GranularityDay:  "banner_rollup_daily",
+}
+
+// Почасовые агрегаты считаются по сырым событиям, дневные - по почасовым. Интервалы выровнены по UTC.
+var rollupQueries = map[app.Granularity]string{
+	app.GranularityHour: `INSERT INTO banner_rollup_hourly (bucket, banner_id, slot_id, social_id, shows, clicks)
+		SELECT bucket, banner_id, slot_id, social_id, sum(shows), sum(clicks)
+		FROM (
+			SELECT date_trunc('hour', date AT TIME ZONE 'UTC') AT TIME ZONE 'UTC' bucket,
+				banner_id, slot_id, social_id, count(*) shows, 0 clicks
+			FROM banner_showing
+			WHERE date >= $1 AND date < $2
+			GROUP BY 1, 2, 3, 4
+			UNION ALL
+			SELECT date_trunc('hour', date AT TIME ZONE 'UTC') AT TIME ZONE 'UTC' bucket,
+				banner_id, slot_id, social_id, 0 shows, count(*) clicks
+			FROM banner_click
+			WHERE date >= $1 AND date < $2
+			GROUP BY 1, 2, 3, 4
+		) events
+		GROUP BY 1, 2, 3, 4`,
+	app.GranularityDay: `INSERT INTO banner_rollup_daily (bucket, banner_id, slot_id, social_id, shows, clicks)
+		SELECT date_trunc('day', bucket AT TIME ZONE 'UTC') AT TIME ZONE 'UTC',
+			banner_id, slot_id, social_id, sum(shows), sum(clicks)
+		FROM banner_rollup_hourly
+		WHERE bucket >= $1 AND bucket < $2
+		GROUP BY 1, 2, 3, 4`,
+}
+
+// RollupEvents - пересчитывает агрегаты интервалов из [from, to) одной транзакцией: старые строки удаляются
+// и считаются заново, поэтому повторный запуск за тот же период дает тот же результат.
+func (s *BannerDataStore) RollupEvents(ctx context.Context, granularity app.Granularity, from, to time.Time) (err error) {
+	ctx, call := s.startCall(ctx, "RollupEvents")
+	defer func() { call.end(err) }()
+
+	table, ok := rollupTables[granularity]
+	if !ok {
+		return storage.NewError("unknown rollup granularity "+string(granularity), nil)
+	}
+
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return storage.NewError("can't start transactions", err)
+	}
+	defer tx.Rollback() // nolint: errcheck
+
+	_, err = tx.ExecContext(ctx, "DELETE FROM "+table+" WHERE bucket >= $1 AND bucket < $2", from, to)
+	if err != nil {
+		return storage.NewError("can't delete old rollups", err)
+	}
+
+	_, err = tx.ExecContext(ctx, rollupQueries[granularity], from, to)
+	if err != nil {
+		return storage.NewError("can't roll up events", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return storage.NewError("can't commit transactions", err)
+	}
+
+	return nil
+}
+
+func (s *BannerDataStore) RollupWatermark(ctx context.Context, granularity app.Granularity) (_ time.Time, _ bool, err error) {
+	ctx, call := s.startCall(ctx, "RollupWatermark")
+	defer func() { call.end(err) }()
+
+	var watermark time.Time
+	err = s.db.GetContext(
+		ctx,
+		&watermark,
+		"SELECT rolled_up_to FROM rollup_watermark WHERE granularity = $1",
+		string(granularity),
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return time.Time{}, false, nil
+	}
+	if err != nil {
+		return time.Time{}, false, storage.NewError("can't get rollup watermark", err)
+	}
+
+	return watermark.UTC(), true, nil
+}
+
+func (s *BannerDataStore) SetRollupWatermark(ctx context.Context, granularity app.Granularity, to time.Time) (err error) {
+	ctx, call := s.startCall(ctx, "SetRollupWatermark")
+	defer func() { call.end(err) }()
+
+	_, err = s.db.ExecContext(
+		ctx,
+		`INSERT INTO rollup_watermark (granularity, rolled_up_to) VALUES ($1, $2)
+			ON CONFLICT (granularity) DO UPDATE SET rolled_up_to = EXCLUDED.rolled_up_to`,
+		string(granularity), to,
+	)
+	if err != nil {
+		return storage.NewError("can't save rollup watermark", err)
+	}
+
+	return nil
+}
+
+// FirstEventTime - время самого раннего сохраненного показа или клика.
+func (s *BannerDataStore) FirstEventTime(ctx context.Context) (_ time.Time, _ bool, err error) {
+	ctx, call := s.startCall(ctx, "FirstEventTime")
+	defer func() { call.end(err) }()
+
+	var first sql.NullTime
+	err = s.db.GetContext(
+		ctx,
+		&first,
+		"SELECT least((SELECT min(date) FROM banner_showing), (SELECT min(date) FROM banner_click))",
+	)
+	if err != nil {
+		return time.Time{}, false, storage.NewError("can't get first event time", err)
+	}
+
+	return first.Time.UTC(), first.Valid, nil
+}
+
+// EachBannerRollup - передает в fn агрегаты интервалов, начинающихся в [from, to), по одному, не загружая их в память.
+// Строки упорядочены по интервалу, баннеру, слоту и группе. Ошибка fn прерывает чтение и возвращается.
+func (s *BannerDataStore) EachBannerRollup(
+	ctx context.Context,
+	granularity app.Granularity,
+	from, to time.Time,
+	fn func(app.BannerRollup) error,
+) (err error) {
+	ctx, call := s.startCall(ctx, "EachBannerRollup")
+	defer func() { call.end(err) }()
+
+	table, ok := rollupTables[granularity]
+	if !ok {
+		return storage.NewError("unknown rollup granularity "+string(granularity), nil)
+	}
+
+	err = s.readers.read(ctx, func(db *sqlx.DB) error {
+		// Строки отдаются со скоростью клиента выгрузки, поэтому statement_timeout сессии здесь не действует:
+		// запрос ограничен только контекстом.
+		tx, err := db.BeginTxx(ctx, &sql.TxOptions{ReadOnly: true})
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback() // nolint: errcheck
+
+		if _, err := tx.ExecContext(ctx, "SET LOCAL statement_timeout = 0"); err != nil {
+			return err
+		}
+
+		rows, err := tx.QueryxContext(
+			ctx,
+			`SELECT bucket, banner_id, slot_id, social_id, shows, clicks
+				FROM `+table+`
+				WHERE bucket >= $1 AND bucket < $2
+				ORDER BY bucket, banner_id, slot_id, social_id`,
+			from, to,
+		)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		sent := false
+		for rows.Next() {
+			var rollup app.BannerRollup
+			if err := rows.StructScan(&rollup); err != nil {
+				return &noRetryError{err: err}
+			}
+			rollup.Bucket = rollup.Bucket.UTC()
+			sent = true
+			if err := fn(rollup); err != nil {
+				return &noRetryError{err: err}
+			}
+		}
+		if err := rows.Err(); err != nil {
+			if sent {
+				return &noRetryError{err: err}
+			}
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		return storage.NewError("can't read rollups", err)
+	}
+
+	return nil
+}
@@ -2,45 +2,90 @@ package sql
 
 import (
 	"context"
-	"database/sql"
 	"errors"
-	"fmt"
+	"time"
 
 	"github.com/jackc/pgconn"
 	_ "github.com/jackc/pgx/v4/stdlib" // nolint: gci
 	"github.com/jmoiron/sqlx"
+	"github.com/nsmak/bannersRotation/cmd/config"
 	"github.com/nsmak/bannersRotation/internal/app"
 	"github.com/nsmak/bannersRotation/internal/storage"
+	"github.com/nsmak/bannersRotation/internal/tracing"
 )
 
 const (
 	violatesForeignKeyConstraintCode = "23503"
+	violatesUniqueConstraintCode     = "23505"
+	undefinedTableCode               = "42P01"
+)
+
+var (
+	eventTables = map[app.StatType]string{
+		app.StatTypeShow:  "banner_showing",
+		app.StatTypeClick: "banner_click",
+	}
+	counterColumns = map[app.StatType]string{
+		app.StatTypeShow:  "shows",
+		app.StatTypeClick: "clicks",
+	}
 )
 
 type BannerDataStore struct {
-	db *sqlx.DB
+	db       *sqlx.DB
+	readers  *replicaSet
+	observer QueryObserver
 }
 
-func New(ctx context.Context, user, pass, addr, dbName string) (*BannerDataStore, error) {
-	dsn := fmt.Sprintf("postgres://%s:%s@%s/%s?sslmode=disable", user, pass, addr, dbName)
-	db, err := sqlx.Open("pgx", dsn)
+// New - открывает пул соединений к primary и пулы с теми же настройками к репликам из cfg.Replicas.
+func New(ctx context.Context, cfg config.DBConf) (*BannerDataStore, error) {
+	db, err := open(cfg, cfg.Address)
 	if err != nil {
 		return nil, storage.NewError("can't open db store", err)
 	}
 
 	err = db.PingContext(ctx)
 	if err != nil {
+		_ = db.Close()
 		return nil, storage.NewError("ping error", err)
 	}
 
-	return &BannerDataStore{db: db}, nil
+	replicas := make([]*replica, 0, len(cfg.Replicas))
+	for _, addr := range cfg.Replicas {
+		replicaDB, err := open(cfg, addr)
+		if err != nil {
+			_ = db.Close()
+			for _, r := range replicas {
+				_ = r.db.Close()
+			}
+			return nil, storage.NewError("can't open replica", err)
+		}
+		replicas = append(replicas, &replica{db: replicaDB, addr: addr})
+	}
+
+	return &BannerDataStore{db: db, readers: newReplicaSet(ctx, db, replicas), observer: nopObserver{}}, nil
 }
 
 func (s *BannerDataStore) Close() error {
+	if err := s.readers.close(); err != nil {
+		_ = s.db.Close()
+		return err
+	}
 	return s.db.Close()
 }
 
-func (s *BannerDataStore) AddBannerToSlot(ctx context.Context, bannerID, slotID int64) error {
+// Ping - проверяет соединение с primary. Недоступные реплики не мешают: чтения уходят на primary.
+func (s *BannerDataStore) Ping(ctx context.Context) error {
+	if err := s.db.PingContext(ctx); err != nil {
+		return storage.NewError("ping error", err)
+	}
+	return nil
+}
+
+func (s *BannerDataStore) AddBannerToSlot(ctx context.Context, bannerID, slotID int64) (err error) {
+	ctx, call := s.startCall(ctx, "AddBannerToSlot")
+	defer func() { call.end(err) }()
+
 	tx, err := s.db.BeginTxx(ctx, nil)
 	if err != nil {
 		return storage.NewError("can't start transactions", err)
@@ -51,8 +96,11 @@ func (s *BannerDataStore) AddBannerToSlot(ctx context.Context, bannerID, slotID
 	if err != nil {
 		var pgErr *pgconn.PgError
 		if errors.As(err, &pgErr) {
-			if pgErr.Code == violatesForeignKeyConstraintCode {
-				return storage.NewError(pgErr.Error(), storage.ErrObjectNotFound)
+			switch pgErr.Code {
+			case violatesForeignKeyConstraintCode:
+				return storage.NewError("can't add banner into slot", storage.ErrObjectNotFound)
+			case violatesUniqueConstraintCode:
+				return storage.NewError("can't add banner into slot", storage.ErrAlreadyExists)
 			}
 		}
 
@@ -73,6 +121,11 @@ func (s *BannerDataStore) AddBannerToSlot(ctx context.Context, bannerID, slotID
 		if err != nil {
 			return storage.NewError("can't add view for banner", err)
 		}
+
+		err = incrementCounter(ctx, tx, app.StatTypeShow, bannerID, slotID, grp.ID)
+		if err != nil {
+			return storage.NewError("can't increment banner counters", err)
+		}
 	}
 	err = tx.Commit()
 	if err != nil {
@@ -82,8 +135,11 @@ func (s *BannerDataStore) AddBannerToSlot(ctx context.Context, bannerID, slotID
 	return nil
 }
 
-func (s *BannerDataStore) RemoveBannerFromSlot(ctx context.Context, bannerID, slotID int64) error {
-	_, err := s.db.ExecContext(ctx, "DELETE FROM banner_slot WHERE banner_id=$1 AND slot_id=$2", bannerID, slotID)
+func (s *BannerDataStore) RemoveBannerFromSlot(ctx context.Context, bannerID, slotID int64) (err error) {
+	ctx, call := s.startCall(ctx, "RemoveBannerFromSlot")
+	defer func() { call.end(err) }()
+
+	_, err = s.db.ExecContext(ctx, "DELETE FROM banner_slot WHERE banner_id=$1 AND slot_id=$2", bannerID, slotID)
 	if err != nil {
 		return storage.NewError("can't remove banner from slot", err)
 	}
@@ -91,39 +147,25 @@ func (s *BannerDataStore) RemoveBannerFromSlot(ctx context.Context, bannerID, sl
 	return nil
 }
 
-func (s *BannerDataStore) BannersStatistics(ctx context.Context, slotID, socialID int64) ([]app.BannerSummary, error) {
-	rows, err := s.db.QueryxContext(
-		ctx,
-		`SELECT sh.banner_id, sh.slot_id, sh.social_id, count(sh.*) show_count, cl.count click_count
-			FROM banner_showing sh
-			LEFT JOIN (SELECT banner_id, slot_id, social_id, count(date) FROM banner_click GROUP BY 1,2,3) cl
-			ON (sh.slot_id=cl.slot_id AND sh.banner_id=cl.banner_id AND sh.social_id=cl.social_id)
-			WHERE sh.slot_id=$1 AND sh.social_id=$2
-			GROUP BY 1,2,3,5
-		`,
-		slotID, socialID,
-	)
-	if err != nil {
-		return nil, storage.NewError("can't get statistics", err)
-	}
-	defer rows.Close()
+func (s *BannerDataStore) BannersStatistics(ctx context.Context, slotID, socialID int64) (_ []app.BannerSummary, err error) {
+	ctx, call := s.startCall(ctx, "BannersStatistics")
+	defer func() { call.end(err) }()
 
 	var stats []app.BannerSummary
-	for rows.Next() {
-		var summary app.BannerSummary
-		var clickCount sql.NullInt64
-
-		err := rows.Scan(&summary.BannerID, &summary.SlotID, &summary.SocialID, &summary.ShowCount, &clickCount)
-		if err != nil {
-			return nil, storage.NewError("scan error", err)
-		}
-		summary.ClickCount = clickCount.Int64
-		stats = append(stats, summary)
-	}
-
-	err = rows.Err()
+	err = s.readers.read(ctx, func(db *sqlx.DB) error {
+		stats = nil
+		return db.SelectContext(
+			ctx,
+			&stats,
+			`SELECT banner_id, slot_id, social_id, shows show_count, clicks click_count
+				FROM banner_counters
+				WHERE slot_id=$1 AND social_id=$2 AND shows > 0
+				ORDER BY banner_id`,
+			slotID, socialID,
+		)
+	})
 	if err != nil {
-		return nil, storage.NewError("rows error", err)
+		return nil, storage.NewError("can't get statistics", err)
 	}
 
 	if len(stats) == 0 {
@@ -133,49 +175,110 @@ func (s *BannerDataStore) BannersStatistics(ctx context.Context, slotID, socialI
 	return stats, nil
 }
 
-func (s *BannerDataStore) AddViewForBanner(ctx context.Context, bannerID, slotID, socialID int64) error {
-	_, err := s.db.ExecContext(
-		ctx,
-		"INSERT INTO banner_showing (banner_id, slot_id, social_id, date) VALUES ($1, $2, $3, current_timestamp)",
-		bannerID, slotID, socialID,
-	)
+func (s *BannerDataStore) AddViewForBanner(ctx context.Context, bannerID, slotID, socialID int64) (err error) {
+	ctx, call := s.startCall(ctx, "AddViewForBanner")
+	defer func() { call.end(err) }()
+
+	err = s.addEvent(ctx, app.StatTypeShow, bannerID, slotID, socialID)
 	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) {
+			if pgErr.Code == violatesForeignKeyConstraintCode {
+				return storage.NewError("can't add view for banner", storage.ErrObjectNotFound)
+			}
+		}
+
 		return storage.NewError("can't add view for banner", err)
 	}
 
 	return nil
 }
 
-func (s *BannerDataStore) AddClickForBanner(ctx context.Context, bannerID, slotID, socialID int64) error {
-	_, err := s.db.ExecContext(
-		ctx,
-		"INSERT INTO banner_click (banner_id, slot_id, social_id, date) VALUES ($1, $2, $3, current_timestamp)",
-		bannerID, slotID, socialID,
-	)
+func (s *BannerDataStore) AddClickForBanner(ctx context.Context, bannerID, slotID, socialID int64) (err error) {
+	ctx, call := s.startCall(ctx, "AddClickForBanner")
+	defer func() { call.end(err) }()
+
+	err = s.addEvent(ctx, app.StatTypeClick, bannerID, slotID, socialID)
 	if err != nil {
 		var pgErr *pgconn.PgError
 		if errors.As(err, &pgErr) {
 			if pgErr.Code == violatesForeignKeyConstraintCode {
-				return storage.NewError(pgErr.Error(), storage.ErrObjectNotFound)
+				return storage.NewError("can't add click for banner", storage.ErrObjectNotFound)
 			}
 		}
 
-		return storage.NewError("can't add view for banner", err)
+		return storage.NewError("can't add click for banner", err)
 	}
 
 	return nil
 }
 
-func (s *BannerDataStore) BannersShowStatisticsFilterByDate(ctx context.Context, from int64, to int64) ([]app.BannerStatistic, error) {
-	var shows []app.BannerStatistic
-	err := s.db.SelectContext(
+// addEvent пишет событие, его копию в outbox и увеличивает счетчик баннера одной транзакцией,
+// current_timestamp внутри транзакции одинаковый для события и outbox.
+func (s *BannerDataStore) addEvent(ctx context.Context, statType app.StatType, bannerID, slotID, socialID int64) error {
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback() // nolint: errcheck
+
+	var eventID int64
+	err = tx.QueryRowxContext(
+		ctx,
+		"INSERT INTO "+eventTables[statType]+` (banner_id, slot_id, social_id, date)
+			VALUES ($1, $2, $3, current_timestamp) RETURNING id`,
+		bannerID, slotID, socialID,
+	).Scan(&eventID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(
+		ctx,
+		`INSERT INTO statistic_outbox (type, event_id, banner_id, slot_id, social_id, date, trace_parent)
+			VALUES ($1, $2, $3, $4, $5, current_timestamp, $6)`,
+		string(statType), eventID, bannerID, slotID, socialID, tracing.TraceParent(ctx),
+	)
+	if err != nil {
+		return err
+	}
+
+	err = incrementCounter(ctx, tx, statType, bannerID, slotID, socialID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func incrementCounter(ctx context.Context, tx *sqlx.Tx, statType app.StatType, bannerID, slotID, socialID int64) error {
+	column := counterColumns[statType]
+	_, err := tx.ExecContext(
 		ctx,
-		&shows,
-		`SELECT banner_id, slot_id, social_id, extract(epoch from date) date 
-			FROM banner_showing 
-			WHERE extract(epoch from date) >=$1 AND extract(epoch from date) <=$2`,
-		from, to,
+		`INSERT INTO banner_counters (banner_id, slot_id, social_id, `+column+`) VALUES ($1, $2, $3, 1)
+			ON CONFLICT (slot_id, social_id, banner_id) DO UPDATE SET `+column+` = banner_counters.`+column+` + 1`,
+		bannerID, slotID, socialID,
 	)
+	return err
+}
+
+func (s *BannerDataStore) BannersShowStatisticsFilterByDate(ctx context.Context, from int64, to int64) (_ []app.BannerStatistic, err error) {
+	ctx, call := s.startCall(ctx, "BannersShowStatisticsFilterByDate")
+	defer func() { call.end(err) }()
+
+	var shows []app.BannerStatistic
+	err = s.readers.read(ctx, func(db *sqlx.DB) error {
+		shows = nil
+		return db.SelectContext(
+			ctx,
+			&shows,
+			`SELECT id event_id, banner_id, slot_id, social_id, extract(epoch from date) date
+				FROM banner_showing
+				WHERE date >= to_timestamp($1) AND date < to_timestamp($2)
+				ORDER BY date`,
+			from, to,
+		)
+	})
 	if err != nil {
 		return nil, storage.NewError("can't get shows info", err)
 	}
@@ -183,16 +286,23 @@ func (s *BannerDataStore) BannersShowStatisticsFilterByDate(ctx context.Context,
 	return shows, nil
 }
 
-func (s *BannerDataStore) BannersClickStatisticsFilterByDate(ctx context.Context, from int64, to int64) ([]app.BannerStatistic, error) {
+func (s *BannerDataStore) BannersClickStatisticsFilterByDate(ctx context.Context, from int64, to int64) (_ []app.BannerStatistic, err error) {
+	ctx, call := s.startCall(ctx, "BannersClickStatisticsFilterByDate")
+	defer func() { call.end(err) }()
+
 	var shows []app.BannerStatistic
-	err := s.db.SelectContext(
-		ctx,
-		&shows,
-		`SELECT banner_id, slot_id, social_id, extract(epoch from date) date  
-			FROM banner_click 
-			WHERE extract(epoch from date) >=$1 AND extract(epoch from date) <=$2`,
-		from, to,
-	)
+	err = s.readers.read(ctx, func(db *sqlx.DB) error {
+		shows = nil
+		return db.SelectContext(
+			ctx,
+			&shows,
+			`SELECT id event_id, banner_id, slot_id, social_id, extract(epoch from date) date
+				FROM banner_click
+				WHERE date >= to_timestamp($1) AND date < to_timestamp($2)
+				ORDER BY date`,
+			from, to,
+		)
+	})
 	if err != nil {
 		return nil, storage.NewError("can't get shows info", err)
 	}
@@ -200,6 +310,57 @@ func (s *BannerDataStore) BannersClickStatisticsFilterByDate(ctx context.Context
 	return shows, nil
 }
 
+func (s *BannerDataStore) OutboxEvents(ctx context.Context, limit int) (_ []app.OutboxEvent, err error) {
+	ctx, call := s.startCall(ctx, "OutboxEvents")
+	defer func() { call.end(err) }()
+
+	var events []app.OutboxEvent
+	err = s.db.SelectContext(
+		ctx,
+		&events,
+		`SELECT id, type, trace_parent, event_id, banner_id, slot_id, social_id, extract(epoch from date) date
+			FROM statistic_outbox
+			WHERE sent_at IS NULL
+			ORDER BY id
+			LIMIT $1`,
+		limit,
+	)
+	if err != nil {
+		return nil, storage.NewError("can't get outbox events", err)
+	}
+
+	return events, nil
+}
+
+func (s *BannerDataStore) MarkOutboxSent(ctx context.Context, ids []int64) (err error) {
+	ctx, call := s.startCall(ctx, "MarkOutboxSent")
+	defer func() { call.end(err) }()
+
+	_, err = s.db.ExecContext(ctx, "UPDATE statistic_outbox SET sent_at=current_timestamp WHERE id = ANY($1)", ids)
+	if err != nil {
+		return storage.NewError("can't mark outbox events", err)
+	}
+
+	return nil
+}
+
+// DeleteSentOutbox - удаляет события outbox, отправленные раньше before, и возвращает их количество.
+func (s *BannerDataStore) DeleteSentOutbox(ctx context.Context, before time.Time) (_ int64, err error) {
+	ctx, call := s.startCall(ctx, "DeleteSentOutbox")
+	defer func() { call.end(err) }()
+
+	res, err := s.db.ExecContext(ctx, "DELETE FROM statistic_outbox WHERE sent_at < $1", before)
+	if err != nil {
+		return 0, storage.NewError("can't delete sent outbox events", err)
+	}
+
+	deleted, err := res.RowsAffected()
+	if err != nil {
+		return 0, storage.NewError("can't delete sent outbox events", err)
+	}
+	return deleted, nil
+}
+
 func (s *BannerDataStore) socialGroups(ctx context.Context) ([]app.SocialGroup, error) {
 	var groups []app.SocialGroup
 	err := s.db.SelectContext(ctx, &groups, "SELECT id, description FROM social_dem")
@@ -3,7 +3,8 @@ package storage
 import "github.com/nsmak/bannersRotation/internal/app"
 
 var (
-	ErrObjectNotFound = NewError("object not found", nil)
+	ErrObjectNotFound = newKindError("object not found", app.CodeNotFound)
+	ErrAlreadyExists  = newKindError("object already exists", app.CodeConflict)
 )
 
 type Error struct {
@@ -13,3 +14,27 @@ type Error struct {
 func NewError(msg string, err error) *Error {
 	return &Error{BaseError: app.BaseError{Message: msg, Err: err}}
 }
+
+func newKindError(msg string, code app.ErrorCode) *Error {
+	return &Error{BaseError: app.BaseError{Message: msg, Code: code}}
+}
+
+// Баннеры, слоты и социальные группы, которые создает миграция init.
+// Хранилища без миграций заполняются ими при старте.
+var (
+	DefaultBanners = []app.Banner{
+		{ID: 1, Description: "Car banner"},
+		{ID: 2, Description: "Shop banner"},
+		{ID: 3, Description: "Food banner"},
+	}
+	DefaultSlots = []app.Slot{
+		{ID: 1, Description: "Header slot"},
+		{ID: 2, Description: "Footer slot"},
+		{ID: 3, Description: "Left menu banner"},
+	}
+	DefaultGroups = []app.SocialGroup{
+		{ID: 1, Description: "Молодежь"},
+		{ID: 2, Description: "Старики"},
+		{ID: 3, Description: "Сотрудники спецслужб"},
+	}
+)
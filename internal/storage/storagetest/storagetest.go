@@ -0,0 +1,306 @@
+// Package storagetest - общий набор проверок для любой реализации app.Storage.
+// Проверки app.StatisticStore и app.EventBatchWriter пропускаются, если хранилище их не реализует.
+package storagetest
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/nsmak/bannersRotation/internal/app"
+	"github.com/nsmak/bannersRotation/internal/storage"
+	"github.com/stretchr/testify/suite"
+)
+
+// Fixture - объекты, которые фабрика создала в хранилище для одного теста.
+// Баннеров, слотов и групп должно быть не меньше двух, ни один баннер не должен стоять в слоте.
+// Unknown - ID, которого нет ни среди баннеров, ни среди слотов, ни среди групп.
+type Fixture struct {
+	Banners []int64
+	Slots   []int64
+	Groups  []int64
+	Unknown int64
+}
+
+// Factory - создает хранилище и фикстуру для одного теста. Очистку фабрика регистрирует через t.Cleanup.
+type Factory func(t *testing.T) (app.Storage, Fixture)
+
+// Run - прогоняет набор проверок для хранилища.
+func Run(t *testing.T, factory Factory) {
+	suite.Run(t, &Suite{factory: factory})
+}
+
+type Suite struct {
+	suite.Suite
+	factory Factory
+	ctx     context.Context
+	store   app.Storage
+	fx      Fixture
+}
+
+func (s *Suite) SetupTest() {
+	s.ctx = context.Background()
+	s.store, s.fx = s.factory(s.T())
+	s.Require().GreaterOrEqual(len(s.fx.Banners), 2)
+	s.Require().GreaterOrEqual(len(s.fx.Slots), 2)
+	s.Require().GreaterOrEqual(len(s.fx.Groups), 2)
+}
+
+func (s *Suite) TestAddBannerToSlotSeedsShowForEveryGroup() {
+	banner, slot := s.fx.Banners[0], s.fx.Slots[0]
+
+	s.Require().NoError(s.store.AddBannerToSlot(s.ctx, banner, slot))
+
+	for _, group := range s.fx.Groups {
+		stats, err := s.store.BannersStatistics(s.ctx, slot, group)
+		s.Require().NoError(err)
+		s.Require().Equal([]app.BannerSummary{
+			{BannerID: banner, SlotID: slot, SocialID: group, ShowCount: 1, ClickCount: 0},
+		}, stats)
+	}
+}
+
+func (s *Suite) TestAddBannerToSlotUnknownObjects() {
+	err := s.store.AddBannerToSlot(s.ctx, s.fx.Unknown, s.fx.Slots[0])
+	s.Require().True(errors.Is(err, storage.ErrObjectNotFound), "unknown banner: %v", err)
+
+	err = s.store.AddBannerToSlot(s.ctx, s.fx.Banners[0], s.fx.Unknown)
+	s.Require().True(errors.Is(err, storage.ErrObjectNotFound), "unknown slot: %v", err)
+}
+
+func (s *Suite) TestAddBannerToSlotTwice() {
+	s.Require().NoError(s.store.AddBannerToSlot(s.ctx, s.fx.Banners[0], s.fx.Slots[0]))
+
+	err := s.store.AddBannerToSlot(s.ctx, s.fx.Banners[0], s.fx.Slots[0])
+
+	s.Require().Error(err)
+	s.Require().False(errors.Is(err, storage.ErrObjectNotFound))
+}
+
+func (s *Suite) TestRemoveBannerFromSlot() {
+	s.Require().NoError(s.store.AddBannerToSlot(s.ctx, s.fx.Banners[0], s.fx.Slots[0]))
+
+	s.Require().NoError(s.store.RemoveBannerFromSlot(s.ctx, s.fx.Banners[0], s.fx.Slots[0]))
+	s.Require().NoError(s.store.RemoveBannerFromSlot(s.ctx, s.fx.Banners[0], s.fx.Slots[0]))
+	s.Require().NoError(s.store.AddBannerToSlot(s.ctx, s.fx.Banners[0], s.fx.Slots[0]))
+}
+
+func (s *Suite) TestStatisticsForEmptySlot() {
+	_, err := s.store.BannersStatistics(s.ctx, s.fx.Slots[0], s.fx.Groups[0])
+
+	s.Require().True(errors.Is(err, storage.ErrObjectNotFound), "%v", err)
+}
+
+func (s *Suite) TestStatisticsAggregation() {
+	b1, b2 := s.fx.Banners[0], s.fx.Banners[1]
+	slot, otherSlot := s.fx.Slots[0], s.fx.Slots[1]
+	group, otherGroup := s.fx.Groups[0], s.fx.Groups[1]
+
+	s.Require().NoError(s.store.AddBannerToSlot(s.ctx, b1, slot))
+	s.Require().NoError(s.store.AddBannerToSlot(s.ctx, b2, slot))
+	s.Require().NoError(s.store.AddBannerToSlot(s.ctx, b1, otherSlot))
+
+	for i := 0; i < 3; i++ {
+		s.Require().NoError(s.store.AddViewForBanner(s.ctx, b1, slot, group))
+	}
+	s.Require().NoError(s.store.AddViewForBanner(s.ctx, b2, slot, group))
+	s.Require().NoError(s.store.AddClickForBanner(s.ctx, b1, slot, group))
+	s.Require().NoError(s.store.AddClickForBanner(s.ctx, b1, slot, group))
+	s.Require().NoError(s.store.AddViewForBanner(s.ctx, b1, slot, otherGroup))
+	s.Require().NoError(s.store.AddClickForBanner(s.ctx, b1, otherSlot, group))
+
+	stats, err := s.store.BannersStatistics(s.ctx, slot, group)
+	s.Require().NoError(err)
+	s.Require().ElementsMatch([]app.BannerSummary{
+		{BannerID: b1, SlotID: slot, SocialID: group, ShowCount: 4, ClickCount: 2},
+		{BannerID: b2, SlotID: slot, SocialID: group, ShowCount: 2, ClickCount: 0},
+	}, stats)
+
+	stats, err = s.store.BannersStatistics(s.ctx, otherSlot, group)
+	s.Require().NoError(err)
+	s.Require().Equal([]app.BannerSummary{
+		{BannerID: b1, SlotID: otherSlot, SocialID: group, ShowCount: 1, ClickCount: 1},
+	}, stats)
+}
+
+func (s *Suite) TestEventsForUnknownObjects() {
+	b, slot, group, unknown := s.fx.Banners[0], s.fx.Slots[0], s.fx.Groups[0], s.fx.Unknown
+
+	cases := map[string]error{
+		"view unknown banner":  s.store.AddViewForBanner(s.ctx, unknown, slot, group),
+		"view unknown slot":    s.store.AddViewForBanner(s.ctx, b, unknown, group),
+		"view unknown group":   s.store.AddViewForBanner(s.ctx, b, slot, unknown),
+		"click unknown banner": s.store.AddClickForBanner(s.ctx, unknown, slot, group),
+		"click unknown slot":   s.store.AddClickForBanner(s.ctx, b, unknown, group),
+		"click unknown group":  s.store.AddClickForBanner(s.ctx, b, slot, unknown),
+	}
+	for name, err := range cases {
+		s.Require().True(errors.Is(err, storage.ErrObjectNotFound), "%s: %v", name, err)
+	}
+}
+
+func (s *Suite) TestFilterByDate() {
+	events, ok := s.store.(app.StatisticStore)
+	if !ok {
+		s.T().Skip("storage doesn't implement app.StatisticStore")
+	}
+
+	b, slot, group := s.fx.Banners[0], s.fx.Slots[0], s.fx.Groups[0]
+	s.Require().NoError(s.store.AddViewForBanner(s.ctx, b, slot, group))
+	s.Require().NoError(s.store.AddClickForBanner(s.ctx, b, slot, group))
+	s.Require().NoError(s.store.AddClickForBanner(s.ctx, b, slot, group))
+
+	now := time.Now()
+	from, to := now.Add(-time.Hour).Unix(), now.Add(time.Hour).Unix()
+
+	shows, err := events.BannersShowStatisticsFilterByDate(s.ctx, from, to)
+	s.Require().NoError(err)
+	s.Require().Len(s.inSlot(shows, slot), 1)
+
+	clicks, err := events.BannersClickStatisticsFilterByDate(s.ctx, from, to)
+	s.Require().NoError(err)
+	clicks = s.inSlot(clicks, slot)
+	s.Require().Len(clicks, 2)
+	s.Require().Equal(b, clicks[0].BannerID)
+	s.Require().Equal(group, clicks[0].SocialID)
+	s.Require().InDelta(float64(now.Unix()), clicks[0].Date, 60)
+
+	shows, err = events.BannersShowStatisticsFilterByDate(s.ctx, now.Add(-2*time.Hour).Unix(), from)
+	s.Require().NoError(err)
+	s.Require().Empty(s.inSlot(shows, slot))
+}
+
+func (s *Suite) TestFilterByDateIsHalfOpen() {
+	events, ok := s.store.(app.StatisticStore)
+	if !ok {
+		s.T().Skip("storage doesn't implement app.StatisticStore")
+	}
+
+	writer, ok := s.store.(app.EventBatchWriter)
+	if !ok {
+		s.T().Skip("storage doesn't implement app.EventBatchWriter")
+	}
+
+	b, slot, group := s.fx.Banners[0], s.fx.Slots[0], s.fx.Groups[0]
+	base := time.Now().Add(-24 * time.Hour).Truncate(time.Second)
+	s.Require().NoError(writer.AddEvents(s.ctx, []app.BannerEvent{
+		{Type: app.StatTypeShow, BannerID: b, SlotID: slot, SocialID: group, OccurredAt: base},
+		{Type: app.StatTypeShow, BannerID: b, SlotID: slot, SocialID: group, OccurredAt: base.Add(500 * time.Millisecond)},
+		{Type: app.StatTypeShow, BannerID: b, SlotID: slot, SocialID: group, OccurredAt: base.Add(time.Second)},
+	}))
+
+	shows, err := events.BannersShowStatisticsFilterByDate(s.ctx, base.Unix(), base.Add(time.Second).Unix())
+	s.Require().NoError(err)
+	shows = s.inSlot(shows, slot)
+	s.Require().Len(shows, 2)
+	s.Require().InDelta(float64(base.Unix())+0.5, shows[1].Date, 0.001)
+}
+
+func (s *Suite) TestAddEventsUpdatesStatistics() {
+	writer, ok := s.store.(app.EventBatchWriter)
+	if !ok {
+		s.T().Skip("storage doesn't implement app.EventBatchWriter")
+	}
+
+	b, slot, group := s.fx.Banners[0], s.fx.Slots[0], s.fx.Groups[0]
+	s.Require().NoError(s.store.AddBannerToSlot(s.ctx, b, slot))
+	now := time.Now()
+	s.Require().NoError(writer.AddEvents(s.ctx, []app.BannerEvent{
+		{Type: app.StatTypeShow, BannerID: b, SlotID: slot, SocialID: group, OccurredAt: now},
+		{Type: app.StatTypeClick, BannerID: b, SlotID: slot, SocialID: group, OccurredAt: now.Add(time.Microsecond)},
+	}))
+
+	err := writer.AddEvents(s.ctx, []app.BannerEvent{
+		{Type: app.StatTypeClick, BannerID: s.fx.Unknown, SlotID: slot, SocialID: group, OccurredAt: now},
+	})
+	s.Require().True(errors.Is(err, storage.ErrObjectNotFound), "%v", err)
+
+	stats, err := s.store.BannersStatistics(s.ctx, slot, group)
+	s.Require().NoError(err)
+	s.Require().Equal(int64(2), stats[0].ShowCount)
+	s.Require().Equal(int64(1), stats[0].ClickCount)
+}
+
+func (s *Suite) TestOutbox() {
+	outbox, ok := s.store.(app.StatisticStore)
+	if !ok {
+		s.T().Skip("storage doesn't implement app.StatisticStore")
+	}
+
+	b, slot, group := s.fx.Banners[0], s.fx.Slots[0], s.fx.Groups[0]
+	s.Require().NoError(s.store.AddBannerToSlot(s.ctx, b, slot))
+	s.Require().NoError(s.store.AddViewForBanner(s.ctx, b, slot, group))
+	s.Require().NoError(s.store.AddClickForBanner(s.ctx, b, slot, group))
+
+	events := s.outboxInSlot(outbox, slot)
+	s.Require().Len(events, 2, "seed views of AddBannerToSlot must not be in outbox")
+	s.Require().Equal(app.StatTypeShow, events[0].Type)
+	s.Require().Equal(app.StatTypeClick, events[1].Type)
+	s.Require().Equal(b, events[1].BannerID)
+	s.Require().Less(events[0].ID, events[1].ID)
+
+	s.Require().NoError(outbox.MarkOutboxSent(s.ctx, []int64{events[0].ID}))
+
+	events = s.outboxInSlot(outbox, slot)
+	s.Require().Len(events, 1)
+	s.Require().Equal(app.StatTypeClick, events[0].Type)
+}
+
+func (s *Suite) TestOutboxEventIDs() {
+	outbox, ok := s.store.(app.StatisticStore)
+	if !ok {
+		s.T().Skip("storage doesn't implement app.StatisticStore")
+	}
+	writer, ok := s.store.(app.EventBatchWriter)
+	if !ok {
+		s.T().Skip("storage doesn't implement app.EventBatchWriter")
+	}
+
+	b, slot, group := s.fx.Banners[0], s.fx.Slots[0], s.fx.Groups[0]
+	at := time.Now().Truncate(time.Microsecond)
+	twin := app.BannerEvent{Type: app.StatTypeShow, BannerID: b, SlotID: slot, SocialID: group, OccurredAt: at}
+	s.Require().NoError(writer.AddEvents(s.ctx, []app.BannerEvent{twin, twin}))
+	s.Require().NoError(s.store.AddViewForBanner(s.ctx, b, slot, group))
+
+	events := s.outboxInSlot(outbox, slot)
+	s.Require().Len(events, 3)
+	s.Require().NotZero(events[0].EventID)
+	s.Require().NotEqual(events[0].EventID, events[1].EventID, "events in the same microsecond must stay distinct")
+	s.Require().NotEqual(events[1].EventID, events[2].EventID)
+
+	// Backfill читает те же id из таблицы событий.
+	shows, err := outbox.BannersShowStatisticsFilterByDate(s.ctx, at.Add(-time.Hour).Unix(), at.Add(time.Hour).Unix())
+	s.Require().NoError(err)
+	var ids []int64
+	for _, show := range s.inSlot(shows, slot) {
+		ids = append(ids, show.EventID)
+	}
+	for _, e := range events {
+		s.Require().Contains(ids, e.EventID)
+	}
+}
+
+func (s *Suite) inSlot(stats []app.BannerStatistic, slot int64) []app.BannerStatistic {
+	var filtered []app.BannerStatistic
+	for _, st := range stats {
+		if st.SlotID == slot {
+			filtered = append(filtered, st)
+		}
+	}
+	return filtered
+}
+
+func (s *Suite) outboxInSlot(outbox app.StatisticStore, slot int64) []app.OutboxEvent {
+	// В общей базе могут быть чужие события, поэтому оставляем только события слота фикстуры.
+	batch, err := outbox.OutboxEvents(s.ctx, 1000)
+	s.Require().NoError(err)
+
+	var events []app.OutboxEvent
+	for _, e := range batch {
+		if e.SlotID == slot {
+			events = append(events, e)
+		}
+	}
+	return events
+}
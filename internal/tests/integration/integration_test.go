@@ -12,6 +12,7 @@ import (
 	"testing"
 
 	"github.com/jmoiron/sqlx"
+	"github.com/nsmak/bannersRotation/cmd/config"
 	"github.com/nsmak/bannersRotation/internal/app"
 	serverapi "github.com/nsmak/bannersRotation/internal/server/rest/api"
 	sqlstorage "github.com/nsmak/bannersRotation/internal/storage/sql"
@@ -36,8 +37,12 @@ type IntegrationSuite struct {
 	group   app.SocialGroup
 }
 
+func dbConf() config.DBConf {
+	return config.DBConf{Username: psUsr, Password: psPass, Address: psAddr, DBName: psDB}
+}
+
 func (s *IntegrationSuite) SetupTest() {
-	storage, err := sqlstorage.New(context.Background(), psUsr, psPass, psAddr, psDB)
+	storage, err := sqlstorage.New(context.Background(), dbConf())
 	if err != nil {
 		log.Fatalln(err.Error())
 	}
@@ -214,6 +219,16 @@ func (s *IntegrationSuite) removeStatisticsForDefaultData() {
 	if err != nil {
 		log.Fatalln(err.Error(), "delete click statistics")
 	}
+
+	_, err = s.db.Exec("DELETE FROM banner_counters WHERE slot_id=$1", s.slot.ID)
+	if err != nil {
+		log.Fatalln(err.Error(), "delete banner counters")
+	}
+
+	_, err = s.db.Exec("DELETE FROM statistic_outbox WHERE slot_id=$1", s.slot.ID)
+	if err != nil {
+		log.Fatalln(err.Error(), "delete outbox events")
+	}
 }
 
 func (s *IntegrationSuite) removeDefaultSlots() {
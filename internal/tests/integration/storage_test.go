@@ -0,0 +1,224 @@
+// +build integration
+
+package integration
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/nsmak/bannersRotation/cmd/config"
+	"github.com/nsmak/bannersRotation/internal/app"
+	sqlstorage "github.com/nsmak/bannersRotation/internal/storage/sql"
+	"github.com/nsmak/bannersRotation/internal/storage/storagetest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStorageConformance(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) (app.Storage, storagetest.Fixture) {
+		storage, err := sqlstorage.New(context.Background(), dbConf())
+		require.NoError(t, err)
+
+		db := (&IntegrationSuite{}).initDB()
+		fx := storagetest.Fixture{
+			Banners: []int64{200, 201},
+			Slots:   []int64{210, 211},
+			Groups:  []int64{220, 221},
+			Unknown: 999999,
+		}
+
+		cleanup := func() {
+			for _, slot := range fx.Slots {
+				for _, table := range []string{"banner_showing", "banner_click", "banner_counters", "statistic_outbox", "banner_slot"} {
+					_, err := db.Exec("DELETE FROM "+table+" WHERE slot_id=$1", slot)
+					require.NoError(t, err)
+				}
+			}
+			for _, id := range fx.Banners {
+				_, err := db.Exec("DELETE FROM banner WHERE id=$1", id)
+				require.NoError(t, err)
+			}
+			for _, id := range fx.Slots {
+				_, err := db.Exec("DELETE FROM slot WHERE id=$1", id)
+				require.NoError(t, err)
+			}
+			for _, id := range fx.Groups {
+				_, err := db.Exec("DELETE FROM social_dem WHERE id=$1", id)
+				require.NoError(t, err)
+			}
+		}
+		cleanup()
+
+		for _, id := range fx.Banners {
+			_, err := db.Exec("INSERT INTO banner (id, description) VALUES ($1, 'conformance')", id)
+			require.NoError(t, err)
+		}
+		for _, id := range fx.Slots {
+			_, err := db.Exec("INSERT INTO slot (id, description) VALUES ($1, 'conformance')", id)
+			require.NoError(t, err)
+		}
+		for _, id := range fx.Groups {
+			_, err := db.Exec("INSERT INTO social_dem (id, description) VALUES ($1, 'conformance')", id)
+			require.NoError(t, err)
+		}
+
+		t.Cleanup(func() {
+			cleanup()
+			_ = db.Close()
+			_ = storage.Close()
+		})
+
+		return storage, fx
+	})
+}
+
+func TestStorageReadsFallBackFromDeadReplica(t *testing.T) {
+	ctx := context.Background()
+	storage, err := sqlstorage.New(ctx, config.DBConf{
+		Username: psUsr,
+		Password: psPass,
+		Address:  psAddr,
+		DBName:   psDB,
+		Replicas: []string{"127.0.0.1:1", psAddr},
+	})
+	require.NoError(t, err)
+	defer storage.Close()
+
+	for i := 0; i < 3; i++ {
+		_, err := storage.BannersShowStatisticsFilterByDate(ctx, 0, 1)
+		require.NoError(t, err)
+	}
+}
+
+func TestDeleteSentOutbox(t *testing.T) {
+	ctx := context.Background()
+	storage, err := sqlstorage.New(ctx, dbConf())
+	require.NoError(t, err)
+	defer storage.Close()
+
+	db := (&IntegrationSuite{}).initDB()
+	defer db.Close()
+
+	const slot = 230
+	cleanup := func() {
+		_, err := db.Exec("DELETE FROM statistic_outbox WHERE slot_id=$1", slot)
+		require.NoError(t, err)
+	}
+	cleanup()
+	defer cleanup()
+
+	now := time.Now().UTC()
+	for _, sentAt := range []interface{}{now.Add(-48 * time.Hour), now.Add(-time.Hour), nil} {
+		_, err := db.Exec(
+			`INSERT INTO statistic_outbox (type, event_id, banner_id, slot_id, social_id, date, sent_at)
+				VALUES ('show', 1, 1, $1, 1, $2, $3)`,
+			slot, now.Add(-72*time.Hour), sentAt,
+		)
+		require.NoError(t, err)
+	}
+
+	deleted, err := storage.DeleteSentOutbox(ctx, now.Add(-24*time.Hour))
+	require.NoError(t, err)
+	require.EqualValues(t, 1, deleted)
+
+	var left int
+	require.NoError(t, db.Get(&left, "SELECT count(*) FROM statistic_outbox WHERE slot_id=$1", slot))
+	require.Equal(t, 2, left)
+}
+
+func TestReportRows(t *testing.T) {
+	ctx := context.Background()
+	storage, err := sqlstorage.New(ctx, dbConf())
+	require.NoError(t, err)
+	defer storage.Close()
+
+	db := (&IntegrationSuite{}).initDB()
+	defer db.Close()
+
+	const slot = 240
+	cleanup := func() {
+		_, err := db.Exec("DELETE FROM banner_rollup_daily WHERE slot_id=$1", slot)
+		require.NoError(t, err)
+	}
+	cleanup()
+	defer cleanup()
+
+	day := func(d int) time.Time { return time.Date(2021, 2, d, 0, 0, 0, 0, time.UTC) }
+	for _, r := range []app.BannerRollup{
+		{Bucket: day(1), BannerID: 1, SocialID: 1, Shows: 10, Clicks: 1},
+		{Bucket: day(1), BannerID: 1, SocialID: 2, Shows: 10, Clicks: 3},
+		{Bucket: day(1), BannerID: 2, SocialID: 1, Shows: 5, Clicks: 0},
+		{Bucket: day(8), BannerID: 2, SocialID: 1, Shows: 20, Clicks: 4},
+	} {
+		_, err := db.Exec(
+			`INSERT INTO banner_rollup_daily (bucket, banner_id, slot_id, social_id, shows, clicks)
+				VALUES ($1, $2, $3, $4, $5, $6)`,
+			r.Bucket, r.BannerID, slot, r.SocialID, r.Shows, r.Clicks,
+		)
+		require.NoError(t, err)
+	}
+
+	query := app.ReportQuery{
+		From:    day(1),
+		To:      day(10),
+		GroupBy: []app.ReportDimension{app.ReportByBanner},
+		SlotID:  slot,
+		Sort:    "-ctr",
+		Limit:   100,
+	}
+	rows, total, err := storage.ReportRows(ctx, app.GranularityDay, query)
+	require.NoError(t, err)
+	require.Equal(t, 2, total)
+	require.Equal(t, []app.ReportRow{
+		{BannerID: 1, Shows: 20, Clicks: 4},
+		{BannerID: 2, Shows: 25, Clicks: 4},
+	}, rows)
+
+	query.GroupBy = []app.ReportDimension{app.ReportByBucket, app.ReportBySlot}
+	query.Bucket = app.GranularityWeek
+	query.Sort = ""
+	rows, _, err = storage.ReportRows(ctx, app.GranularityDay, query)
+	require.NoError(t, err)
+	// 1 февраля 2021 - понедельник.
+	require.Equal(t, []app.ReportRow{
+		{Bucket: day(1), SlotID: slot, Shows: 25, Clicks: 4},
+		{Bucket: day(8), SlotID: slot, Shows: 20, Clicks: 4},
+	}, rows)
+
+	// Равные по показам строки упорядочены по баннеру, слоту и группе.
+	query.GroupBy = []app.ReportDimension{app.ReportByBanner, app.ReportBySocial}
+	query.Sort = "shows"
+	query.Limit = 2
+	rows, total, err = storage.ReportRows(ctx, app.GranularityDay, query)
+	require.NoError(t, err)
+	require.Equal(t, 3, total)
+	require.Equal(t, []app.ReportRow{
+		{BannerID: 1, SocialID: 1, Shows: 10, Clicks: 1},
+		{BannerID: 1, SocialID: 2, Shows: 10, Clicks: 3},
+	}, rows)
+
+	query.Offset = 10
+	rows, total, err = storage.ReportRows(ctx, app.GranularityDay, query)
+	require.NoError(t, err)
+	require.Equal(t, 3, total)
+	require.Empty(t, rows)
+
+	query.BannerID, query.Offset = 2, 0
+	rows, total, err = storage.ReportRows(ctx, app.GranularityDay, query)
+	require.NoError(t, err)
+	require.Equal(t, 1, total)
+	require.Equal(t, []app.ReportRow{{BannerID: 2, SocialID: 1, Shows: 25, Clicks: 4}}, rows)
+}
+
+func TestCheckSchemaUsesContext(t *testing.T) {
+	storage, err := sqlstorage.New(context.Background(), dbConf())
+	require.NoError(t, err)
+	defer storage.Close()
+
+	require.NoError(t, storage.CheckSchema(context.Background()))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	require.True(t, errors.Is(storage.CheckSchema(ctx), context.Canceled))
+}
@@ -0,0 +1,122 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/nsmak/bannersRotation/cmd/config"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	ExporterNone   = ""
+	ExporterStdout = "stdout"
+	ExporterOTLP   = "otlp"
+)
+
+// ErrUnknownExporter - в конфиге указан неизвестный экспортер. Пакет не зависит от app,
+// чтобы домен мог продолжать трассировку, поэтому ошибки здесь обычные.
+var ErrUnknownExporter = errors.New("unknown tracing exporter")
+
+// Контекст трассировки передается в формате W3C Trace Context.
+var propagator = propagation.TraceContext{}
+
+// Setup - устанавливает W3C-пропагатор и, если задан экспортер, глобальный TracerProvider.
+// Возвращаемая функция отправляет накопленные спаны и останавливает экспортер.
+func Setup(ctx context.Context, cfg config.TracingConf, service string) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagator)
+
+	var (
+		exporter sdktrace.SpanExporter
+		err      error
+	)
+	switch cfg.Exporter {
+	case ExporterNone:
+		return func(context.Context) error { return nil }, nil
+	case ExporterStdout:
+		// stdout занят выводом команд, например CSV statistic export.
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(os.Stderr))
+	case ExporterOTLP:
+		opts := []otlptracehttp.Option{otlptracehttp.WithEndpoint(cfg.Endpoint)}
+		if cfg.Insecure {
+			opts = append(opts, otlptracehttp.WithInsecure())
+		}
+		exporter, err = otlptracehttp.New(ctx, opts...)
+	default:
+		return nil, fmt.Errorf("%w %q", ErrUnknownExporter, cfg.Exporter)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("can't create tracing exporter: %w", err)
+	}
+
+	ratio := cfg.SampleRatio
+	if ratio <= 0 || ratio > 1 {
+		ratio = 1
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(ratio))),
+		sdktrace.WithResource(resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceNameKey.String(service))),
+	)
+	otel.SetTracerProvider(provider)
+
+	return provider.Shutdown, nil
+}
+
+// End - завершает спан, ошибка err записывается в него.
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// TraceParent - заголовок traceparent текущего спана ctx, пустая строка, если спана нет.
+func TraceParent(ctx context.Context) string {
+	carrier := Carrier{}
+	propagator.Inject(ctx, carrier)
+	return carrier.Get("traceparent")
+}
+
+// WithTraceParent - контекст, в котором родитель следующих спанов - спан из traceParent.
+func WithTraceParent(ctx context.Context, traceParent string) context.Context {
+	if traceParent == "" {
+		return ctx
+	}
+	return propagator.Extract(ctx, Carrier{"traceparent": traceParent})
+}
+
+// Carrier - заголовки сообщения, в которые записывается и из которых читается контекст трассировки.
+type Carrier map[string]string
+
+func (c Carrier) Get(key string) string {
+	return c[key]
+}
+
+func (c Carrier) Set(key, value string) {
+	c[key] = value
+}
+
+func (c Carrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for k := range c {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+// Inject - записывает контекст трассировки ctx в заголовки c.
+func Inject(ctx context.Context, c Carrier) {
+	propagator.Inject(ctx, c)
+}
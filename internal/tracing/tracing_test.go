@@ -0,0 +1,40 @@
+package tracing_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/nsmak/bannersRotation/cmd/config"
+	"github.com/nsmak/bannersRotation/internal/tracing"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const traceParent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+func TestTraceParentRoundTrip(t *testing.T) {
+	ctx := tracing.WithTraceParent(context.Background(), traceParent)
+
+	sc := trace.SpanContextFromContext(ctx)
+	require.True(t, sc.IsRemote())
+	require.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", sc.TraceID().String())
+	require.Equal(t, traceParent, tracing.TraceParent(ctx))
+
+	carrier := tracing.Carrier{}
+	tracing.Inject(ctx, carrier)
+	require.Equal(t, tracing.Carrier{"traceparent": traceParent}, carrier)
+}
+
+func TestTraceParentWithoutSpan(t *testing.T) {
+	require.Empty(t, tracing.TraceParent(context.Background()))
+
+	ctx := tracing.WithTraceParent(context.Background(), "")
+	require.False(t, trace.SpanContextFromContext(ctx).IsValid())
+}
+
+func TestSetupUnknownExporter(t *testing.T) {
+	_, err := tracing.Setup(context.Background(), config.TracingConf{Exporter: "jaeger"}, "rotator")
+
+	require.True(t, errors.Is(err, tracing.ErrUnknownExporter))
+}
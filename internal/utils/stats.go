@@ -0,0 +1,63 @@
+package utils
+
+import (
+	"math"
+)
+
+// NormalQuantile - квантиль стандартного нормального распределения для вероятности p из (0, 1).
+func NormalQuantile(p float64) float64 {
+	return math.Sqrt2 * math.Erfinv(2*p-1)
+}
+
+// WilsonInterval - доверительный интервал Уилсона для доли successes из trials с уровнем доверия confidence.
+// В отличие от нормального приближения интервал не выходит за [0, 1] и не схлопывается на малых выборках.
+func WilsonInterval(successes, trials int64, confidence float64) (low, high float64) {
+	if trials <= 0 {
+		return 0, 1
+	}
+	successes = clampSuccesses(successes, trials)
+
+	z := NormalQuantile(1 - (1-confidence)/2)
+	n := float64(trials)
+	p := float64(successes) / n
+	z2 := z * z
+
+	center := (p + z2/(2*n)) / (1 + z2/n)
+	margin := z / (1 + z2/n) * math.Sqrt(p*(1-p)/n+z2/(4*n*n))
+
+	return math.Max(0, center-margin), math.Min(1, center+margin)
+}
+
+// TwoProportionZTest - z-тест разницы долей a = successesA/trialsA и b = successesB/trialsB
+// с объединенной оценкой дисперсии. Возвращает z (положительный, если a больше b) и двусторонний p-value.
+// Если сравнивать нечего (нет испытаний или обе доли 0 или 1), z = 0 и p-value = 1.
+func TwoProportionZTest(successesA, trialsA, successesB, trialsB int64) (z, pValue float64) {
+	if trialsA <= 0 || trialsB <= 0 {
+		return 0, 1
+	}
+	successesA, successesB = clampSuccesses(successesA, trialsA), clampSuccesses(successesB, trialsB)
+
+	nA, nB := float64(trialsA), float64(trialsB)
+	pA, pB := float64(successesA)/nA, float64(successesB)/nB
+	pooled := float64(successesA+successesB) / (nA + nB)
+
+	se := math.Sqrt(pooled * (1 - pooled) * (1/nA + 1/nB))
+	if se == 0 {
+		return 0, 1
+	}
+
+	z = (pA - pB) / se
+	return z, math.Erfc(math.Abs(z) / math.Sqrt2)
+}
+
+// clampSuccesses - успехов может оказаться больше испытаний: клик попадает в следующий интервал после показа.
+// Доля больше 1 дала бы отрицательную дисперсию и NaN, поэтому успехи ограничиваются [0, trials].
+func clampSuccesses(successes, trials int64) int64 {
+	if successes < 0 {
+		return 0
+	}
+	if successes > trials {
+		return trials
+	}
+	return successes
+}
@@ -0,0 +1,72 @@
+package utils
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNormalQuantile(t *testing.T) {
+	require.InDelta(t, 1.959964, NormalQuantile(0.975), 1e-6)
+	require.InDelta(t, 0, NormalQuantile(0.5), 1e-12)
+	require.InDelta(t, -1.644854, NormalQuantile(0.05), 1e-6)
+}
+
+func TestWilsonInterval(t *testing.T) {
+	low, high := WilsonInterval(10, 100, 0.95)
+
+	require.InDelta(t, 0.0552, low, 1e-4)
+	require.InDelta(t, 0.1744, high, 1e-4)
+}
+
+func TestWilsonIntervalBounds(t *testing.T) {
+	low, high := WilsonInterval(0, 5, 0.95)
+	require.Equal(t, 0.0, low)
+	require.InDelta(t, 0.4345, high, 1e-4)
+
+	low, high = WilsonInterval(5, 5, 0.95)
+	require.InDelta(t, 0.5655, low, 1e-4)
+	require.Equal(t, 1.0, high)
+
+	low, high = WilsonInterval(7, 5, 0.95)
+	require.InDelta(t, 0.5655, low, 1e-4)
+	require.Equal(t, 1.0, high)
+
+	low, high = WilsonInterval(0, 0, 0.95)
+	require.Equal(t, 0.0, low)
+	require.Equal(t, 1.0, high)
+}
+
+func TestTwoProportionZTest(t *testing.T) {
+	z, p := TwoProportionZTest(200, 1000, 150, 1000)
+
+	require.InDelta(t, 2.9424, z, 1e-4)
+	require.InDelta(t, 0.0032, p, 1e-4)
+
+	z, p = TwoProportionZTest(150, 1000, 200, 1000)
+	require.InDelta(t, -2.9424, z, 1e-4)
+	require.InDelta(t, 0.0032, p, 1e-4)
+}
+
+func TestTwoProportionZTestMoreSuccessesThanTrials(t *testing.T) {
+	z, p := TwoProportionZTest(3, 2, 150, 1000)
+
+	require.False(t, math.IsNaN(z))
+	require.False(t, math.IsNaN(p))
+	require.Greater(t, z, 0.0)
+}
+
+func TestTwoProportionZTestDegenerate(t *testing.T) {
+	for _, c := range [][4]int64{
+		{0, 0, 1, 10},
+		{0, 10, 0, 20},
+		{10, 10, 20, 20},
+		{12, 10, 25, 20},
+	} {
+		z, p := TwoProportionZTest(c[0], c[1], c[2], c[3])
+
+		require.Equal(t, 0.0, z, c)
+		require.Equal(t, 1.0, p, c)
+	}
+}
@@ -0,0 +1,17 @@
+-- +goose Up
+CREATE TABLE IF NOT EXISTS statistic_dead_letter (
+    id bigserial NOT NULL,
+    event_id text NOT NULL,
+    schema_version integer NOT NULL,
+    type text NOT NULL,
+    occurred_at timestamptz NOT NULL,
+    banner_id integer NOT NULL,
+    slot_id integer NOT NULL,
+    social_id integer NOT NULL,
+    reason text NOT NULL DEFAULT '',
+    failed_at timestamptz NOT NULL DEFAULT current_timestamp,
+    PRIMARY KEY (id)
+);
+
+-- +goose Down
+drop table statistic_dead_letter;
@@ -0,0 +1,17 @@
+-- +goose Up
+CREATE TABLE IF NOT EXISTS statistic_outbox (
+    id bigserial NOT NULL,
+    type text NOT NULL,
+    event_id bigint NOT NULL,
+    banner_id integer NOT NULL,
+    slot_id integer NOT NULL,
+    social_id integer NOT NULL,
+    date timestamptz NOT NULL,
+    sent_at timestamptz,
+    PRIMARY KEY (id)
+);
+
+CREATE INDEX IF NOT EXISTS statistic_outbox_unsent_idx ON statistic_outbox (id) WHERE sent_at IS NULL;
+
+-- +goose Down
+drop table statistic_outbox;
@@ -0,0 +1,29 @@
+-- +goose Up
+CREATE TABLE IF NOT EXISTS banner_counters (
+    banner_id integer NOT NULL,
+    slot_id integer NOT NULL,
+    social_id integer NOT NULL,
+    shows bigint NOT NULL DEFAULT 0,
+    clicks bigint NOT NULL DEFAULT 0,
+    PRIMARY KEY (slot_id, social_id, banner_id),
+    FOREIGN KEY (banner_id)
+        REFERENCES banner (id),
+    FOREIGN KEY (slot_id)
+        REFERENCES slot (id),
+    FOREIGN KEY (social_id)
+        REFERENCES social_dem (id)
+);
+
+INSERT INTO banner_counters (banner_id, slot_id, social_id, shows, clicks)
+SELECT coalesce(sh.banner_id, cl.banner_id),
+       coalesce(sh.slot_id, cl.slot_id),
+       coalesce(sh.social_id, cl.social_id),
+       coalesce(sh.count, 0),
+       coalesce(cl.count, 0)
+FROM (SELECT banner_id, slot_id, social_id, count(*) FROM banner_showing GROUP BY 1,2,3) sh
+FULL JOIN (SELECT banner_id, slot_id, social_id, count(*) FROM banner_click GROUP BY 1,2,3) cl
+ON (sh.banner_id=cl.banner_id AND sh.slot_id=cl.slot_id AND sh.social_id=cl.social_id)
+ON CONFLICT DO NOTHING;
+
+-- +goose Down
+drop table banner_counters;
@@ -0,0 +1,134 @@
+-- +goose Up
+ALTER TABLE banner_showing RENAME TO banner_showing_old;
+ALTER TABLE banner_click RENAME TO banner_click_old;
+ALTER INDEX banner_showing_pkey RENAME TO banner_showing_old_pkey;
+ALTER INDEX banner_click_pkey RENAME TO banner_click_old_pkey;
+
+CREATE TABLE banner_showing (
+    id bigserial NOT NULL,
+    banner_id integer NOT NULL,
+    slot_id integer NOT NULL,
+    social_id integer NOT NULL,
+    date timestamptz NOT NULL DEFAULT current_timestamp,
+    PRIMARY KEY (id, date),
+    FOREIGN KEY (banner_id)
+        REFERENCES banner (id),
+    FOREIGN KEY (slot_id)
+        REFERENCES slot (id),
+    FOREIGN KEY (social_id)
+        REFERENCES social_dem (id)
+) PARTITION BY RANGE (date);
+
+CREATE TABLE banner_click (
+    id bigserial NOT NULL,
+    banner_id integer NOT NULL,
+    slot_id integer NOT NULL,
+    social_id integer NOT NULL,
+    date timestamptz NOT NULL DEFAULT current_timestamp,
+    PRIMARY KEY (id, date),
+    FOREIGN KEY (banner_id)
+        REFERENCES banner (id),
+    FOREIGN KEY (slot_id)
+        REFERENCES slot (id),
+    FOREIGN KEY (social_id)
+        REFERENCES social_dem (id)
+) PARTITION BY RANGE (date);
+
+CREATE INDEX banner_showing_date_idx ON banner_showing (date);
+CREATE INDEX banner_click_date_idx ON banner_click (date);
+
+-- События за дни без своей партиции попадают в default, create_event_partition переносит их при создании партиции.
+CREATE TABLE banner_showing_default PARTITION OF banner_showing DEFAULT;
+CREATE TABLE banner_click_default PARTITION OF banner_click DEFAULT;
+
+-- +goose StatementBegin
+CREATE OR REPLACE FUNCTION create_event_partition(parent text, day date) RETURNS boolean AS $$
+DECLARE
+    partition_name text := parent || '_p' || to_char(day, 'YYYYMMDD');
+    day_start timestamptz := day::timestamp AT TIME ZONE 'UTC';
+    day_end timestamptz := (day + 1)::timestamp AT TIME ZONE 'UTC';
+BEGIN
+    IF to_regclass(partition_name) IS NOT NULL THEN
+        RETURN false;
+    END IF;
+
+    EXECUTE format('CREATE TABLE %I (LIKE %I INCLUDING DEFAULTS)', partition_name, parent);
+    EXECUTE format(
+        'WITH moved AS (DELETE FROM %I WHERE date >= %L AND date < %L RETURNING *) INSERT INTO %I SELECT * FROM moved',
+        parent || '_default', day_start, day_end, partition_name
+    );
+    EXECUTE format('ALTER TABLE %I ATTACH PARTITION %I FOR VALUES FROM (%L) TO (%L)', parent, partition_name, day_start, day_end);
+    RETURN true;
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+DO $$
+DECLARE
+    day date;
+BEGIN
+    FOR day IN
+        SELECT DISTINCT (date AT TIME ZONE 'UTC')::date FROM banner_showing_old
+        UNION
+        SELECT DISTINCT (date AT TIME ZONE 'UTC')::date FROM banner_click_old
+        UNION
+        SELECT (current_timestamp AT TIME ZONE 'UTC')::date + i FROM generate_series(0, 7) i
+    LOOP
+        PERFORM create_event_partition('banner_showing', day);
+        PERFORM create_event_partition('banner_click', day);
+    END LOOP;
+END;
+$$;
+-- +goose StatementEnd
+
+INSERT INTO banner_showing (banner_id, slot_id, social_id, date)
+SELECT banner_id, slot_id, social_id, date FROM banner_showing_old ORDER BY date;
+INSERT INTO banner_click (banner_id, slot_id, social_id, date)
+SELECT banner_id, slot_id, social_id, date FROM banner_click_old ORDER BY date;
+
+DROP TABLE banner_showing_old;
+DROP TABLE banner_click_old;
+
+-- +goose Down
+ALTER TABLE banner_showing RENAME TO banner_showing_new;
+ALTER TABLE banner_click RENAME TO banner_click_new;
+ALTER INDEX banner_showing_pkey RENAME TO banner_showing_new_pkey;
+ALTER INDEX banner_click_pkey RENAME TO banner_click_new_pkey;
+
+CREATE TABLE banner_showing (
+    banner_id serial NOT NULL,
+    slot_id serial NOT NULL,
+    social_id serial NOT NULL,
+    date timestamptz NOT NULL DEFAULT current_timestamp,
+    PRIMARY KEY (banner_id, slot_id, social_id, date),
+    FOREIGN KEY (banner_id)
+        REFERENCES banner (id),
+    FOREIGN KEY (slot_id)
+        REFERENCES slot (id),
+    FOREIGN KEY (social_id)
+        REFERENCES social_dem (id)
+);
+
+CREATE TABLE banner_click (
+    banner_id serial NOT NULL,
+    slot_id serial NOT NULL,
+    social_id serial NOT NULL,
+    date timestamptz NOT NULL DEFAULT current_timestamp,
+    PRIMARY KEY (banner_id, slot_id, social_id, date),
+    FOREIGN KEY (banner_id)
+        REFERENCES banner (id),
+    FOREIGN KEY (slot_id)
+        REFERENCES slot (id),
+    FOREIGN KEY (social_id)
+        REFERENCES social_dem (id)
+);
+
+INSERT INTO banner_showing (banner_id, slot_id, social_id, date)
+SELECT banner_id, slot_id, social_id, date FROM banner_showing_new ON CONFLICT DO NOTHING;
+INSERT INTO banner_click (banner_id, slot_id, social_id, date)
+SELECT banner_id, slot_id, social_id, date FROM banner_click_new ON CONFLICT DO NOTHING;
+
+DROP TABLE banner_showing_new;
+DROP TABLE banner_click_new;
+DROP FUNCTION create_event_partition(text, date);
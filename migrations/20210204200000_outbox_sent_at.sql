@@ -0,0 +1,5 @@
+-- +goose Up
+CREATE INDEX IF NOT EXISTS statistic_outbox_sent_at_idx ON statistic_outbox (sent_at) WHERE sent_at IS NOT NULL;
+
+-- +goose Down
+DROP INDEX IF EXISTS statistic_outbox_sent_at_idx;
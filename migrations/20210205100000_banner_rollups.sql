@@ -0,0 +1,31 @@
+-- +goose Up
+CREATE TABLE IF NOT EXISTS banner_rollup_hourly (
+    bucket timestamptz NOT NULL,
+    banner_id integer NOT NULL,
+    slot_id integer NOT NULL,
+    social_id integer NOT NULL,
+    shows bigint NOT NULL DEFAULT 0,
+    clicks bigint NOT NULL DEFAULT 0,
+    PRIMARY KEY (bucket, slot_id, social_id, banner_id)
+);
+
+CREATE TABLE IF NOT EXISTS banner_rollup_daily (
+    bucket timestamptz NOT NULL,
+    banner_id integer NOT NULL,
+    slot_id integer NOT NULL,
+    social_id integer NOT NULL,
+    shows bigint NOT NULL DEFAULT 0,
+    clicks bigint NOT NULL DEFAULT 0,
+    PRIMARY KEY (bucket, slot_id, social_id, banner_id)
+);
+
+CREATE TABLE IF NOT EXISTS rollup_watermark (
+    granularity text NOT NULL,
+    rolled_up_to timestamptz NOT NULL,
+    PRIMARY KEY (granularity)
+);
+
+-- +goose Down
+drop table banner_rollup_hourly;
+drop table banner_rollup_daily;
+drop table rollup_watermark;
@@ -0,0 +1,5 @@
+-- +goose Up
+ALTER TABLE statistic_outbox ADD COLUMN IF NOT EXISTS trace_parent text NOT NULL DEFAULT '';
+
+-- +goose Down
+ALTER TABLE statistic_outbox DROP COLUMN IF EXISTS trace_parent;
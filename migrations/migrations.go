@@ -0,0 +1,7 @@
+// Package migrations - SQL миграции goose, встроенные в бинарники сервисов.
+package migrations
+
+import "embed"
+
+//go:embed *.sql
+var FS embed.FS